@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+)
+
+// cacheFlush deletes the cached entries whose key starts with a prefix.
+// Flushing every key needs --all: the job queue and locks may share the
+// Redis instance of the cache.
+func cacheFlush(_ *database.Database, args []string) {
+	if len(args) != 2 || args[0] != "flush" || args[1] == "" {
+		usageError("cache")
+	}
+	prefix := args[1]
+	if prefix == "--all" {
+		prefix = ""
+	}
+
+	ctx := context.Background()
+	c, err := cache.New(ctx)
+	if err != nil {
+		fail("Could not connect to cache", err)
+	}
+	defer c.Close()
+
+	if err := c.DeleteByPrefix(ctx, prefix); err != nil {
+		fail("Could not flush cache", err)
+	}
+	if prefix == "" {
+		fmt.Println("Flushed every cached entry")
+		return
+	}
+	fmt.Printf("Flushed cached entries starting with %q\n", prefix)
+}
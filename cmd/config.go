@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/maintenance"
+	"rest-skeleton/internal/middleware"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/mailer"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/redis"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// envCheck is one part of the configuration checked by config check.
+type envCheck struct {
+	name string
+	// online checks connect to a service and are skipped with --offline.
+	online bool
+	run    func(ctx context.Context) error
+}
+
+// errOptional marks a failure the application runs without.
+var errOptional = errors.New("optional")
+
+var envChecks = []envCheck{
+	{name: "app", run: checkApp},
+	{name: "limits", run: checkLimits},
+	{name: "log", run: func(context.Context) error {
+		_, err := logger.OptionsFromEnv()
+		return err
+	}},
+	{name: "access log", run: func(context.Context) error {
+		_, err := middleware.AccessLogConfigFromEnv()
+		return err
+	}},
+	{name: "database", run: func(context.Context) error {
+		_, err := database.ConfigFromEnv()
+		return err
+	}},
+	{name: "mail", run: func(context.Context) error {
+		cfg, err := mailer.ConfigFromEnv()
+		if err == nil {
+			_, err = mailer.New(cfg, nil)
+		}
+		return err
+	}},
+	{name: "maintenance", run: func(context.Context) error {
+		_, err := maintenance.ConfigFromEnv()
+		return err
+	}},
+	{name: "outbox", run: func(context.Context) error {
+		_, err := outbox.SinksFromEnv(nil, outbox.NewBus())
+		return err
+	}},
+	{name: "database connection", online: true, run: func(context.Context) error {
+		db, err := database.NewDatabase(nil)
+		if err == nil {
+			db.Close()
+		}
+		return err
+	}},
+	{name: "cache connection", online: true, run: func(ctx context.Context) error {
+		c, err := cache.New(ctx)
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}},
+	{name: "redis connection", online: true, run: func(ctx context.Context) error {
+		cfg, err := redis.ConfigFromEnv()
+		if err == nil {
+			var client *redis.Cache
+			if client, err = redis.NewCache(ctx, cfg); err == nil {
+				client.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%w: leader election and the job queue are disabled: %v", errOptional, err)
+		}
+		return nil
+	}},
+}
+
+// configCheck validates the environment the server and the CLI read, and
+// connects to the services it names unless --offline is given. It exits with
+// 1 when a required part is invalid.
+func configCheck(_ *database.Database, args []string) {
+	offline := len(args) == 2 && args[1] == "--offline"
+	if len(args) == 0 || args[0] != "check" || (len(args) == 2 && !offline) || len(args) > 2 {
+		usageError("config")
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, check := range envChecks {
+		if check.online && offline {
+			fmt.Fprintf(w, "skip\t%s\n", check.name)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := check.run(ctx)
+		cancel()
+		switch {
+		case err == nil:
+			fmt.Fprintf(w, "ok\t%s\n", check.name)
+		case errors.Is(err, errOptional):
+			fmt.Fprintf(w, "warn\t%s\t%v\n", check.name, err)
+		default:
+			fmt.Fprintf(w, "FAIL\t%s\t%v\n", check.name, err)
+			failed++
+		}
+	}
+	w.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\n%d check(s) failed\n", failed)
+		os.Exit(1)
+	}
+}
+
+func checkApp(context.Context) error {
+	var errs []error
+	for _, name := range []string{"APP_NAME", "APP_PORT", "TOKEN_SALT"} {
+		if os.Getenv(name) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	if port := os.Getenv("APP_PORT"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			errs = append(errs, fmt.Errorf("invalid APP_PORT %q", port))
+		}
+	}
+	if os.Getenv("APP_ENV") == "production" && os.Getenv("TOKEN_SALT") == "secret-security-salt" {
+		errs = append(errs, fmt.Errorf("TOKEN_SALT still has the value of .env.example"))
+	}
+	return errors.Join(errs...)
+}
+
+// checkLimits validates the numbers read by the middleware and the workers.
+// The middleware only reads them when a request comes in.
+func checkLimits(context.Context) error {
+	var errs []error
+	positive := func(name string, required bool) {
+		v := os.Getenv(name)
+		if v == "" {
+			if required {
+				errs = append(errs, fmt.Errorf("%s is required", name))
+			}
+			return
+		}
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			errs = append(errs, fmt.Errorf("%s must be a positive number, got %q", name, v))
+		}
+	}
+	positive("CONCURRENCY_LIMIT", true)
+	positive("RATE_LIMIT_RPS", true)
+	positive("RATE_LIMIT_BURST", true)
+	positive("WEBHOOK_MAX_ATTEMPTS", false)
+	positive("JOBS_CONCURRENCY", false)
+
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE"); v != "" {
+		if _, err := strconv.ParseBool(v); err != nil {
+			errs = append(errs, fmt.Errorf("WEBHOOK_ALLOW_PRIVATE must be true or false, got %q", v))
+		}
+	}
+
+	if v := os.Getenv("MIGRATION_LOCK_TIMEOUT"); v != "" {
+		if _, err := time.ParseDuration(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid MIGRATION_LOCK_TIMEOUT: %v", err))
+		}
+	}
+	return errors.Join(errs...)
+}
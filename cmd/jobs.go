@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/maintenance"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/lock"
+	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/pkg/scheduler"
+	"text/tabwriter"
+	"time"
+)
+
+// jobs lists the scheduled tasks or runs one of them now. A run takes the
+// same lock as the scheduler, so it never overlaps a scheduled run.
+func jobs(db *database.Database, args []string) {
+	ctx := context.Background()
+
+	log := newLogger()
+	db.Log = log
+
+	cfg, err := maintenance.ConfigFromEnv()
+	if err != nil {
+		fmt.Println("Invalid maintenance configuration", err)
+		os.Exit(1)
+	}
+	cfg.DB, cfg.Log = db, log
+	if len(args) > 0 && args[0] == "run" {
+		if cfg.Cache, err = cache.New(ctx); err != nil {
+			fmt.Println("Could not connect to cache", err)
+			os.Exit(1)
+		}
+		defer cfg.Cache.Close()
+	}
+
+	var locker *lock.Locker
+	if redisCfg, err := redis.ConfigFromEnv(); err == nil {
+		if client, err := redis.NewCache(ctx, redisCfg); err == nil {
+			defer client.Close()
+			locker = lock.NewLocker(client.Client())
+		}
+	}
+
+	sched := scheduler.New(log, locker)
+	for _, task := range maintenance.Tasks(cfg) {
+		if err := sched.Add(task); err != nil {
+			fmt.Println("Invalid scheduled task", err)
+			os.Exit(1)
+		}
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCHEDULE\tNEXT RUN\tDESCRIPTION")
+		for _, e := range sched.Tasks(time.Now()) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Name, e.Schedule, e.Next.Format(time.RFC3339), e.Description)
+		}
+		w.Flush()
+	case len(args) == 2 && args[0] == "run":
+		if err := sched.RunTask(ctx, args[1]); err != nil {
+			fmt.Println("Task failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Task finished:", args[1])
+	default:
+		usageError("jobs")
+	}
+}
@@ -1,16 +1,105 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"os"
 	"rest-skeleton/internal/pkg/config"
 	"rest-skeleton/internal/pkg/database"
-	"rest-skeleton/internal/pkg/migration"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/telemetry"
+	"strings"
+	"text/tabwriter"
 
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	usage   []string
+	summary string
+	// db commands are given a database connection, the others get nil.
+	db  bool
+	run func(db *database.Database, args []string)
+}
+
+// commands is filled in init: the commands print their own usage from it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:    "migrate",
+			usage:   []string{"migrate [plan] [up | down [n] | to <version> | redo] [--dry-run]", "migrate status | repair | create <name>"},
+			summary: "apply, roll back and inspect schema migrations",
+			db:      true,
+			run:     migrate,
+		},
+		{
+			name:    "seed",
+			usage:   []string{"seed [name...] [--fresh] [--env dev|test|prod-bootstrap]"},
+			summary: "run the seeders of an environment",
+			db:      true,
+			run:     seedDatabase,
+		},
+		{
+			name:    "jobs",
+			usage:   []string{"jobs list | run <name>"},
+			summary: "list the scheduled tasks or run one now",
+			db:      true,
+			run:     jobs,
+		},
+		{
+			name:    "user",
+			usage:   []string{"user create <email> <name> [--role <role>...]", "user disable | enable | reset-password <user>"},
+			summary: "manage users; <user> is an id or an email, passwords are read from stdin",
+			db:      true,
+			run:     user,
+		},
+		{
+			name:    "role",
+			usage:   []string{"role grant | revoke <user> <role>..."},
+			summary: "grant roles to a user or revoke them",
+			db:      true,
+			run:     role,
+		},
+		{
+			name:    "token",
+			usage:   []string{"token mint <email> [--ttl <duration>]"},
+			summary: "sign an API token for local debugging",
+			db:      true,
+			run:     token,
+		},
+		{
+			name:    "cache",
+			usage:   []string{"cache flush <prefix> | --all"},
+			summary: "delete cached entries by key prefix",
+			run:     cacheFlush,
+		},
+		{
+			name:    "routes",
+			usage:   []string{"routes list"},
+			summary: "list the API routes and whether their access rows exist",
+			run:     routes,
+		},
+		{
+			name:    "config",
+			usage:   []string{"config check [--offline]"},
+			summary: "validate the configuration and reach the services it names",
+			run:     configCheck,
+		},
+		{
+			name:    "openapi",
+			usage:   []string{"openapi export [file]"},
+			summary: "write the API documentation as JSON",
+			run:     openapiExport,
+		},
+	}
+}
+
 func main() {
 	if _, ok := os.LookupEnv("APP_NAME"); !ok {
 		if err := config.Setup(".env"); err != nil {
@@ -19,32 +108,109 @@ func main() {
 		}
 	}
 
-	db, err := database.NewDatabase()
-	if err != nil {
-		fmt.Println("Could not connect to database", err)
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		help()
+		return
+	}
+
+	cmd, ok := findCommand(os.Args[1])
+	if !ok {
+		fmt.Println("Unknown command", os.Args[1])
+		fmt.Println()
+		help()
 		os.Exit(1)
 	}
-	defer db.Conn.Close()
 
-	if len(os.Args) < 2 {
-		fmt.Println("No command requested. try with: go run cmd/main.go migrate")
+	args := os.Args[2:]
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		usage(cmd)
 		return
 	}
 
-	switch os.Args[1] {
-	case "migrate":
-		migrate(db.Conn)
-	default:
-		fmt.Println("Unknown command. Available commands: migrate")
+	// Scaffolding a migration needs no database.
+	var db *database.Database
+	if cmd.db && !(cmd.name == "migrate" && len(args) == 2 && args[0] == "create") {
+		var err error
+		if db, err = database.NewDatabase(nil); err != nil {
+			fmt.Println("Could not connect to database", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+	}
+	cmd.run(db, args)
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func help() {
+	fmt.Println("Usage: go run cmd/main.go <command> [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
 	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println("Run go run cmd/main.go <command> help for the usage of a command.")
 }
 
-func migrate(db *sql.DB) {
-	fmt.Println("Starting migration...")
-	if err := migration.Migrate(db); err != nil {
-		fmt.Println("Could not migrate database: ", err)
-	} else {
-		fmt.Println("Migrated database successfully")
+// usage prints how to call cmd.
+func usage(cmd command) {
+	for i, line := range cmd.usage {
+		prefix := "Usage: "
+		if i > 0 {
+			prefix = strings.Repeat(" ", len(prefix))
+		}
+		fmt.Println(prefix + "go run cmd/main.go " + line)
 	}
-	fmt.Println("Finish migration...")
+	fmt.Println()
+	fmt.Println(strings.ToUpper(cmd.summary[:1]) + cmd.summary[1:] + ".")
+}
+
+// usageError prints the usage of the named command and exits.
+func usageError(name string) {
+	cmd, _ := findCommand(name)
+	usage(cmd)
+	os.Exit(2)
+}
+
+// fail prints the error and exits.
+func fail(message string, err error) {
+	fmt.Println(message+":", err)
+	os.Exit(1)
+}
+
+// newLogger creates the logger repositories and usecases report errors to.
+// Commands exit without flushing, so their entries are never pushed to Loki.
+func newLogger() *logger.Logger {
+	opts, err := logger.OptionsFromEnv()
+	if err != nil {
+		fail("Invalid log configuration", err)
+	}
+	opts.Loki = logger.LokiConfig{}
+	log, err := logger.Open(opts)
+	if err != nil {
+		fail("Could not open log", err)
+	}
+	_, errorCountMetric, err := telemetry.SetMetric(noop.NewMeterProvider().Meter(""))
+	if err != nil {
+		fail("failed to initialize metrics", err)
+	}
+	log.ErrorCountMetric = errorCountMetric
+	return log
+}
+
+// cliContext carries what repositories and usecases read from a request: a
+// trace id for the logs and the acting user, 0 for the command line.
+func cliContext() context.Context {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "cli")
+	return context.WithValue(ctx, myctx.Key("user_id"), int64(0))
 }
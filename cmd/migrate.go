@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/migration"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func migrate(db *database.Database, args []string) {
+	if len(args) == 2 && args[0] == "create" {
+		migrateCreate(args[1])
+		return
+	}
+
+	// Migrations are embedded in the binary. MIGRATION_DIR reads them from a
+	// directory instead.
+	m := migration.New(db.Conn)
+	if dir := os.Getenv("MIGRATION_DIR"); dir != "" {
+		m.FS = os.DirFS(dir)
+	}
+	if v := os.Getenv("MIGRATION_LOCK_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			fmt.Println("Invalid MIGRATION_LOCK_TIMEOUT", err)
+			os.Exit(1)
+		}
+		m.LockTimeout = timeout
+	}
+
+	// "plan" and --dry-run print the SQL a command would run without running it.
+	var rest []string
+	for _, arg := range args {
+		if arg == "--dry-run" {
+			m.DryRun = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	args = rest
+	if len(args) > 0 && args[0] == "plan" {
+		m.DryRun, args = true, args[1:]
+	}
+	m.Report = func(step migration.Step) {
+		action := "Applying"
+		if step.Down {
+			action = "Rolling back"
+		}
+		fmt.Println(action, step.Filename)
+		if m.DryRun {
+			fmt.Println(strings.TrimSpace(step.SQL()))
+			fmt.Println()
+		}
+	}
+
+	m.Warn = func(msg string) {
+		fmt.Println("Warning:", msg)
+	}
+
+	var err error
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		migrateStatus(m)
+		return
+	case len(args) == 1 && args[0] == "repair":
+		var repaired []string
+		if repaired, err = m.Repair(); err == nil {
+			for _, filename := range repaired {
+				fmt.Println("Repaired checksum of", filename)
+			}
+			fmt.Printf("%d checksum(s) repaired\n", len(repaired))
+		}
+	case len(args) == 0 || len(args) == 1 && args[0] == "up":
+		err = m.Up()
+	case len(args) <= 2 && args[0] == "down":
+		n := 1
+		if len(args) == 2 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				usageError("migrate")
+			}
+		}
+		err = m.Down(n)
+	case len(args) == 2 && args[0] == "to":
+		err = m.To(args[1])
+	case len(args) == 1 && args[0] == "redo":
+		err = m.Redo()
+	default:
+		usageError("migrate")
+	}
+
+	if err != nil {
+		fmt.Println("Could not migrate database: ", err)
+		os.Exit(1)
+	}
+	if m.DryRun {
+		fmt.Println("Dry run: nothing was changed")
+		return
+	}
+	// Statements prepared against the old schema must not be reused.
+	db.InvalidateStatements()
+	fmt.Println("Migrated database successfully")
+}
+
+// migrateCreate scaffolds a migration in MIGRATION_DIR, or in the migration
+// directory of the source tree.
+func migrateCreate(name string) {
+	dir := cmp.Or(os.Getenv("MIGRATION_DIR"), "migration")
+	up, down, err := migration.Create(dir, name)
+	if err != nil {
+		fmt.Println("Could not create migration: ", err)
+		os.Exit(1)
+	}
+	fmt.Println("Created", up)
+	fmt.Println("Created", down)
+}
+
+func migrateStatus(m *migration.Migrator) {
+	list, err := m.Status()
+	if err != nil {
+		fmt.Println("Could not read migration status: ", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tFILE\tSTATE\tAPPLIED AT\tHOST\tDURATION\tCHECKSUM")
+	for _, st := range list {
+		appliedAt, host, duration := "-", "-", "-"
+		if !st.AppliedAt.IsZero() {
+			appliedAt = st.AppliedAt.Format(time.RFC3339)
+		}
+		if st.AppliedBy != "" {
+			host, duration = st.AppliedBy, st.Duration.String()
+		}
+		checksum := shortChecksum(st.Checksum)
+		if st.State == migration.StateModified {
+			checksum += " (recorded " + shortChecksum(st.RecordedChecksum) + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", st.Version, st.Filename, st.State, appliedAt, host, duration, checksum)
+	}
+	w.Flush()
+}
+
+func shortChecksum(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
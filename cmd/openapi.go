@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"rest-skeleton/docs"
+	"rest-skeleton/internal/pkg/database"
+)
+
+// openapiExport writes the Swagger document generated by swag init to a file
+// or to stdout.
+func openapiExport(_ *database.Database, args []string) {
+	if len(args) < 1 || len(args) > 2 || args[0] != "export" {
+		usageError("openapi")
+	}
+
+	var doc bytes.Buffer
+	if err := json.Indent(&doc, []byte(docs.SwaggerInfo.ReadDoc()), "", "    "); err != nil {
+		fail("Invalid API documentation", err)
+	}
+	doc.WriteByte('\n')
+
+	if len(args) == 1 {
+		os.Stdout.Write(doc.Bytes())
+		return
+	}
+	if err := os.WriteFile(args[1], doc.Bytes(), 0644); err != nil {
+		fail("Could not write API documentation", err)
+	}
+	fmt.Println("Wrote", args[1])
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/route"
+	"slices"
+	"text/tabwriter"
+)
+
+// routes lists the API routes. When the database can be reached, private
+// routes without an access row are flagged: nobody can call them.
+func routes(_ *database.Database, args []string) {
+	if len(args) != 1 || args[0] != "list" {
+		usageError("routes")
+	}
+
+	var paths []string
+	db, err := database.NewDatabase(nil)
+	if err != nil {
+		fmt.Println("Database unavailable, access rows are not checked:", err)
+	} else {
+		defer db.Close()
+		log := newLogger()
+		db.Log = log
+		if paths, err = repository.NewAuthRepository(db, log).Paths(cliContext()); err != nil {
+			fail("Could not read access rows", err)
+		}
+	}
+
+	missing := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tAUTH\tACCESS ROW")
+	for _, r := range route.Routes() {
+		auth, access := "public", "-"
+		if r.Private {
+			auth, access = "token", "?"
+			if db != nil {
+				access = "ok"
+				if !slices.Contains(paths, r.AccessPath()) {
+					access = "missing"
+					missing++
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Method, r.Path, auth, access)
+	}
+	w.Flush()
+
+	if missing > 0 {
+		fmt.Printf("\n%d route(s) have no access row: add them to seed/access.sql\n", missing)
+		os.Exit(1)
+	}
+}
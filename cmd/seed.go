@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/migration"
+	"rest-skeleton/internal/pkg/seed"
+	appseed "rest-skeleton/seed"
+	"strings"
+)
+
+// seedDatabase runs the seeders of the environment, which defaults to the one
+// of APP_ENV. --fresh first wipes and migrates the database, and is refused
+// in production.
+func seedDatabase(db *database.Database, args []string) {
+	env := seed.EnvFromAppEnv(os.Getenv("APP_ENV"))
+	fresh := false
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--fresh":
+			fresh = true
+		case args[i] == "--env" && i+1 < len(args):
+			env = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "-"):
+			usageError("seed")
+		default:
+			names = append(names, args[i])
+		}
+	}
+
+	ctx := context.Background()
+	if fresh {
+		if os.Getenv("APP_ENV") == "production" || env == seed.EnvProdBootstrap {
+			fmt.Println("Refusing to wipe a production database")
+			os.Exit(1)
+		}
+		fmt.Println("Wiping database...")
+		if err := seed.Reset(ctx, db.Conn); err != nil {
+			fmt.Println("Could not wipe database: ", err)
+			os.Exit(1)
+		}
+		if err := migration.Migrate(db.Conn); err != nil {
+			fmt.Println("Could not migrate database: ", err)
+			os.Exit(1)
+		}
+		db.InvalidateStatements()
+	}
+
+	seeders, err := appseed.Seeders()
+	if err == nil {
+		err = seed.Run(ctx, db.Conn, seeders, env, names, func(s seed.Seeder) {
+			fmt.Println("Seeding", s.Name)
+		})
+	}
+	if err != nil {
+		fmt.Println("Could not seed database: ", err)
+		os.Exit(1)
+	}
+	fmt.Println("Seeded database for " + env)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/jwttoken"
+	"rest-skeleton/internal/pkg/queue"
+	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// user creates, disables, enables or resets the password of a user through
+// the same usecase as the API, so events, audit logs and cache eviction
+// happen as they would for a request.
+func user(db *database.Database, args []string) {
+	if len(args) < 2 {
+		usageError("user")
+	}
+	ctx := cliContext()
+	uc, closeUC := newUserUC(ctx, db)
+	defer closeUC()
+
+	if args[0] == "create" {
+		createUser(ctx, uc, db, args[1:])
+		return
+	}
+	if len(args) != 2 {
+		usageError("user")
+	}
+
+	target, err := findUser(ctx, uc.Repo, args[1])
+	if err != nil {
+		fail("Could not find user", err)
+	}
+
+	switch args[0] {
+	case "disable", "enable":
+		disabled := args[0] == "disable"
+		if _, err := uc.SetDisabled(ctx, target.ID, disabled); err != nil {
+			fail("Could not "+args[0]+" user", err)
+		}
+		fmt.Printf("User %d %sd\n", target.ID, args[0])
+	case "reset-password":
+		request := dto.PasswordResetRequest{ID: target.ID}
+		request.Password, request.RePassword = readPassword()
+		if err := request.Validate(); err != nil {
+			fail("Invalid password", err)
+		}
+		if _, err := uc.ResetPassword(ctx, request); err != nil {
+			fail("Could not reset password", err)
+		}
+		fmt.Printf("Password of user %d reset\n", target.ID)
+	default:
+		usageError("user")
+	}
+}
+
+func createUser(ctx context.Context, uc usecase.UserUC, db *database.Database, args []string) {
+	request := dto.UserCreateRequest{}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--role" && i+1 < len(args):
+			found, err := repository.NewRoleRepository(db, uc.Log).FindByName(ctx, args[i+1])
+			if err != nil {
+				fail("Could not find role "+args[i+1], err)
+			}
+			request.RoleIDs = append(request.RoleIDs, found.ID)
+			i++
+		case strings.HasPrefix(args[i], "-"):
+			usageError("user")
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 {
+		usageError("user")
+	}
+
+	request.Email, request.Name = positional[0], positional[1]
+	request.Password, request.RePassword = readPassword()
+	if err := request.Validate(); err != nil {
+		fail("Invalid user", err)
+	}
+
+	created, _, err := uc.Create(ctx, request)
+	if err != nil {
+		fail("Could not create user", err)
+	}
+	fmt.Printf("Created user %d %s\n", created.ID, created.Email)
+}
+
+// role grants roles, given by name, to a user or revokes them.
+func role(db *database.Database, args []string) {
+	if len(args) < 3 || (args[0] != "grant" && args[0] != "revoke") {
+		usageError("role")
+	}
+	ctx := cliContext()
+	uc, closeUC := newUserUC(ctx, db)
+	defer closeUC()
+
+	target, err := findUser(ctx, uc.Repo, args[1])
+	if err != nil {
+		fail("Could not find user", err)
+	}
+	roles := repository.NewRoleRepository(db, uc.Log)
+	var roleIDs []int64
+	for _, name := range args[2:] {
+		found, err := roles.FindByName(ctx, name)
+		if err != nil {
+			fail("Could not find role "+name, err)
+		}
+		roleIDs = append(roleIDs, found.ID)
+	}
+
+	done := "granted to"
+	if args[0] == "grant" {
+		_, err = uc.AssignRoles(ctx, target.ID, roleIDs...)
+	} else {
+		_, err = uc.RevokeRoles(ctx, target.ID, roleIDs...)
+		done = "revoked from"
+	}
+	if err != nil {
+		fail("Could not "+args[0]+" roles", err)
+	}
+	fmt.Printf("Roles %s %s user %d\n", strings.Join(args[2:], ", "), done, target.ID)
+}
+
+// token signs an API token for an existing user. It is meant for local
+// debugging and refuses to run in production.
+func token(db *database.Database, args []string) {
+	ttl := time.Hour
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--ttl" && i+1 < len(args):
+			var err error
+			if ttl, err = time.ParseDuration(args[i+1]); err != nil || ttl <= 0 {
+				usageError("token")
+			}
+			i++
+		case strings.HasPrefix(args[i], "-"):
+			usageError("token")
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+	if len(positional) != 2 || positional[0] != "mint" {
+		usageError("token")
+	}
+	if os.Getenv("APP_ENV") == "production" {
+		fmt.Println("Refusing to mint a token in production")
+		os.Exit(1)
+	}
+
+	ctx := cliContext()
+	log := newLogger()
+	db.Log = log
+	if _, err := repository.NewUserRepository(db, log).GetByEmail(ctx, positional[1]); err != nil {
+		fail("Could not find an enabled user "+positional[1], err)
+	}
+
+	signed, err := jwttoken.ClaimTokenFor(positional[1], ttl)
+	if err != nil {
+		fail("Could not sign token", err)
+	}
+	fmt.Println(signed)
+}
+
+// newUserUC builds the user usecase of the API. Without a cache, cached
+// permissions expire on their own; without Redis, no welcome email is queued.
+func newUserUC(ctx context.Context, db *database.Database) (usecase.UserUC, func()) {
+	log := newLogger()
+	db.Log = log
+	uc := usecase.UserUC{
+		Log:    log,
+		Repo:   repository.NewUserRepository(db, log),
+		Outbox: repository.NewOutboxRepository(db, log),
+		Tx:     db,
+		Cache:  cache.Noop{},
+	}
+
+	var closers []func() error
+	if c, err := cache.New(ctx); err != nil {
+		fmt.Println("Cache unavailable, cached permissions expire on their own:", err)
+	} else {
+		uc.Cache = c
+		closers = append(closers, c.Close)
+	}
+	if cfg, err := redis.ConfigFromEnv(); err == nil {
+		if client, err := redis.NewCache(ctx, cfg); err == nil {
+			uc.Jobs = queue.New(client.Client(), cmp.Or(os.Getenv("JOBS_QUEUE"), "default"))
+			closers = append(closers, client.Close)
+		}
+	}
+
+	return uc, func() {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+	}
+}
+
+// findUser finds a user by id or by email. Disabled users are only found by id.
+func findUser(ctx context.Context, repo repository.UserRepository, idOrEmail string) (model.User, error) {
+	if id, err := strconv.ParseInt(idOrEmail, 10, 64); err == nil {
+		return repo.Find(ctx, id)
+	}
+	found, err := repo.GetByEmail(ctx, idOrEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return found, fmt.Errorf("no enabled user has the email %s; use the id of a disabled user", idOrEmail)
+	}
+	return found, err
+}
+
+// readPassword reads a password from stdin so it stays out of the shell
+// history. A terminal is asked for it twice; piped input is read once.
+func readPassword() (password, confirmation string) {
+	stdin := bufio.NewReader(os.Stdin)
+	read := func(prompt string) string {
+		if interactive() {
+			fmt.Print(prompt)
+		}
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			fail("Could not read password", err)
+		}
+		return strings.TrimRight(line, "\r\n")
+	}
+
+	password = read("Password: ")
+	if !interactive() {
+		return password, password
+	}
+	return password, read("Repeat password: ")
+}
+
+func interactive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
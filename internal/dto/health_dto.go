@@ -0,0 +1,8 @@
+package dto
+
+type HealthResponse struct {
+	Status   string `json:"status"`
+	Database string `json:"database"`
+	Leader   string `json:"leader,omitempty"`
+	IsLeader bool   `json:"is_leader"`
+}
@@ -7,10 +7,11 @@ import (
 )
 
 type UserCreateRequest struct {
-	Name       string `json:"name"`
-	Email      string `json:"email"`
-	Password   string `json:"password"`
-	RePassword string `json:"re_password"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	Password   string  `json:"password"`
+	RePassword string  `json:"re_password"`
+	RoleIDs    []int64 `json:"role_ids,omitempty"`
 }
 
 func (u *UserCreateRequest) Validate() error {
@@ -26,35 +27,39 @@ func (u *UserCreateRequest) Validate() error {
 		return errors.New("email harus valid")
 	}
 
-	if len(u.Password) == 0 {
+	return validatePassword(u.Password, u.RePassword)
+}
+
+func validatePassword(password, rePassword string) error {
+	if len(password) == 0 {
 		return errors.New("password is required")
 	}
 
-	if len(u.Password) < 10 {
+	if len(password) < 10 {
 		return errors.New("password minimal 10 character")
 	}
 
-	if match, _ := regexp.MatchString(`[a-z]`, u.Password); !match {
+	if match, _ := regexp.MatchString(`[a-z]`, password); !match {
 		return errors.New("password harus mengandung 1 huruf kecil")
 	}
 
-	if match, _ := regexp.MatchString(`[A-Z]`, u.Password); !match {
+	if match, _ := regexp.MatchString(`[A-Z]`, password); !match {
 		return errors.New("password harus mengandung 1 huruf besar")
 	}
 
-	if match, _ := regexp.MatchString(`[0-9]`, u.Password); !match {
+	if match, _ := regexp.MatchString(`[0-9]`, password); !match {
 		return errors.New("password harus mengandung 1 angka")
 	}
 
-	if match, _ := regexp.MatchString(`[^a-zA-Z0-9]`, u.Password); !match {
+	if match, _ := regexp.MatchString(`[^a-zA-Z0-9]`, password); !match {
 		return errors.New("password harus mengandung 1 karakter khusus")
 	}
 
-	if len(u.RePassword) == 0 {
+	if len(rePassword) == 0 {
 		return errors.New("re_password is required")
 	}
 
-	if u.Password != u.RePassword {
+	if password != rePassword {
 		return errors.New("password and re_password not match")
 	}
 
@@ -93,6 +98,16 @@ func (u *UserUpdateRequest) ToEntity() model.User {
 	}
 }
 
+type PasswordResetRequest struct {
+	ID         int64  `json:"id"`
+	Password   string `json:"password"`
+	RePassword string `json:"re_password"`
+}
+
+func (u *PasswordResetRequest) Validate() error {
+	return validatePassword(u.Password, u.RePassword)
+}
+
 type UserResponse struct {
 	ID    int64  `json:"id"`
 	Name  string `json:"name"`
@@ -0,0 +1,152 @@
+package dto
+
+import (
+	"errors"
+	"net/url"
+	"rest-skeleton/internal/model"
+	"time"
+)
+
+type WebhookRequest struct {
+	ID         int64    `json:"id,omitempty"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+// Validate checks the request. id is the path parameter on update and zero on create.
+func (w *WebhookRequest) Validate(id int64) error {
+	if id != 0 && id != w.ID {
+		return errors.New("id not match with webhook id")
+	}
+
+	if len(w.URL) == 0 {
+		return errors.New("url is required")
+	}
+
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+
+	if len(w.EventTypes) == 0 {
+		return errors.New("event_types is required")
+	}
+
+	for _, eventType := range w.EventTypes {
+		if !model.IsWebhookEvent(eventType) {
+			return errors.New("unknown event type " + eventType)
+		}
+	}
+
+	if len(w.Secret) > 0 && len(w.Secret) < 16 {
+		return errors.New("secret minimal 16 character")
+	}
+
+	return nil
+}
+
+// ToEntity makes a subscription active unless Active is false. Updates keep
+// the stored value when Active is missing.
+func (w *WebhookRequest) ToEntity() model.WebhookSubscription {
+	active := true
+	if w.Active != nil {
+		active = *w.Active
+	}
+	return model.WebhookSubscription{
+		ID:         w.ID,
+		URL:        w.URL,
+		EventTypes: w.EventTypes,
+		Secret:     w.Secret,
+		Active:     active,
+	}
+}
+
+// WebhookResponse describes a subscription. The secret is only returned when
+// the subscription is created.
+type WebhookResponse struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (w *WebhookResponse) FromEntity(subscription model.WebhookSubscription) {
+	w.ID = subscription.ID
+	w.URL = subscription.URL
+	w.EventTypes = subscription.EventTypes
+	w.Active = subscription.Active
+	w.CreatedAt = subscription.CreatedAt
+}
+
+func (w *WebhookResponse) ListFromEntity(subscriptions []model.WebhookSubscription) []WebhookResponse {
+	var list = make([]WebhookResponse, 0)
+	for _, subscription := range subscriptions {
+		var response WebhookResponse
+		response.FromEntity(subscription)
+		list = append(list, response)
+	}
+	return list
+}
+
+type WebhookDeliveryResponse struct {
+	ID             int64                    `json:"id"`
+	SubscriptionID int64                    `json:"subscription_id"`
+	EventID        int64                    `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempts       int                      `json:"attempts"`
+	NextAttemptAt  *time.Time               `json:"next_attempt_at,omitempty"`
+	LastStatusCode int                      `json:"last_status_code,omitempty"`
+	LastError      string                   `json:"last_error,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	DeliveredAt    *time.Time               `json:"delivered_at,omitempty"`
+	Log            []WebhookAttemptResponse `json:"log,omitempty"`
+}
+
+type WebhookAttemptResponse struct {
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (w *WebhookDeliveryResponse) FromEntity(delivery model.WebhookDelivery, attempts ...model.WebhookAttempt) {
+	w.ID = delivery.ID
+	w.SubscriptionID = delivery.SubscriptionID
+	w.EventID = delivery.EventID
+	w.EventType = delivery.EventType
+	w.Status = delivery.Status
+	w.Attempts = delivery.Attempts
+	if delivery.Status == model.DeliveryPending {
+		next := delivery.NextAttemptAt
+		w.NextAttemptAt = &next
+	}
+	w.LastStatusCode = delivery.LastStatusCode
+	w.LastError = delivery.LastError
+	w.CreatedAt = delivery.CreatedAt
+	w.DeliveredAt = delivery.DeliveredAt
+
+	for _, attempt := range attempts {
+		w.Log = append(w.Log, WebhookAttemptResponse{
+			Attempt:    attempt.Attempt,
+			StatusCode: attempt.StatusCode,
+			Error:      attempt.Error,
+			DurationMs: attempt.Duration.Milliseconds(),
+			CreatedAt:  attempt.CreatedAt,
+		})
+	}
+}
+
+func (w *WebhookDeliveryResponse) ListFromEntity(deliveries []model.WebhookDelivery) []WebhookDeliveryResponse {
+	var list = make([]WebhookDeliveryResponse, 0)
+	for _, delivery := range deliveries {
+		var response WebhookDeliveryResponse
+		response.FromEntity(delivery)
+		list = append(list, response)
+	}
+	return list
+}
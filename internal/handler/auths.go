@@ -2,11 +2,12 @@ package handler
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"os"
 	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/repository"
 	"rest-skeleton/internal/usecase"
 
 	"github.com/bytedance/sonic"
@@ -17,7 +18,7 @@ import (
 
 type Auths struct {
 	Log *logger.Logger
-	DB  *sql.DB
+	DB  *database.Database
 }
 
 // @Summary Login
@@ -68,7 +69,7 @@ func (h *Auths) Login(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 		return
 	}
 
-	var authUC = usecase.AuthUC{Log: h.Log, DB: h.DB}
+	var authUC = usecase.AuthUC{Log: h.Log, Repo: repository.NewUserRepository(h.DB, h.Log)}
 	token, statusCode, err := authUC.Login(r.Context(), loginRequest)
 	if err != nil {
 		http.Error(w, "Login failed", statusCode)
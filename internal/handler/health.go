@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/lock"
+	"rest-skeleton/internal/pkg/logger"
+
+	"github.com/bytedance/sonic"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Health handler
+type Health struct {
+	Log     *logger.Logger
+	DB      *sql.DB
+	Elector *lock.Elector
+}
+
+// @Summary Health Check
+// @Description Report database status and the current leader instance
+// @Tags health
+// @Produce  json
+// @Success 200 {object} dto.HealthResponse
+// @Failure 503 {object} dto.HealthResponse
+// @Router /health [get]
+func (h *Health) Check(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx := r.Context()
+	response := dto.HealthResponse{Status: "ok", Database: "ok"}
+	statusCode := http.StatusOK
+
+	if err := database.StatusCheck(ctx, h.DB); err != nil {
+		response.Status = "degraded"
+		response.Database = err.Error()
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	if h.Elector != nil {
+		leader, err := h.Elector.Leader(ctx)
+		if err != nil {
+			leader = "unknown"
+		}
+		response.Leader = leader
+		response.IsLeader = h.Elector.IsLeader()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := sonic.ConfigDefault.NewEncoder(w).Encode(response); err != nil {
+		h.Log.Error(ctx, err)
+	}
+}
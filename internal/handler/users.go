@@ -2,30 +2,24 @@ package handler
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 	"net/http"
 	"os"
 	"rest-skeleton/internal/dto"
-	"rest-skeleton/internal/model"
 	"rest-skeleton/internal/pkg/httpresponse"
 	"rest-skeleton/internal/pkg/logger"
-	"rest-skeleton/internal/pkg/redis"
-	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
 	"strconv"
 
 	"github.com/bytedance/sonic"
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Users handler
 type Users struct {
-	Log   *logger.Logger
-	DB    *sql.DB
-	Cache *redis.Cache
+	Log     *logger.Logger
+	Usecase usecase.UserUsecase
 }
 
 // @Security Bearer
@@ -55,16 +49,13 @@ func (h *Users) List(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}
 
 	span.SetAttributes(attribute.String("search", ps.ByName("search")))
-	var httpres = httpresponse.Response{Cache: h.Cache}
-	var userRepo = repository.UserRepository{Log: h.Log, Db: h.DB}
-	users, err := userRepo.List(ctx, ps.ByName("search"))
+	var httpres = httpresponse.Response{}
+	response, statusCode, err := h.Usecase.List(ctx, ps.ByName("search"))
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, http.StatusText(statusCode), statusCode)
 		return
 	}
 
-	var usersResponse dto.UserResponse
-	response := usersResponse.ListFromEntity(users)
 	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
 }
 
@@ -77,6 +68,7 @@ func (h *Users) List(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 // @Param id path int true "User ID"
 // @Param Authorization header string true "Bearer token"
 // @Success 200 {object} dto.UserResponse
+// @Failure 404 {string} string
 // @Router /users/{id} [get]
 func (h *Users) GetById(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	var ctx = r.Context()
@@ -104,25 +96,14 @@ func (h *Users) GetById(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
-	httpres := httpresponse.Response{Cache: h.Cache}
-	key := fmt.Sprintf("users.%d", id)
-	if cacheValue, isExist := h.Cache.Get(ctx, key); isExist {
-		span.SetAttributes(attribute.String("cache-key", key))
-		httpres.Set(w, http.StatusOK, cacheValue)
-		return
-	}
-
-	var userRepo = repository.UserRepository{Log: h.Log, Db: h.DB}
-	userRepo.UserEntity = model.User{ID: int64(id)}
-	err = userRepo.Find(ctx)
+	httpres := httpresponse.Response{}
+	response, statusCode, err := h.Usecase.Get(ctx, int64(id))
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		http.Error(w, http.StatusText(statusCode), statusCode)
 		return
 	}
 
-	var response dto.UserResponse
-	response.FromEntity(userRepo.UserEntity)
-	httpres.SetMarshal(ctx, w, http.StatusOK, response, key)
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
 }
 
 // @Security Bearer
@@ -135,6 +116,7 @@ func (h *Users) GetById(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 // @Param Idempotency-Key header string true "Idempotency-Key"
 // @Param Authorization header string true "Bearer token"
 // @Success 201 {object} dto.UserResponse
+// @Failure 409 {string} string
 // @Router /users [post]
 func (h *Users) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var ctx = r.Context()
@@ -153,7 +135,7 @@ func (h *Users) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 	default:
 	}
 
-	var httpres = httpresponse.Response{Cache: h.Cache}
+	var httpres = httpresponse.Response{}
 	var userRequest dto.UserCreateRequest
 	defer r.Body.Close()
 	err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&userRequest)
@@ -169,22 +151,16 @@ func (h *Users) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		return
 	}
 
-	var userRepo = repository.UserRepository{Log: h.Log, Db: h.DB}
-	userRepo.UserEntity = userRequest.ToEntity()
-	password, err := bcrypt.GenerateFromPassword([]byte(userRequest.Password), bcrypt.DefaultCost)
+	response, statusCode, err := h.Usecase.Create(ctx, userRequest)
 	if err != nil {
-		h.Log.Error(ctx, err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if statusCode == http.StatusConflict {
+			http.Error(w, err.Error(), statusCode)
+			return
+		}
+		http.Error(w, http.StatusText(statusCode), statusCode)
 		return
 	}
-	userRepo.UserEntity.Password = string(password)
 
-	if err := userRepo.Save(ctx); err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-	var response dto.UserResponse
-	response.FromEntity(userRepo.UserEntity)
 	httpres.SetMarshal(ctx, w, http.StatusCreated, response, "")
 }
 
@@ -226,7 +202,7 @@ func (h *Users) Update(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	var httpres = httpresponse.Response{Cache: h.Cache}
+	var httpres = httpresponse.Response{}
 	var userRequest dto.UserUpdateRequest
 	defer r.Body.Close()
 	err = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&userRequest)
@@ -242,17 +218,13 @@ func (h *Users) Update(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	var userRepo = repository.UserRepository{Log: h.Log, Db: h.DB}
-	userRepo.UserEntity = userRequest.ToEntity()
-	if err := userRepo.Update(ctx); err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	response, statusCode, err := h.Usecase.Update(ctx, userRequest)
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
 		return
 	}
 
-	var response dto.UserResponse
-	response.FromEntity(userRepo.UserEntity)
 	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
-	h.Cache.Del(ctx, fmt.Sprintf("users.%d", id))
 }
 
 // @Security Bearer
@@ -292,13 +264,11 @@ func (h *Users) Delete(w http.ResponseWriter, r *http.Request, ps httprouter.Par
 		return
 	}
 
-	var userRepo = repository.UserRepository{Log: h.Log, Db: h.DB}
-	userRepo.UserEntity = model.User{ID: int64(id)}
-	if err := userRepo.Delete(ctx); err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	statusCode, err := h.Usecase.Delete(ctx, int64(id))
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
-	h.Cache.Del(ctx, fmt.Sprintf("users.%d", id))
+	w.WriteHeader(statusCode)
 }
@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/pkg/httpresponse"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/usecase"
+	"strconv"
+
+	"github.com/bytedance/sonic"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Webhooks handler
+type Webhooks struct {
+	Log     *logger.Logger
+	Usecase usecase.WebhookUsecase
+}
+
+// @Security Bearer
+// @Summary List Webhooks
+// @Description List webhook subscriptions
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} dto.WebhookResponse
+// @Router /webhooks [get]
+func (h *Webhooks) List(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "listWebhookHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	var httpres = httpresponse.Response{}
+	response, statusCode, err := h.Usecase.List(ctx)
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
+}
+
+// @Security Bearer
+// @Summary Get Webhook By ID
+// @Description Get webhook subscription by ID
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} dto.WebhookResponse
+// @Failure 404 {string} string
+// @Router /webhooks/{id} [get]
+func (h *Webhooks) GetById(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "GetWebhookByIdHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	idStr := ps.ByName("id")
+	id, err := strconv.Atoi(idStr)
+	span.SetAttributes(attribute.Int("id", id))
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "please supply a valid id", http.StatusBadRequest)
+		return
+	}
+
+	httpres := httpresponse.Response{}
+	response, statusCode, err := h.Usecase.Get(ctx, int64(id))
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
+}
+
+// @Security Bearer
+// @Summary Create Webhook
+// @Description Subscribe a URL to events. The signing secret is generated when omitted and only returned here.
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param webhook body dto.WebhookRequest true "Subscription to add"
+// @Param Idempotency-Key header string true "Idempotency-Key"
+// @Param Authorization header string true "Bearer token"
+// @Success 201 {object} dto.WebhookResponse
+// @Failure 400 {string} string
+// @Router /webhooks [post]
+func (h *Webhooks) Create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "CreateWebhookHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	var httpres = httpresponse.Response{}
+	var webhookRequest dto.WebhookRequest
+	defer r.Body.Close()
+	err := sonic.ConfigDefault.NewDecoder(r.Body).Decode(&webhookRequest)
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := webhookRequest.Validate(0); err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, statusCode, err := h.Usecase.Create(ctx, webhookRequest)
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusCreated, response, "")
+}
+
+// @Security Bearer
+// @Summary Update Webhook
+// @Description Update webhook subscription. An empty secret keeps the current one.
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param webhook body dto.WebhookRequest true "Subscription to update"
+// @Param Idempotency-Key header string true "Idempotency-Key"
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} dto.WebhookResponse
+// @Failure 404 {string} string
+// @Router /webhooks/{id} [put]
+func (h *Webhooks) Update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "UpdateWebhookHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	idStr := ps.ByName("id")
+	id, err := strconv.Atoi(idStr)
+	span.SetAttributes(attribute.Int("id", id))
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "please supply a valid id", http.StatusBadRequest)
+		return
+	}
+
+	var httpres = httpresponse.Response{}
+	var webhookRequest dto.WebhookRequest
+	defer r.Body.Close()
+	err = sonic.ConfigDefault.NewDecoder(r.Body).Decode(&webhookRequest)
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := webhookRequest.Validate(int64(id)); err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, statusCode, err := h.Usecase.Update(ctx, webhookRequest)
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
+}
+
+// @Security Bearer
+// @Summary Delete Webhook By ID
+// @Description Delete webhook subscription and cancel its pending deliveries
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Webhook ID"
+// @Param Idempotency-Key header string true "Idempotency-Key"
+// @Param Authorization header string true "Bearer token"
+// @Success 204
+// @Failure 404 {string} string
+// @Router /webhooks/{id} [delete]
+func (h *Webhooks) Delete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "DeleteWebhookHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	idStr := ps.ByName("id")
+	id, err := strconv.Atoi(idStr)
+	span.SetAttributes(attribute.Int("id", id))
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "please supply a valid id", http.StatusBadRequest)
+		return
+	}
+
+	statusCode, err := h.Usecase.Delete(ctx, int64(id))
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+}
+
+// @Security Bearer
+// @Summary List Webhook Deliveries
+// @Description List webhook deliveries, newest first. Use status=dead for the dead-letter list.
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param subscription_id query int false "Webhook ID"
+// @Param status query string false "pending, succeeded, dead or cancelled"
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {array} dto.WebhookDeliveryResponse
+// @Failure 400 {string} string
+// @Router /webhook-deliveries [get]
+func (h *Webhooks) Deliveries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "listWebhookDeliveryHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	var subscriptionID int64
+	if value := r.URL.Query().Get("subscription_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			h.Log.Error(ctx, err)
+			http.Error(w, "please supply a valid subscription_id", http.StatusBadRequest)
+			return
+		}
+		subscriptionID = id
+	}
+	status := r.URL.Query().Get("status")
+	span.SetAttributes(attribute.Int64("subscription_id", subscriptionID), attribute.String("status", status))
+
+	var httpres = httpresponse.Response{}
+	response, statusCode, err := h.Usecase.Deliveries(ctx, subscriptionID, status)
+	if err != nil {
+		if statusCode == http.StatusBadRequest {
+			http.Error(w, err.Error(), statusCode)
+			return
+		}
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
+}
+
+// @Security Bearer
+// @Summary Get Webhook Delivery
+// @Description Get webhook delivery with its attempt log
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Delivery ID"
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} dto.WebhookDeliveryResponse
+// @Failure 404 {string} string
+// @Router /webhook-deliveries/{id} [get]
+func (h *Webhooks) Delivery(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "GetWebhookDeliveryHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	idStr := ps.ByName("id")
+	id, err := strconv.Atoi(idStr)
+	span.SetAttributes(attribute.Int("id", id))
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "please supply a valid id", http.StatusBadRequest)
+		return
+	}
+
+	httpres := httpresponse.Response{}
+	response, statusCode, err := h.Usecase.Delivery(ctx, int64(id))
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	httpres.SetMarshal(ctx, w, http.StatusOK, response, "")
+}
+
+// @Security Bearer
+// @Summary Redeliver Webhook Delivery
+// @Description Queue the delivery for an immediate new attempt
+// @Tags Webhooks
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Delivery ID"
+// @Param Idempotency-Key header string true "Idempotency-Key"
+// @Param Authorization header string true "Bearer token"
+// @Success 202
+// @Failure 404 {string} string
+// @Router /webhook-deliveries/{id}/redeliver [post]
+func (h *Webhooks) Redeliver(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var ctx = r.Context()
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "RedeliverWebhookHandler")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		h.Log.Error(ctx, context.Canceled)
+		http.Error(w, "Request is canceled", http.StatusExpectationFailed)
+		return
+	case context.DeadlineExceeded:
+		h.Log.Error(ctx, context.DeadlineExceeded)
+		http.Error(w, "Deadline is exceeded", http.StatusExpectationFailed)
+		return
+	default:
+	}
+
+	idStr := ps.ByName("id")
+	id, err := strconv.Atoi(idStr)
+	span.SetAttributes(attribute.Int("id", id))
+	if err != nil {
+		h.Log.Error(ctx, err)
+		http.Error(w, "please supply a valid id", http.StatusBadRequest)
+		return
+	}
+
+	statusCode, err := h.Usecase.Redeliver(ctx, int64(id))
+	if err != nil {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+}
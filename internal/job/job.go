@@ -0,0 +1,47 @@
+// Package job defines the background jobs of the application and their handlers.
+package job
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"os"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/mailer"
+	"rest-skeleton/internal/pkg/queue"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// MailTemplates are the email templates of the application, one directory
+// per locale.
+func MailTemplates(defaultLocale string) *mailer.Templates {
+	sub, _ := fs.Sub(templateFS, "templates")
+	return mailer.NewTemplates(sub, defaultLocale)
+}
+
+// WelcomeUser greets a newly created user.
+var WelcomeUser = queue.Task[model.UserEvent]{Type: "user.welcome"}
+
+// Register adds the handlers of every job to w. Jobs already run with
+// retries, so they send mail with m directly rather than queueing it again.
+func Register(w *queue.Worker, m mailer.Mailer, templates *mailer.Templates) {
+	WelcomeUser.Register(w, func(ctx context.Context, user model.UserEvent) error {
+		msg, err := templates.Render("welcome", "", map[string]any{
+			"AppName": os.Getenv("APP_NAME"),
+			"Name":    user.Name,
+			"Email":   user.Email,
+		})
+		if err != nil {
+			return queue.Permanent(err)
+		}
+		msg.To = []string{user.Email}
+
+		err = m.Send(ctx, msg)
+		if mailer.Rejected(err) {
+			return queue.Permanent(err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,107 @@
+// Package maintenance defines the recurring housekeeping tasks run by the scheduler.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/lock"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/scheduler"
+	"rest-skeleton/internal/repository"
+	"time"
+)
+
+// Config holds what the tasks work on.
+type Config struct {
+	DB    *database.Database
+	Log   *logger.Logger
+	Cache cache.Cache
+
+	// UserRetention is how long soft-deleted users are kept.
+	UserRetention time.Duration
+}
+
+// ConfigFromEnv reads USER_RETENTION. The retention of log files is read by
+// the logger.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{UserRetention: 30 * 24 * time.Hour}
+	if v := os.Getenv("USER_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid USER_RETENTION: %w", err)
+		}
+		cfg.UserRetention = d
+	}
+	return cfg, nil
+}
+
+// Tasks returns every maintenance task.
+func Tasks(cfg Config) []scheduler.Task {
+	return []scheduler.Task{
+		{
+			Name:        "purge-idempotency-keys",
+			Description: "Drop expired Idempotency-Key responses from in-process caches",
+			Schedule:    "*/10 * * * *",
+			Jitter:      time.Minute,
+			Timeout:     time.Minute,
+			PerInstance: true,
+			Run:         cfg.purgeIdempotencyKeys,
+		},
+		{
+			Name:        "purge-deleted-users",
+			Description: "Permanently remove users soft-deleted longer than USER_RETENTION",
+			Schedule:    "30 3 * * *",
+			Jitter:      10 * time.Minute,
+			Timeout:     30 * time.Minute,
+			Run:         cfg.purgeDeletedUsers,
+		},
+		{
+			Name:        "rotate-logs",
+			Description: "Start the log file of the new day and remove rotated files past LOG_MAX_AGE or LOG_MAX_FILES",
+			Schedule:    "0 0 * * *",
+			Timeout:     5 * time.Minute,
+			PerInstance: true,
+			Run:         func(context.Context) error { return cfg.Log.Rotate() },
+		},
+	}
+}
+
+func (cfg Config) purgeIdempotencyKeys(ctx context.Context) error {
+	purger, ok := cfg.Cache.(cache.Purger)
+	if !ok {
+		return nil
+	}
+	if n := purger.PurgeExpired(cache.IdempotencyPrefix); n > 0 {
+		cfg.Log.Info(ctx, fmt.Sprintf("purged %d expired idempotency keys", n))
+	}
+	return nil
+}
+
+func (cfg Config) purgeDeletedUsers(ctx context.Context) error {
+	repo := repository.NewUserRepository(cfg.DB, cfg.Log)
+	n, err := repo.PurgeDeleted(ctx, time.Now().Add(-cfg.UserRetention))
+	if err != nil {
+		return err
+	}
+	cfg.Log.Info(ctx, fmt.Sprintf("purged %d users deleted more than %s ago", n, cfg.UserRetention))
+	return nil
+}
+
+// Schedulers splits the tasks into one scheduler to run on the leader and one
+// to run on every instance.
+func Schedulers(cfg Config, locker *lock.Locker) (shared, local *scheduler.Scheduler, err error) {
+	shared, local = scheduler.New(cfg.Log, locker), scheduler.New(cfg.Log, nil)
+	for _, task := range Tasks(cfg) {
+		target := shared
+		if task.PerInstance {
+			target = local
+		}
+		if err := target.Add(task); err != nil {
+			return nil, nil, err
+		}
+	}
+	return shared, local, nil
+}
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+	AccessLogOff      = "off"
+)
+
+// AccessLogConfig configures the line recorded for every request.
+type AccessLogConfig struct {
+	// Format is json, written through the logger, combined, the Apache
+	// combined log format, or off.
+	Format string
+	// SampleRate is the share of successful requests recorded. Responses with
+	// a status of 400 or more and slow requests are always recorded.
+	SampleRate float64
+	Slow       time.Duration
+	// TrustedProxies may set X-Forwarded-For. The client is the address
+	// closest to the server that is not a trusted proxy.
+	TrustedProxies []netip.Prefix
+}
+
+// AccessLogConfigFromEnv reads ACCESS_LOG_FORMAT, ACCESS_LOG_SAMPLE_RATE,
+// ACCESS_LOG_SLOW and ACCESS_LOG_TRUSTED_PROXIES, a comma separated list of
+// addresses and CIDR ranges.
+func AccessLogConfigFromEnv() (AccessLogConfig, error) {
+	cfg := AccessLogConfig{Format: cmp.Or(os.Getenv("ACCESS_LOG_FORMAT"), AccessLogJSON), SampleRate: 1, Slow: time.Second}
+	if cfg.Format != AccessLogJSON && cfg.Format != AccessLogCombined && cfg.Format != AccessLogOff {
+		return cfg, fmt.Errorf("invalid ACCESS_LOG_FORMAT %q, want json, combined or off", cfg.Format)
+	}
+	if v := os.Getenv("ACCESS_LOG_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cfg, fmt.Errorf("ACCESS_LOG_SAMPLE_RATE must be between 0 and 1, got %q", v)
+		}
+		cfg.SampleRate = rate
+	}
+	if v := os.Getenv("ACCESS_LOG_SLOW"); v != "" {
+		slow, err := time.ParseDuration(v)
+		if err != nil || slow < 0 {
+			return cfg, fmt.Errorf("invalid ACCESS_LOG_SLOW %q", v)
+		}
+		cfg.Slow = slow
+	}
+	for _, v := range strings.Split(os.Getenv("ACCESS_LOG_TRUSTED_PROXIES"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return cfg, fmt.Errorf("invalid ACCESS_LOG_TRUSTED_PROXIES entry %q", v)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix.Masked())
+	}
+	return cfg, nil
+}
+
+// AccessLog records requests in the configured format.
+type AccessLog struct {
+	AccessLogConfig
+	Log *logger.Logger
+	// Writer receives the combined lines.
+	Writer io.Writer
+
+	file   *logger.RotatingFile
+	sample func() float64
+}
+
+// NewAccessLog records json lines through log. Combined lines are written to
+// rotating access-<date>.log files, configured like those of the logger, in
+// production and to stdout otherwise.
+func NewAccessLog(cfg AccessLogConfig, log *logger.Logger) (*AccessLog, error) {
+	a := &AccessLog{AccessLogConfig: cfg, Log: log, Writer: os.Stdout, sample: rand.Float64}
+	if cfg.Format == AccessLogCombined && os.Getenv("APP_ENV") == "production" {
+		fileCfg, err := logger.RotateConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		fileCfg.Prefix = "access"
+		if a.file, err = logger.OpenRotating(fileCfg); err != nil {
+			return nil, err
+		}
+		a.Writer = a.file
+	}
+	return a, nil
+}
+
+// Reopen reopens the access log file by name after it was moved away.
+func (a *AccessLog) Reopen() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Reopen()
+}
+
+func (a *AccessLog) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// accessEntry collects what handlers further down the chain learn about a
+// request, such as the authenticated user.
+type accessEntry struct {
+	userID int64
+}
+
+const accessEntryKey = myctx.Key("access_log")
+
+// recordAccessUser sets the user of the access log line of the request.
+func recordAccessUser(ctx context.Context, userID int64) {
+	if entry, ok := ctx.Value(accessEntryKey).(*accessEntry); ok {
+		entry.userID = userID
+	}
+}
+
+// accessWriter counts the status and size of a response.
+type accessWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *accessWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *accessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog records a line per request. It goes right after
+// TraceAndMetricLatency, so the line carries the trace id.
+func (m *Middleware) AccessLog(next httprouter.Handle) httprouter.Handle {
+	if m.Access == nil || m.Access.Format == AccessLogOff {
+		return next
+	}
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		entry := &accessEntry{}
+		aw := &accessWriter{ResponseWriter: w, status: http.StatusOK}
+		next(aw, r.WithContext(context.WithValue(r.Context(), accessEntryKey, entry)), ps)
+		m.Access.record(r, aw.status, aw.bytes, time.Since(start), entry.userID)
+	})
+}
+
+func (a *AccessLog) record(r *http.Request, status int, bytes int64, elapsed time.Duration, userID int64) {
+	slow := a.Slow > 0 && elapsed >= a.Slow
+	if status < 400 && !slow && a.SampleRate < 1 && a.sample() >= a.SampleRate {
+		return
+	}
+
+	if a.Format == AccessLogCombined {
+		a.Writer.Write([]byte(a.combined(r, status, bytes, userID, time.Now())))
+		return
+	}
+
+	ctx := r.Context()
+	if userID != 0 {
+		ctx = context.WithValue(ctx, myctx.Key("user_id"), userID)
+	}
+	args := []any{
+		"method", r.Method,
+		"status", status,
+		"bytes", bytes,
+		"duration_ms", elapsed.Milliseconds(),
+		"client_ip", a.clientIP(r),
+		"user_agent", r.UserAgent(),
+	}
+	if slow {
+		args = append(args, "slow", true)
+	}
+	if status >= 500 || slow {
+		a.Log.Warn(ctx, "access", args...)
+		return
+	}
+	a.Log.Info(ctx, "access", args...)
+}
+
+// combined formats a line of the Apache combined log format, with the user
+// id as the remote user.
+func (a *AccessLog) combined(r *http.Request, status int, bytes int64, userID int64, at time.Time) string {
+	user, size := "-", "-"
+	if userID != 0 {
+		user = strconv.FormatInt(userID, 10)
+	}
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		a.clientIP(r), user, at.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, quoteless(r.URL.RequestURI()), r.Proto, status, size,
+		quoteless(cmp.Or(r.Referer(), "-")), quoteless(cmp.Or(r.UserAgent(), "-")))
+}
+
+// quoteless escapes the quotes and backslashes of a quoted field.
+func quoteless(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// clientIP is the remote address, or when it is a trusted proxy, the
+// nearest address of X-Forwarded-For that is not.
+func (a *AccessLog) clientIP(r *http.Request) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if !a.trusted(client) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		client = hop
+		if !a.trusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func (a *AccessLog) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func newTestAccessLog(cfg AccessLogConfig) (*Middleware, *bytes.Buffer) {
+	var buf bytes.Buffer
+	log := logger.NewWriter(&buf, logger.Options{Level: slog.LevelInfo, Format: logger.FormatJSON})
+	access := &AccessLog{AccessLogConfig: cfg, Log: log, Writer: &buf, sample: func() float64 { return 0.5 }}
+	return &Middleware{Log: log, Access: access}, &buf
+}
+
+func serve(m *Middleware, handle httprouter.Handle, r *http.Request) {
+	m.AccessLog(handle)(httptest.NewRecorder(), r, nil)
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	m, buf := newTestAccessLog(AccessLogConfig{Format: AccessLogJSON, SampleRate: 1})
+
+	r := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	r.Header.Set("User-Agent", "curl/8.0")
+	ctx := context.WithValue(r.Context(), myctx.Key("traceID"), "abc123")
+	ctx = context.WithValue(ctx, myctx.Key("route"), "GET /users/:id")
+	serve(m, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		recordAccessUser(r.Context(), 7)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}, r.WithContext(ctx))
+
+	entry := map[string]any{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid entry %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"message":    "access",
+		"level":      "INFO",
+		"method":     "GET",
+		"route":      "GET /users/:id",
+		"status":     float64(201),
+		"bytes":      float64(5),
+		"client_ip":  "192.0.2.1",
+		"user_id":    float64(7),
+		"trace_id":   "abc123",
+		"user_agent": "curl/8.0",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Errorf("expected a duration in %v", entry)
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	m, _ := newTestAccessLog(AccessLogConfig{Format: AccessLogCombined, SampleRate: 1})
+
+	r := httptest.NewRequest(http.MethodPost, "/users?x=1", nil)
+	r.Header.Set("User-Agent", `agent "quoted"`)
+	at := time.Date(2026, 10, 19, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+
+	got := m.Access.combined(r, http.StatusCreated, 42, 7, at)
+	want := `192.0.2.1 - 7 [19/Oct/2026:13:55:36 -0700] "POST /users?x=1 HTTP/1.1" 201 42 "-" "agent \"quoted\""` + "\n"
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	m, buf := newTestAccessLog(AccessLogConfig{Format: AccessLogCombined, SampleRate: 0.1, Slow: 20 * time.Millisecond})
+
+	status := func(code int) httprouter.Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) { w.WriteHeader(code) }
+	}
+	serve(m, status(http.StatusOK), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	serve(m, status(http.StatusNotFound), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	serve(m, status(http.StatusInternalServerError), httptest.NewRequest(http.MethodGet, "/error", nil))
+	serve(m, func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		time.Sleep(30 * time.Millisecond)
+	}, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	out := buf.String()
+	if strings.Contains(out, "/ok") {
+		t.Errorf("expected the successful request to be sampled out, got %s", out)
+	}
+	for _, path := range []string{"/missing", "/error", "/slow"} {
+		if !strings.Contains(out, path) {
+			t.Errorf("expected %s to always be logged, got %s", path, out)
+		}
+	}
+}
+
+func TestAccessLogClientIP(t *testing.T) {
+	a := &AccessLog{AccessLogConfig: AccessLogConfig{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("127.0.0.1/32"),
+	}}}
+
+	cases := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"untrusted remote ignores the header", "203.0.113.9:4000", "198.51.100.1", "203.0.113.9"},
+		{"trusted remote uses the header", "10.0.0.2:4000", "198.51.100.1", "198.51.100.1"},
+		{"skips trusted hops", "127.0.0.1:4000", "198.51.100.1, 203.0.113.5, 10.1.1.1", "203.0.113.5"},
+		{"all hops trusted", "10.0.0.2:4000", "10.0.0.3", "10.0.0.3"},
+		{"stops at a malformed hop", "10.0.0.2:4000", "198.51.100.1, unknown, 10.0.0.3", "10.0.0.3"},
+		{"no header", "10.0.0.2:4000", "", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := a.clientIP(r); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestAccessLogConfigFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_LOG_FORMAT", "combined")
+	t.Setenv("ACCESS_LOG_SAMPLE_RATE", "0.25")
+	t.Setenv("ACCESS_LOG_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10")
+	cfg, err := AccessLogConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Format != AccessLogCombined || cfg.SampleRate != 0.25 || len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1].Bits() != 32 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("ACCESS_LOG_SAMPLE_RATE", "2")
+	if _, err := AccessLogConfigFromEnv(); err == nil {
+		t.Error("expected an error for a rate above 1")
+	}
+}
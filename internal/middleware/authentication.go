@@ -5,7 +5,6 @@ import (
 	"context"
 	"database/sql"
 	"net/http"
-	"rest-skeleton/internal/model"
 	"rest-skeleton/internal/pkg/jwttoken"
 	"rest-skeleton/internal/pkg/myctx"
 	"rest-skeleton/internal/repository"
@@ -34,8 +33,8 @@ func (m *Middleware) Authentication(next httprouter.Handle) httprouter.Handle {
 			return
 		}
 
-		userRepo := repository.UserRepository{Log: m.Log, Db: m.DB, UserEntity: model.User{Email: email}}
-		if err := userRepo.GetByEmail(r.Context()); err != nil && err != sql.ErrNoRows {
+		user, err := repository.NewUserRepository(m.DB, m.Log).GetByEmail(r.Context(), email)
+		if err != nil && err != sql.ErrNoRows {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		} else if err == sql.ErrNoRows {
@@ -43,8 +42,9 @@ func (m *Middleware) Authentication(next httprouter.Handle) httprouter.Handle {
 			return
 		}
 
+		recordAccessUser(r.Context(), user.ID)
 		ctx := context.WithValue(r.Context(), myctx.Key("email"), email)
-		ctx = context.WithValue(ctx, myctx.Key("user_id"), userRepo.UserEntity.ID)
+		ctx = context.WithValue(ctx, myctx.Key("user_id"), user.ID)
 		r = r.WithContext(ctx)
 
 		next(w, r, ps)
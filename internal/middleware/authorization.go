@@ -4,10 +4,13 @@ package middleware
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
+	"rest-skeleton/internal/pkg/cache"
 	"rest-skeleton/internal/pkg/myctx"
 	"rest-skeleton/internal/repository"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -21,15 +24,24 @@ func (m *Middleware) Authorization(next httprouter.Handle) httprouter.Handle {
 		ctx := context.WithValue(r.Context(), myctx.Key("path"), path)
 		r = r.WithContext(ctx)
 
-		authRepository := repository.AuthRepository{Db: m.DB, Log: m.Log}
-		hasAuth, err := authRepository.HasAuth(r.Context(), r.Method+" "+path)
-		if err != nil && err != sql.ErrNoRows {
+		userID, _ := ctx.Value(myctx.Key("user_id")).(int64)
+		key := fmt.Sprintf("permissions.%d.%s %s", userID, r.Method, path)
+		opts := cache.FetchOptions{TTL: 5 * time.Minute, Tags: []string{cache.UserTag(userID)}, Log: m.Log}
+		hasAuth, err := cache.Fetch(ctx, m.Cache, key, opts, func(ctx context.Context) (bool, error) {
+			hasAuth, err := repository.NewAuthRepository(m.DB, m.Log).HasAuth(ctx, r.Method+" "+path)
+			if err == sql.ErrNoRows {
+				return false, nil
+			}
+			return hasAuth, err
+		})
+		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
+		// The user is authenticated but none of their roles grants the path.
 		if !hasAuth {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"net/http"
+	"rest-skeleton/internal/pkg/cache"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -23,19 +24,18 @@ func (m *Middleware) Idempotency(next httprouter.Handle) httprouter.Handle {
 
 		// Cek apakah kunci sudah ada di Redis
 		ctx := r.Context()
-		if cacheValue, isExist := m.Cache.Get(ctx, idempotencyKey); isExist {
+		key := cache.IdempotencyPrefix + idempotencyKey
+		if cacheValue, isExist := m.Cache.Get(ctx, key); isExist {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(cacheValue.(string)))
+			w.Write(cacheValue)
 			return
 		}
 
 		rw := &responseRecorder{ResponseWriter: w, body: new(bytes.Buffer)}
 		next(rw, r, ps)
 
-		m.Cache.SetTTL(10 * time.Minute)
-		m.Cache.Add(ctx, idempotencyKey, rw.body.String())
-		m.Cache.ResetTTL()
+		m.Cache.Set(ctx, key, rw.body.Bytes(), 10*time.Minute)
 	})
 }
 
@@ -1,9 +1,9 @@
 package middleware
 
 import (
-	"database/sql"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/logger"
-	"rest-skeleton/internal/pkg/redis"
 
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/metric"
@@ -11,9 +11,11 @@ import (
 
 type Middleware struct {
 	Log           *logger.Logger
-	DB            *sql.DB
-	Cache         *redis.Cache
+	DB            *database.Database
+	Cache         cache.Cache
 	LatencyMetric metric.Int64Histogram
+	// Access records a line per request; nil records none.
+	Access *AccessLog
 }
 
 func (m *Middleware) WrapMiddleware(mw []func(httprouter.Handle) httprouter.Handle, handler httprouter.Handle) httprouter.Handle {
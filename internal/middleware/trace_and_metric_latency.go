@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/myctx"
 	"time"
 
@@ -32,6 +33,7 @@ func (m *Middleware) TraceAndMetricLatency(next httprouter.Handle) httprouter.Ha
 
 		traceID := span.SpanContext().TraceID().String()
 		ctx = context.WithValue(ctx, myctx.Key("traceID"), traceID)
+		ctx = database.WithPinning(ctx)
 
 		rw := &responseWriter{w, http.StatusOK}
 		next(rw, r.WithContext(ctx), ps)
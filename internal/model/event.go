@@ -0,0 +1,42 @@
+package model
+
+// Domain events recorded in the outbox when users change.
+const (
+	EventUserCreated  = "UserCreated"
+	EventUserUpdated  = "UserUpdated"
+	EventUserDeleted  = "UserDeleted"
+	EventUserDisabled = "UserDisabled"
+	EventUserEnabled  = "UserEnabled"
+	EventRoleAssigned = "RoleAssigned"
+	EventRoleRevoked  = "RoleRevoked"
+
+	AggregateUser = "user"
+)
+
+// UserEvent is the payload of the user lifecycle events.
+type UserEvent struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// RoleAssignedEvent is the payload of EventRoleAssigned.
+type RoleAssignedEvent struct {
+	UserID  int64   `json:"user_id"`
+	RoleIDs []int64 `json:"role_ids"`
+}
+
+// RoleRevokedEvent is the payload of EventRoleRevoked.
+type RoleRevokedEvent struct {
+	UserID  int64   `json:"user_id"`
+	RoleIDs []int64 `json:"role_ids"`
+}
+
+// IsWebhookEvent reports whether eventType can be subscribed to. "*" matches every event.
+func IsWebhookEvent(eventType string) bool {
+	switch eventType {
+	case "*", EventUserCreated, EventUserUpdated, EventUserDeleted, EventUserDisabled, EventUserEnabled, EventRoleAssigned, EventRoleRevoked:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,6 @@
+package model
+
+type Role struct {
+	ID   int64
+	Name string
+}
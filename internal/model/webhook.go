@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// Webhook delivery states. A pending delivery is retried until it succeeds or
+// runs out of attempts and becomes dead.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+	DeliveryCancelled = "cancelled"
+)
+
+// WebhookSubscription asks for events of EventTypes to be posted to URL.
+// "*" subscribes to every event.
+type WebhookSubscription struct {
+	ID         int64
+	URL        string
+	EventTypes []string
+	Secret     string
+	Active     bool
+	CreatedAt  time.Time
+}
+
+// WebhookDelivery is one event queued for one subscription. URL and Secret
+// are copied from the subscription when the delivery is claimed.
+type WebhookDelivery struct {
+	ID             int64
+	SubscriptionID int64
+	EventID        int64
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+
+	URL    string
+	Secret string
+}
+
+// WebhookAttempt is one entry of the delivery log.
+type WebhookAttempt struct {
+	DeliveryID int64
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
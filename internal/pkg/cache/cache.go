@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"rest-skeleton/internal/pkg/redis"
+
+	"github.com/bytedance/sonic"
+)
+
+// Cache is the storage contract used by handlers, middleware and responses.
+// A ttl of zero means the implementation's default ttl.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Exists(ctx context.Context, key string) bool
+	Del(ctx context.Context, keys ...string) error
+	DeleteByPrefix(ctx context.Context, prefix string) error
+	// Tag records key under tags so InvalidateTags can evict it later.
+	Tag(ctx context.Context, key string, tags ...string) error
+	InvalidateTags(ctx context.Context, tags ...string) error
+	Close() error
+}
+
+// Purger is implemented by caches that keep expired entries until they are
+// read. Redis expires keys by itself and does not need it.
+type Purger interface {
+	// PurgeExpired drops the expired entries whose key starts with prefix and
+	// returns how many it dropped.
+	PurgeExpired(prefix string) int
+}
+
+const defaultTTL = 24 * time.Hour
+
+// New creates the cache selected by CACHE_DRIVER (redis, memory, tiered or noop).
+// Redis is used when the variable is empty.
+func New(ctx context.Context) (Cache, error) {
+	switch os.Getenv("CACHE_DRIVER") {
+	case "", "redis":
+		cfg, err := redis.ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		c, err := redis.NewCache(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "memory":
+		size := 10000
+		if v := os.Getenv("CACHE_MEMORY_SIZE"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CACHE_MEMORY_SIZE: %w", err)
+			}
+			size = n
+		}
+		return NewMemory(size, defaultTTL), nil
+	case "tiered":
+		cfg, err := redis.ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		l2, err := redis.NewCache(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		l1TTL := time.Minute
+		if v := os.Getenv("CACHE_L1_TTL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CACHE_L1_TTL: %w", err)
+			}
+			l1TTL = d
+		}
+		return NewTiered(ctx, NewMemory(10000, l1TTL), l2), nil
+	case "noop":
+		return Noop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache driver %q", os.Getenv("CACHE_DRIVER"))
+	}
+}
+
+// GetTyped reads key and decodes the stored JSON into T.
+func GetTyped[T any](ctx context.Context, c Cache, key string) (T, bool, error) {
+	var value T
+	data, ok := c.Get(ctx, key)
+	if !ok {
+		return value, false, nil
+	}
+	if err := sonic.Unmarshal(data, &value); err != nil {
+		return value, false, fmt.Errorf("could not decode cache key %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// SetTyped encodes value as JSON and stores it under key.
+func SetTyped[T any](ctx context.Context, c Cache, key string, value T, ttl time.Duration) error {
+	data, err := sonic.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not encode cache key %s: %w", key, err)
+	}
+	return c.Set(ctx, key, data, ttl)
+}
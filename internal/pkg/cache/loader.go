@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"rest-skeleton/internal/pkg/logger"
+
+	"github.com/bytedance/sonic"
+)
+
+// FetchOptions controls how Fetch stores a loaded value.
+type FetchOptions struct {
+	// TTL is how long the value is served as fresh. Zero uses the cache default.
+	TTL time.Duration
+	// Stale is how long after TTL the old value is still served while it is refreshed in the background.
+	Stale time.Duration
+	// Tags are recorded for the key so InvalidateTags can evict it.
+	Tags []string
+	// Log receives the errors of storing the value, which never fail the fetch. Nil discards them.
+	Log *logger.Logger
+}
+
+// Fetch reads key through the cache. On a miss, load is called once per key
+// no matter how many requests are waiting for it. A value past its TTL but
+// within its stale window is returned immediately and refreshed in the background.
+func Fetch[T any](ctx context.Context, c Cache, key string, opts FetchOptions, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+
+	if data, ok := c.Get(ctx, key); ok {
+		freshUntil, payload, err := unwrap(data)
+		if err == nil && sonic.Unmarshal(payload, &value) == nil {
+			if time.Now().After(freshUntil) {
+				go flights.do("refresh:"+key, func() ([]byte, error) {
+					return fill(context.WithoutCancel(ctx), c, key, opts, load)
+				})
+			}
+			return value, nil
+		}
+	}
+
+	data, err := flights.do(key, func() ([]byte, error) {
+		return fill(ctx, c, key, opts, load)
+	})
+	if err != nil {
+		return value, err
+	}
+
+	if err := sonic.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("could not decode cache key %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func fill[T any](ctx context.Context, c Cache, key string, opts FetchOptions, load func(ctx context.Context) (T, error)) ([]byte, error) {
+	value, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := sonic.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode cache key %s: %w", key, err)
+	}
+
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	// Tag first so a stored key is always reachable by InvalidateTags.
+	if err := c.Tag(ctx, key, opts.Tags...); err != nil {
+		opts.warn(ctx, key, err)
+		return payload, nil
+	}
+	if err := c.Set(ctx, key, wrap(time.Now().Add(ttl), payload), ttl+opts.Stale); err != nil {
+		opts.warn(ctx, key, err)
+	}
+
+	return payload, nil
+}
+
+func (opts FetchOptions) warn(ctx context.Context, key string, err error) {
+	if opts.Log != nil {
+		opts.Log.Warn(ctx, fmt.Sprintf("could not cache key %s: %v", key, err), "key", key)
+	}
+}
+
+// wrap prefixes payload with the unix nano time until which it is fresh.
+func wrap(freshUntil time.Time, payload []byte) []byte {
+	data := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint64(data, uint64(freshUntil.UnixNano()))
+	copy(data[8:], payload)
+	return data
+}
+
+func unwrap(data []byte) (time.Time, []byte, error) {
+	if len(data) < 8 {
+		return time.Time{}, nil, fmt.Errorf("cache entry too short")
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data))), data[8:], nil
+}
+
+// flightGroup coalesces concurrent calls for the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+var flights = &flightGroup{calls: make(map[string]*flightCall)}
+
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.data, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.data, call.err = fn()
+	return call.data, call.err
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rest-skeleton/internal/pkg/logger"
+
+	"github.com/bytedance/sonic"
+)
+
+func TestFetchCoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(10, time.Minute)
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "John", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := Fetch(ctx, c, "users.1", FetchOptions{}, load)
+			if err != nil || v != "John" {
+				t.Errorf("got %q, %v", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("expected 1 load, got %d", n)
+	}
+}
+
+func TestFetchServesStaleWhileRevalidating(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(10, time.Minute)
+
+	var version int32
+	load := func(ctx context.Context) (int32, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}
+
+	opts := FetchOptions{TTL: 10 * time.Millisecond, Stale: time.Minute}
+	if v, _ := Fetch(ctx, c, "counter", opts, load); v != 1 {
+		t.Fatalf("got %d want 1", v)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if v, _ := Fetch(ctx, c, "counter", opts, load); v != 1 {
+		t.Errorf("expected stale value 1, got %d", v)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if peek(ctx, c, "counter") == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("expected background refresh to store 2")
+}
+
+func TestFetchInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(10, time.Minute)
+
+	load := func(ctx context.Context) (string, error) { return "x", nil }
+	Fetch(ctx, c, "users.1", FetchOptions{Tags: []string{UserTag(1)}}, load)
+	Fetch(ctx, c, "users.list.", FetchOptions{Tags: []string{UsersListTag, UserTag(1)}}, load)
+	Fetch(ctx, c, "users.2", FetchOptions{Tags: []string{UserTag(2)}}, load)
+
+	if err := c.InvalidateTags(ctx, UserTag(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Exists(ctx, "users.1") || c.Exists(ctx, "users.list.") {
+		t.Error("expected entries tagged with user 1 to be evicted")
+	}
+	if !c.Exists(ctx, "users.2") {
+		t.Error("expected users.2 to stay cached")
+	}
+}
+
+// failingTags is a Memory whose tag index is unavailable.
+type failingTags struct {
+	*Memory
+}
+
+func (failingTags) Tag(ctx context.Context, key string, tags ...string) error {
+	return errors.New("tag index unavailable")
+}
+
+func TestFetchSkipsStoreWhenTagFails(t *testing.T) {
+	ctx := context.Background()
+	c := failingTags{NewMemory(10, time.Minute)}
+	var out bytes.Buffer
+	log := logger.NewWriter(&out, logger.Options{Format: "text"})
+
+	load := func(ctx context.Context) (string, error) { return "John", nil }
+	v, err := Fetch(ctx, c, "users.1", FetchOptions{Tags: []string{UserTag(1)}, Log: log}, load)
+	if err != nil || v != "John" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+
+	if c.Exists(ctx, "users.1") {
+		t.Error("expected an untagged key not to be stored, as InvalidateTags could not evict it")
+	}
+	if !strings.Contains(out.String(), "tag index unavailable") {
+		t.Errorf("expected the tag error to be logged, got %q", out.String())
+	}
+}
+
+// peek decodes a Fetch entry regardless of its freshness.
+func peek(ctx context.Context, c Cache, key string) int32 {
+	var v int32
+	if data, ok := c.Get(ctx, key); ok {
+		if _, payload, err := unwrap(data); err == nil {
+			sonic.Unmarshal(payload, &v)
+		}
+	}
+	return v
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process LRU cache with per-entry expiry.
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	tags    map[string]map[string]struct{}
+	// keyTags lists the tags of each key, so remove can prune the tag sets.
+	keyTags map[string][]string
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewMemory creates an LRU cache holding at most size entries.
+func NewMemory(size int, ttl time.Duration) *Memory {
+	return &Memory{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		tags:    make(map[string]map[string]struct{}),
+		keyTags: make(map[string][]string),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*memoryEntry)
+	if m.now().After(entry.expiresAt) {
+		m.remove(el)
+		return nil, false
+	}
+
+	m.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = m.ttl
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt := m.now().Add(ttl)
+	if el, ok := m.entries[key]; ok {
+		entry := el.Value.(*memoryEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		m.order.MoveToFront(el)
+		return nil
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, expiresAt: expiresAt})
+	for m.size > 0 && m.order.Len() > m.size {
+		m.remove(m.order.Back())
+	}
+
+	return nil
+}
+
+func (m *Memory) Exists(ctx context.Context, key string) bool {
+	_, ok := m.Get(ctx, key)
+	return ok
+}
+
+func (m *Memory) Del(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if el, ok := m.entries[key]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteByPrefix(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, el := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+// Tag may run before the key is set, as loaders passed to Fetch do.
+func (m *Memory) Tag(ctx context.Context, key string, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		keys, ok := m.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			m.tags[tag] = keys
+		}
+		if _, ok := keys[key]; !ok {
+			keys[key] = struct{}{}
+			m.keyTags[key] = append(m.keyTags[key], tag)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) InvalidateTags(ctx context.Context, tags ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if el, ok := m.entries[key]; ok {
+				m.remove(el)
+			} else {
+				m.untag(key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) PurgeExpired(prefix string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	purged := 0
+	for key, el := range m.entries {
+		if strings.HasPrefix(key, prefix) && now.After(el.Value.(*memoryEntry).expiresAt) {
+			m.remove(el)
+			purged++
+		}
+	}
+	return purged
+}
+
+// Len returns the number of stored entries, including expired ones not yet evicted.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// remove drops the entry of el and prunes its key from its tag sets, so
+// entries evicted or expired do not pile up in them.
+func (m *Memory) remove(el *list.Element) {
+	key := el.Value.(*memoryEntry).key
+	m.order.Remove(el)
+	delete(m.entries, key)
+	m.untag(key)
+}
+
+// untag removes key from its tag sets, dropping the sets left empty.
+func (m *Memory) untag(key string) {
+	for _, tag := range m.keyTags[key] {
+		delete(m.tags[tag], key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
+	delete(m.keyTags, key)
+}
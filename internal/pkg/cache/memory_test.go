@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(2, time.Minute)
+
+	c.Set(ctx, "a", []byte("1"), 0)
+	c.Set(ctx, "b", []byte("2"), 0)
+	if _, ok := c.Get(ctx, "a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.Set(ctx, "c", []byte("3"), 0)
+
+	if _, ok := c.Get(ctx, "b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if v, ok := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("got %q, %v want 1, true", v, ok)
+	}
+}
+
+func TestMemoryExpiresPerCallTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemory(10, time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "short", []byte("x"), time.Second)
+	c.Set(ctx, "long", []byte("y"), 0)
+
+	now = now.Add(2 * time.Second)
+	if c.Exists(ctx, "short") {
+		t.Error("expected short to be expired")
+	}
+	if !c.Exists(ctx, "long") {
+		t.Error("expected long to use the default ttl")
+	}
+}
+
+func TestMemoryDeleteByPrefix(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(10, time.Minute)
+
+	c.Set(ctx, "users.1", []byte("1"), 0)
+	c.Set(ctx, "users.2", []byte("2"), 0)
+	c.Set(ctx, "roles.1", []byte("3"), 0)
+
+	if err := c.DeleteByPrefix(ctx, "users."); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 || !c.Exists(ctx, "roles.1") {
+		t.Errorf("expected only roles.1 to remain, got %d entries", c.Len())
+	}
+}
+
+func TestMemoryPurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemory(10, time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, IdempotencyPrefix+"old", []byte("x"), time.Second)
+	c.Set(ctx, IdempotencyPrefix+"new", []byte("y"), time.Hour)
+	c.Set(ctx, "users.1", []byte("z"), time.Second)
+
+	now = now.Add(2 * time.Second)
+	if purged := c.PurgeExpired(IdempotencyPrefix); purged != 1 {
+		t.Errorf("purged %d entries want 1", purged)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected the live key and the other prefix to stay, got %d entries", c.Len())
+	}
+}
+
+func TestMemoryPrunesTagsOfRemovedKeys(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemory(2, time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "users.1", []byte("1"), time.Second)
+	c.Tag(ctx, "users.1", UserTag(1), UsersListTag)
+	c.Set(ctx, "users.2", []byte("2"), 0)
+	c.Tag(ctx, "users.2", UserTag(2), UsersListTag)
+	c.Set(ctx, "users.3", []byte("3"), 0)
+	c.Tag(ctx, "users.3", UserTag(3))
+
+	// users.1 was evicted by users.3; users.2 expires and is evicted on Get.
+	now = now.Add(2 * time.Hour)
+	c.Get(ctx, "users.2")
+
+	if len(c.tags) != 1 || len(c.tags[UserTag(3)]) != 1 {
+		t.Errorf("expected only the tag of users.3 to remain, got %v", c.tags)
+	}
+	if err := c.InvalidateTags(ctx, UserTag(3)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 || len(c.tags) != 0 || len(c.keyTags) != 0 {
+		t.Errorf("expected an empty cache, got %d entries and tags %v", c.Len(), c.tags)
+	}
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	type user struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	ctx := context.Background()
+	c := NewMemory(10, time.Minute)
+
+	if err := SetTyped(ctx, c, "users.1", user{ID: 1, Name: "John"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := GetTyped[user](ctx, c, "users.1")
+	if err != nil || !ok {
+		t.Fatalf("got ok=%v err=%v", ok, err)
+	}
+	if got.ID != 1 || got.Name != "John" {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, ok, _ := GetTyped[user](ctx, Noop{}, "users.1"); ok {
+		t.Error("noop cache should always miss")
+	}
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Noop is a cache that stores nothing. Every read is a miss.
+type Noop struct{}
+
+func (Noop) Get(ctx context.Context, key string) ([]byte, bool) { return nil, false }
+
+func (Noop) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error { return nil }
+
+func (Noop) Exists(ctx context.Context, key string) bool { return false }
+
+func (Noop) Del(ctx context.Context, keys ...string) error { return nil }
+
+func (Noop) DeleteByPrefix(ctx context.Context, prefix string) error { return nil }
+
+func (Noop) Tag(ctx context.Context, key string, tags ...string) error { return nil }
+
+func (Noop) InvalidateTags(ctx context.Context, tags ...string) error { return nil }
+
+func (Noop) Close() error { return nil }
@@ -0,0 +1,15 @@
+package cache
+
+import "fmt"
+
+// IdempotencyPrefix starts the keys storing responses for Idempotency-Key replays.
+const IdempotencyPrefix = "idempotency."
+
+// UsersListTag is attached to every cached page of the user list.
+const UsersListTag = "users.list"
+
+// UserTag is attached to every cache entry that contains data of the user,
+// such as the user itself, list pages showing it and its permissions.
+func UserTag(id int64) string {
+	return fmt.Sprintf("user.%d", id)
+}
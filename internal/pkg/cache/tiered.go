@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"rest-skeleton/internal/pkg/redis"
+
+	"github.com/bytedance/sonic"
+	"github.com/google/uuid"
+)
+
+const invalidationChannel = "cache.invalidate"
+
+// Tiered keeps a short-lived local L1 in front of the shared Redis L2.
+// Writes and evictions are broadcast over Redis pub/sub so every instance
+// drops its L1 copy of the affected keys.
+type Tiered struct {
+	l1     *Memory
+	l2     *redis.Cache
+	id     string
+	cancel context.CancelFunc
+}
+
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// NewTiered creates a two-tier cache and starts listening for evictions from other instances.
+func NewTiered(ctx context.Context, l1 *Memory, l2 *redis.Cache) *Tiered {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t := &Tiered{l1: l1, l2: l2, id: uuid.NewString(), cancel: cancel}
+
+	messages := l2.Subscribe(ctx, invalidationChannel)
+	go func() {
+		for message := range messages {
+			var inv invalidation
+			if err := sonic.Unmarshal(message, &inv); err != nil || inv.Origin == t.id {
+				continue
+			}
+			if len(inv.Keys) > 0 {
+				t.l1.Del(ctx, inv.Keys...)
+			}
+			if len(inv.Prefix) > 0 {
+				t.l1.DeleteByPrefix(ctx, inv.Prefix)
+			}
+		}
+	}()
+
+	return t
+}
+
+func (t *Tiered) Get(ctx context.Context, key string) ([]byte, bool) {
+	if value, ok := t.l1.Get(ctx, key); ok {
+		return value, true
+	}
+
+	value, ok := t.l2.Get(ctx, key)
+	if ok {
+		t.l1.Set(ctx, key, value, 0)
+	}
+	return value, ok
+}
+
+func (t *Tiered) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := t.l2.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+
+	l1TTL := t.l1.ttl
+	if ttl > 0 && ttl < l1TTL {
+		l1TTL = ttl
+	}
+	t.l1.Set(ctx, key, value, l1TTL)
+	return t.publish(ctx, invalidation{Keys: []string{key}})
+}
+
+func (t *Tiered) Exists(ctx context.Context, key string) bool {
+	return t.l1.Exists(ctx, key) || t.l2.Exists(ctx, key)
+}
+
+func (t *Tiered) Del(ctx context.Context, keys ...string) error {
+	t.l1.Del(ctx, keys...)
+	if err := t.l2.Del(ctx, keys...); err != nil {
+		return err
+	}
+	return t.publish(ctx, invalidation{Keys: keys})
+}
+
+func (t *Tiered) DeleteByPrefix(ctx context.Context, prefix string) error {
+	t.l1.DeleteByPrefix(ctx, prefix)
+	if err := t.l2.DeleteByPrefix(ctx, prefix); err != nil {
+		return err
+	}
+	return t.publish(ctx, invalidation{Prefix: prefix})
+}
+
+func (t *Tiered) Tag(ctx context.Context, key string, tags ...string) error {
+	return t.l2.Tag(ctx, key, tags...)
+}
+
+func (t *Tiered) InvalidateTags(ctx context.Context, tags ...string) error {
+	keys, err := t.l2.TagMembers(ctx, tags...)
+	if err != nil {
+		return err
+	}
+
+	if err := t.l2.InvalidateTags(ctx, tags...); err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	t.l1.Del(ctx, keys...)
+	return t.publish(ctx, invalidation{Keys: keys})
+}
+
+// PurgeExpired drops expired entries from the local L1; Redis expires L2 keys itself.
+func (t *Tiered) PurgeExpired(prefix string) int {
+	return t.l1.PurgeExpired(prefix)
+}
+
+func (t *Tiered) Close() error {
+	t.cancel()
+	return t.l2.Close()
+}
+
+func (t *Tiered) publish(ctx context.Context, inv invalidation) error {
+	inv.Origin = t.id
+	message, err := sonic.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return t.l2.Publish(ctx, invalidationChannel, message)
+}
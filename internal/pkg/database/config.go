@@ -0,0 +1,215 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes how to reach Postgres and how to size the pool.
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+
+	// SSLMode is one of disable, require, verify-ca or verify-full. SSLRootCert
+	// is the CA used to verify the server; SSLCert and SSLKey enable client certificates.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+
+	ApplicationName  string
+	SearchPath       string
+	StatementTimeout time.Duration
+	ConnectTimeout   time.Duration
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectAttempts bounds how often the first ping is tried at startup,
+	// waiting ConnectBackoff, then twice as long, between attempts.
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+
+	// StatementCache reuses prepared statements across requests.
+	StatementCache bool
+
+	// SlowQuery is the duration above which a query is logged; 0 disables the log.
+	SlowQuery time.Duration
+
+	// Replicas are host:port addresses sharing the primary's credentials.
+	Replicas      []string
+	MaxReplicaLag time.Duration
+}
+
+var sslModes = map[string]bool{"disable": true, "require": true, "verify-ca": true, "verify-full": true}
+
+// ConfigFromEnv reads the POSTGRES_* environment variables.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Host:            os.Getenv("POSTGRES_HOST"),
+		User:            os.Getenv("POSTGRES_USER"),
+		Password:        os.Getenv("POSTGRES_PASSWORD"),
+		Name:            os.Getenv("POSTGRES_DB"),
+		SSLMode:         os.Getenv("POSTGRES_SSLMODE"),
+		SSLRootCert:     os.Getenv("POSTGRES_SSLROOTCERT"),
+		SSLCert:         os.Getenv("POSTGRES_SSLCERT"),
+		SSLKey:          os.Getenv("POSTGRES_SSLKEY"),
+		ApplicationName: os.Getenv("POSTGRES_APPLICATION_NAME"),
+		SearchPath:      os.Getenv("POSTGRES_SEARCH_PATH"),
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		ConnectTimeout:  5 * time.Second,
+		ConnectAttempts: 5,
+		ConnectBackoff:  500 * time.Millisecond,
+		StatementCache:  true,
+		SlowQuery:       500 * time.Millisecond,
+		MaxReplicaLag:   defaultMaxReplicaLag,
+	}
+
+	if cfg.SSLMode == "" {
+		cfg.SSLMode = "disable"
+	}
+	if !sslModes[cfg.SSLMode] {
+		return cfg, fmt.Errorf("invalid POSTGRES_SSLMODE %q", cfg.SSLMode)
+	}
+	if cfg.ApplicationName == "" {
+		cfg.ApplicationName = os.Getenv("APP_NAME")
+	}
+
+	for _, addr := range strings.Split(os.Getenv("POSTGRES_REPLICA_HOSTS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Replicas = append(cfg.Replicas, addr)
+		}
+	}
+
+	var err error
+	if cfg.Port, err = envInt("POSTGRES_PORT", 5432); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxOpenConns, err = envInt("POSTGRES_MAX_OPEN_CONNS", cfg.MaxOpenConns); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConns, err = envInt("POSTGRES_MAX_IDLE_CONNS", cfg.MaxIdleConns); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnectAttempts, err = envInt("POSTGRES_CONNECT_ATTEMPTS", cfg.ConnectAttempts); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnMaxLifetime, err = envDuration("POSTGRES_CONN_MAX_LIFETIME", cfg.ConnMaxLifetime); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnMaxIdleTime, err = envDuration("POSTGRES_CONN_MAX_IDLE_TIME", cfg.ConnMaxIdleTime); err != nil {
+		return cfg, err
+	}
+	if cfg.StatementTimeout, err = envDuration("POSTGRES_STATEMENT_TIMEOUT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnectTimeout, err = envDuration("POSTGRES_CONNECT_TIMEOUT", cfg.ConnectTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnectBackoff, err = envDuration("POSTGRES_CONNECT_BACKOFF", cfg.ConnectBackoff); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("POSTGRES_STATEMENT_CACHE"); v != "" {
+		if cfg.StatementCache, err = strconv.ParseBool(v); err != nil {
+			return cfg, fmt.Errorf("invalid POSTGRES_STATEMENT_CACHE: %w", err)
+		}
+	}
+	if cfg.SlowQuery, err = envDuration("POSTGRES_SLOW_QUERY", cfg.SlowQuery); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxReplicaLag, err = envDuration("POSTGRES_REPLICA_MAX_LAG", cfg.MaxReplicaLag); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// DSN builds the lib/pq connection string for the node at host:port.
+// Unknown keys such as search_path and statement_timeout are sent to the
+// server as run-time parameters.
+func (cfg Config) DSN(host string, port int) string {
+	params := map[string]string{
+		"host":     host,
+		"port":     strconv.Itoa(port),
+		"user":     cfg.User,
+		"password": cfg.Password,
+		"dbname":   cfg.Name,
+		"sslmode":  cfg.SSLMode,
+	}
+	optional := map[string]string{
+		"sslrootcert":      cfg.SSLRootCert,
+		"sslcert":          cfg.SSLCert,
+		"sslkey":           cfg.SSLKey,
+		"application_name": cfg.ApplicationName,
+		"search_path":      cfg.SearchPath,
+	}
+	if cfg.StatementTimeout > 0 {
+		optional["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if cfg.ConnectTimeout > 0 {
+		// connect_timeout is in whole seconds and 0 means wait forever.
+		optional["connect_timeout"] = strconv.Itoa(max(1, int(cfg.ConnectTimeout.Seconds())))
+	}
+	for key, value := range optional {
+		if value != "" {
+			params[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+quoteDSN(params[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// quoteDSN quotes a connection string value so spaces and quotes survive parsing.
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func envInt(name string, fallback int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
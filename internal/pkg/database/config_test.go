@@ -0,0 +1,99 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"rest-skeleton/internal/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("POSTGRES_HOST", "db.internal")
+	t.Setenv("POSTGRES_PORT", "6432")
+	t.Setenv("POSTGRES_SSLMODE", "verify-full")
+	t.Setenv("POSTGRES_STATEMENT_TIMEOUT", "15s")
+	t.Setenv("POSTGRES_MAX_OPEN_CONNS", "40")
+	t.Setenv("POSTGRES_REPLICA_HOSTS", "r1:5432, r2:5432")
+	t.Setenv("APP_NAME", "skeleton")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Host != "db.internal" || cfg.Port != 6432 || cfg.SSLMode != "verify-full" {
+		t.Errorf("unexpected connection settings %+v", cfg)
+	}
+	if cfg.StatementTimeout != 15*time.Second || cfg.MaxOpenConns != 40 || cfg.MaxIdleConns != 25 {
+		t.Errorf("unexpected pool settings %+v", cfg)
+	}
+	if cfg.ApplicationName != "skeleton" {
+		t.Errorf("expected application_name to default to APP_NAME, got %q", cfg.ApplicationName)
+	}
+	if len(cfg.Replicas) != 2 || cfg.Replicas[1] != "r2:5432" {
+		t.Errorf("unexpected replicas %v", cfg.Replicas)
+	}
+}
+
+func TestConfigFromEnvRejectsUnknownSSLMode(t *testing.T) {
+	t.Setenv("POSTGRES_SSLMODE", "prefer")
+
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected an error for an unsupported sslmode")
+	}
+}
+
+func TestDSN(t *testing.T) {
+	cfg := Config{
+		User:             "app",
+		Password:         `it's secret`,
+		Name:             "simple_api",
+		SSLMode:          "verify-ca",
+		SSLRootCert:      "/etc/ssl/ca.pem",
+		ApplicationName:  "skeleton",
+		SearchPath:       "app,public",
+		StatementTimeout: 1500 * time.Millisecond,
+	}
+
+	dsn := cfg.DSN("db.internal", 5432)
+
+	for _, want := range []string{
+		`host='db.internal'`,
+		`port='5432'`,
+		`password='it\'s secret'`,
+		`sslmode='verify-ca'`,
+		`sslrootcert='/etc/ssl/ca.pem'`,
+		`application_name='skeleton'`,
+		`search_path='app,public'`,
+		`statement_timeout='1500'`,
+	} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("expected %s in %s", want, dsn)
+		}
+	}
+	if strings.Contains(dsn, "sslcert") || strings.Contains(dsn, "connect_timeout") {
+		t.Errorf("expected unset options to be left out of %s", dsn)
+	}
+}
+
+func TestOpenReturnsErrorAfterRetries(t *testing.T) {
+	cfg := Config{
+		Host:            "127.0.0.1",
+		Port:            1,
+		SSLMode:         "disable",
+		ConnectTimeout:  time.Second,
+		ConnectAttempts: 3,
+		ConnectBackoff:  time.Millisecond,
+	}
+
+	var out bytes.Buffer
+	_, err := Open(context.Background(), cfg, logger.NewWriter(&out, logger.Options{Format: "text"}))
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected connection error after 3 attempts, got %v", err)
+	}
+	if n := strings.Count(out.String(), "database not ready"); n != 2 {
+		t.Errorf("expected 2 retries to be logged, got %d in %q", n, out.String())
+	}
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedDB wraps the executor of one node so every query gets a client span,
+// is timed in the query-duration histogram and is logged when slow. With a
+// statement cache, queries run as prepared statements.
+type tracedDB struct {
+	db    DBTX
+	d     *Database
+	node  string
+	stmts *stmtCache
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, done := t.d.startQuery(ctx, t.node, query)
+	var result sql.Result
+	var err error
+	if stmt := t.statement(ctx, query); stmt != nil {
+		result, err = stmt.ExecContext(ctx, args...)
+		if t.retryStale(err) {
+			result, err = t.db.ExecContext(ctx, query, args...)
+		}
+	} else {
+		result, err = t.db.ExecContext(ctx, query, args...)
+	}
+	done(err)
+	return result, err
+}
+
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, done := t.d.startQuery(ctx, t.node, query)
+	var rows *sql.Rows
+	var err error
+	if stmt := t.statement(ctx, query); stmt != nil {
+		rows, err = stmt.QueryContext(ctx, args...)
+		if t.retryStale(err) {
+			rows, err = t.db.QueryContext(ctx, query, args...)
+		}
+	} else {
+		rows, err = t.db.QueryContext(ctx, query, args...)
+	}
+	done(err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, done := t.d.startQuery(ctx, t.node, query)
+	var row *sql.Row
+	if stmt := t.statement(ctx, query); stmt != nil {
+		row = stmt.QueryRowContext(ctx, args...)
+		if t.retryStale(row.Err()) {
+			row = t.db.QueryRowContext(ctx, query, args...)
+		}
+	} else {
+		row = t.db.QueryRowContext(ctx, query, args...)
+	}
+	done(row.Err())
+	return row
+}
+
+func (t tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, done := t.d.startQuery(ctx, t.node, query)
+	stmt, err := t.db.PrepareContext(ctx, query)
+	done(err)
+	return stmt, err
+}
+
+// startQuery opens the client span for query. The returned func ends it and
+// records the duration.
+func (d *Database) startQuery(ctx context.Context, node string, query string) (context.Context, func(error)) {
+	info := parseQuery(query)
+
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperationName(info.operation),
+		attribute.String("db.node", node),
+	}
+	if info.table != "" {
+		attrs = append(attrs, semconv.DBCollectionName(info.table))
+	}
+	if d.Namespace != "" {
+		attrs = append(attrs, semconv.DBNamespace(d.Namespace))
+	}
+
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, info.spanName(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attrs, semconv.DBQueryText(query))...),
+	)
+	start := time.Now()
+
+	return ctx, func(err error) {
+		elapsed := time.Since(start)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		if d.queryDuration != nil {
+			d.queryDuration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attrs...))
+		}
+		if d.SlowQuery > 0 && elapsed >= d.SlowQuery && d.Log != nil {
+			d.Log.Warn(ctx, "slow query", "node", node, "duration_ms", elapsed.Milliseconds(), "query", strings.Join(strings.Fields(query), " "))
+		}
+	}
+}
+
+type queryInfo struct {
+	operation string
+	table     string
+}
+
+func (q queryInfo) spanName() string {
+	if q.table == "" {
+		return q.operation
+	}
+	return q.operation + " " + q.table
+}
+
+// maxParsedQueries bounds the parse cache like maxCachedStatements. Queries
+// beyond the limit are parsed on every run.
+const maxParsedQueries = maxCachedStatements
+
+var (
+	tablePattern = regexp.MustCompile(`(?is)\b(?:FROM|INTO|UPDATE|JOIN)\s+("?[a-z_][a-z0-9_.]*"?)`)
+	parsedMu     sync.RWMutex
+	parsed       = make(map[string]queryInfo)
+)
+
+// parseQuery extracts the operation and the first table of query. Results are
+// cached since repositories run the same few statements over and over.
+func parseQuery(query string) queryInfo {
+	parsedMu.RLock()
+	info, ok := parsed[query]
+	parsedMu.RUnlock()
+	if ok {
+		return info
+	}
+
+	fields := strings.Fields(query)
+	if len(fields) > 0 {
+		info.operation = strings.ToUpper(fields[0])
+	}
+	if match := tablePattern.FindStringSubmatch(query); match != nil {
+		info.table = strings.Trim(match[1], `"`)
+	}
+
+	parsedMu.Lock()
+	if len(parsed) < maxParsedQueries {
+		parsed[query] = info
+	}
+	parsedMu.Unlock()
+	return info
+}
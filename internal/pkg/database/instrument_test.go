@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		operation string
+		table     string
+	}{
+		{`SELECT id, name FROM users WHERE id=$1`, "SELECT", "users"},
+		{"\n\t\tINSERT INTO roles_users (user_id, role_id) VALUES ($1, $2)", "INSERT", "roles_users"},
+		{`UPDATE users SET name = $1 WHERE id = $2`, "UPDATE", "users"},
+		{`delete from "public.sessions" where id = $1`, "DELETE", "public.sessions"},
+		{`SAVEPOINT sp_1`, "SAVEPOINT", ""},
+	}
+
+	for _, tt := range tests {
+		info := parseQuery(tt.query)
+		if info.operation != tt.operation || info.table != tt.table {
+			t.Errorf("parseQuery(%q) = %+v want %s %s", tt.query, info, tt.operation, tt.table)
+		}
+	}
+}
+
+func TestParseQueryCacheIsBounded(t *testing.T) {
+	for i := 0; i < 2*maxParsedQueries; i++ {
+		parseQuery(fmt.Sprintf("SELECT * FROM users WHERE id IN (%d)", i))
+	}
+
+	info := parseQuery("SELECT name FROM roles WHERE id = 99999")
+	if info.operation != "SELECT" || info.table != "roles" {
+		t.Errorf("expected queries beyond the limit to still be parsed, got %+v", info)
+	}
+
+	parsedMu.RLock()
+	n := len(parsed)
+	parsedMu.RUnlock()
+	if n > maxParsedQueries {
+		t.Errorf("expected at most %d parsed queries cached, got %d", maxParsedQueries, n)
+	}
+}
+
+func TestQueriesAreTracedAndTimed(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	reader := metricsdk.NewManualReader()
+	meter := metricsdk.NewMeterProvider(metricsdk.WithReader(reader)).Meter("test")
+
+	// Nothing listens on port 1, so the query fails fast without a server.
+	conn, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db := &Database{Conn: conn, Namespace: "simple_api"}
+	if err := db.RegisterMetrics(meter); err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	if err := db.Executor(context.Background()).QueryRowContext(context.Background(), `SELECT id FROM users WHERE id=$1`, 1).Scan(&id); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("expected one span, got %d", len(ended))
+	}
+	span := ended[0]
+	if span.Name() != "SELECT users" || span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("unexpected span %s kind %s", span.Name(), span.SpanKind())
+	}
+	if span.Status().Code != codes.Error {
+		t.Error("expected the failed query to mark the span as an error")
+	}
+	attrs := make(map[string]string)
+	for _, attr := range span.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs[string(semconv.DBSystemKey)] != "postgresql" || attrs[string(semconv.DBCollectionNameKey)] != "users" || attrs[string(semconv.DBNamespaceKey)] != "simple_api" {
+		t.Errorf("unexpected span attributes %v", attrs)
+	}
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]bool)
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			found[m.Name] = true
+			if h, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == "db.client.operation.duration" {
+				if len(h.DataPoints) != 1 || h.DataPoints[0].Count != 1 {
+					t.Errorf("expected one recorded duration, got %+v", h.DataPoints)
+				}
+			}
+		}
+	}
+	for _, name := range []string{"db.client.operation.duration", "db.client.connections.open", "db.client.connections.wait_duration"} {
+		if !found[name] {
+			t.Errorf("expected metric %s to be exported", name)
+		}
+	}
+}
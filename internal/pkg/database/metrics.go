@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// RegisterMetrics creates the query-duration histogram and the statement cache
+// counter, and exports the sql.DBStats of every node plus the replica lag and
+// health, labelled with db.node.
+func (d *Database) RegisterMetrics(meter metric.Meter) error {
+	var err error
+	d.queryDuration, err = meter.Float64Histogram("db.client.operation.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of database queries by operation and table"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create metric: %w", err)
+	}
+
+	d.statementLookups, err = meter.Int64Counter("db.client.statement_cache.lookups",
+		metric.WithDescription("Prepared statement cache lookups, labelled with hit=true or false"),
+	)
+	if err != nil {
+		return fmt.Errorf("could not create metric: %w", err)
+	}
+
+	gauges := []struct {
+		name  string
+		value func(sql.DBStats) int64
+	}{
+		{"db.client.connections.max", func(s sql.DBStats) int64 { return int64(s.MaxOpenConnections) }},
+		{"db.client.connections.open", func(s sql.DBStats) int64 { return int64(s.OpenConnections) }},
+		{"db.client.connections.in_use", func(s sql.DBStats) int64 { return int64(s.InUse) }},
+		{"db.client.connections.idle", func(s sql.DBStats) int64 { return int64(s.Idle) }},
+		{"db.client.connections.wait_count", func(s sql.DBStats) int64 { return s.WaitCount }},
+		{"db.client.connections.max_idle_closed", func(s sql.DBStats) int64 { return s.MaxIdleClosed }},
+		{"db.client.connections.max_idle_time_closed", func(s sql.DBStats) int64 { return s.MaxIdleTimeClosed }},
+		{"db.client.connections.max_lifetime_closed", func(s sql.DBStats) int64 { return s.MaxLifetimeClosed }},
+	}
+
+	instruments := make([]metric.Observable, 0, len(gauges)+3)
+	observers := make([]metric.Int64ObservableGauge, 0, len(gauges))
+	for _, gauge := range gauges {
+		observer, err := meter.Int64ObservableGauge(gauge.name)
+		if err != nil {
+			return fmt.Errorf("could not create metric: %w", err)
+		}
+		observers = append(observers, observer)
+		instruments = append(instruments, observer)
+	}
+
+	waitDuration, err := meter.Float64ObservableGauge("db.client.connections.wait_duration", metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("could not create metric: %w", err)
+	}
+	lag, err := meter.Float64ObservableGauge("db.replica.lag", metric.WithUnit("s"))
+	if err != nil {
+		return fmt.Errorf("could not create metric: %w", err)
+	}
+	healthy, err := meter.Int64ObservableGauge("db.replica.healthy")
+	if err != nil {
+		return fmt.Errorf("could not create metric: %w", err)
+	}
+	instruments = append(instruments, waitDuration, lag, healthy)
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		observe := func(node string, conn *sql.DB) {
+			stats := conn.Stats()
+			attrs := metric.WithAttributes(attribute.String("db.node", node))
+			for i, gauge := range gauges {
+				o.ObserveInt64(observers[i], gauge.value(stats), attrs)
+			}
+			o.ObserveFloat64(waitDuration, stats.WaitDuration.Seconds(), attrs)
+		}
+
+		observe("primary", d.Conn)
+		for _, replica := range d.Replicas {
+			observe(replica.Name, replica.Conn)
+
+			attrs := metric.WithAttributes(attribute.String("db.node", replica.Name))
+			o.ObserveFloat64(lag, replica.Lag().Seconds(), attrs)
+			var up int64
+			if replica.Healthy() {
+				up = 1
+			}
+			o.ObserveInt64(healthy, up, attrs)
+		}
+		return nil
+	}, instruments...)
+	return err
+}
@@ -3,44 +3,141 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"net"
 	"strconv"
+	"sync/atomic"
+	"time"
+
+	"rest-skeleton/internal/pkg/logger"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
+	"go.opentelemetry.io/otel/metric"
 )
 
 // Database wraps the SQL database connection
 type Database struct {
 	Conn *sql.DB
+
+	// Replicas receive reads through Reader. MaxLag is the replication lag
+	// above which a replica is taken out of rotation.
+	Replicas []*Replica
+	MaxLag   time.Duration
+
+	// Queries slower than SlowQuery are logged to Log. Namespace is the
+	// database name reported on spans.
+	Log       *logger.Logger
+	SlowQuery time.Duration
+	Namespace string
+
+	next             atomic.Uint64
+	statements       *stmtCache
+	queryDuration    metric.Float64Histogram
+	statementLookups metric.Int64Counter
 }
 
-func NewDatabase() (*Database, error) {
-	port, err := strconv.Atoi(os.Getenv("POSTGRES_PORT"))
+// NewDatabase connects with the configuration from the environment.
+func NewDatabase(log *logger.Logger) (*Database, error) {
+	cfg, err := ConfigFromEnv()
 	if err != nil {
 		return nil, err
 	}
+	return Open(context.Background(), cfg, log)
+}
 
-	psqlInfo := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("POSTGRES_HOST"), port, os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DB"),
-	)
-
-	db, err := sql.Open("postgres", psqlInfo)
+// Open connects to the primary, retrying with backoff while it is not
+// reachable yet, and opens a pool for every replica. log receives the retries
+// and becomes Database.Log; it may be nil.
+func Open(ctx context.Context, cfg Config, log *logger.Logger) (*Database, error) {
+	conn, err := openPool(cfg, cfg.Host, cfg.Port)
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
-	// Test the connection
-	if err = db.Ping(); err != nil {
-		log.Fatal(err)
+	if err := ping(ctx, conn, cfg, log); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	return &Database{Conn: db}, nil
+	database := &Database{Conn: conn, Log: log, MaxLag: cfg.MaxReplicaLag, SlowQuery: cfg.SlowQuery, Namespace: cfg.Name}
+	for _, addr := range cfg.Replicas {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("invalid replica %q: %w", addr, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			database.Close()
+			return nil, fmt.Errorf("invalid replica %q: %w", addr, err)
+		}
+
+		replica, err := openPool(cfg, host, port)
+		if err != nil {
+			database.Close()
+			return nil, err
+		}
+		database.Replicas = append(database.Replicas, &Replica{Name: addr, Conn: replica})
+	}
+
+	if cfg.StatementCache {
+		database.EnableStatementCache()
+	}
+
+	// An unreachable replica is not fatal: it stays out of rotation until a check succeeds.
+	database.CheckReplicas(ctx)
+
+	return database, nil
+}
+
+func openPool(cfg Config, host string, port int) (*sql.DB, error) {
+	conn, err := sql.Open("postgres", cfg.DSN(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
+
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return conn, nil
+}
+
+// ping waits for the database to accept connections, doubling the wait after every failed attempt.
+func ping(ctx context.Context, conn *sql.DB, cfg Config, log *logger.Logger) error {
+	attempts := max(1, cfg.ConnectAttempts)
+	backoff := cfg.ConnectBackoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = conn.PingContext(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		if log != nil {
+			log.Warn(ctx, fmt.Sprintf("database not ready (attempt %d/%d): %v", attempt, attempts, err), "attempt", attempt, "retry_in", backoff.String())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 10*time.Second)
+	}
+	return fmt.Errorf("could not connect to database after %d attempts: %w", attempts, err)
+}
+
+// Close closes the primary and every replica.
+func (d *Database) Close() error {
+	errs := []error{d.Conn.Close()}
+	for _, replica := range d.Replicas {
+		errs = append(errs, replica.Conn.Close())
+	}
+	return errors.Join(errs...)
 }
 
 func StatusCheck(ctx context.Context, db *sql.DB) error {
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxReplicaLag is how far a replica may fall behind before reads stop going to it.
+const defaultMaxReplicaLag = 5 * time.Second
+
+// lagQuery reports whether the WAL receiver is streaming and the replication
+// lag in seconds. A streaming replica that has replayed everything it received
+// is not lagging even when the primary is idle. A replica whose receiver is
+// down has replayed everything it received too, but may be arbitrarily stale.
+// Roles without pg_read_all_stats see a NULL status, so a running receiver is
+// then taken as streaming.
+const lagQuery = `
+	WITH receiver AS (
+		SELECT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming') AS streaming
+	)
+	SELECT streaming, CASE
+		WHEN streaming AND pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END
+	FROM receiver`
+
+// Replica is a read-only node. Reads are only routed to it while it is healthy.
+type Replica struct {
+	Name    string
+	Conn    *sql.DB
+	healthy atomic.Bool
+	lag     atomic.Int64
+
+	statements *stmtCache
+}
+
+// Healthy reports whether the last check reached the replica within the allowed lag.
+func (r *Replica) Healthy() bool {
+	return r.healthy.Load()
+}
+
+// Lag returns the replication lag measured by the last check.
+func (r *Replica) Lag() time.Duration {
+	return time.Duration(r.lag.Load())
+}
+
+type pinKey struct{}
+
+// WithPinning prepares ctx so that the first write made with it pins every
+// later read to the primary. Call it once per request.
+func WithPinning(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinKey{}, new(atomic.Bool))
+}
+
+// PinPrimary routes the remaining reads made with ctx to the primary.
+func PinPrimary(ctx context.Context) {
+	if pinned, ok := ctx.Value(pinKey{}).(*atomic.Bool); ok {
+		pinned.Store(true)
+	}
+}
+
+func isPinned(ctx context.Context) bool {
+	pinned, ok := ctx.Value(pinKey{}).(*atomic.Bool)
+	return ok && pinned.Load()
+}
+
+// Reader returns the executor for read-only queries: the transaction carried
+// by ctx, the primary when the request has already written, or otherwise a
+// healthy replica. Without a healthy replica reads go to the primary.
+func (d *Database) Reader(ctx context.Context) DBTX {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return d.primary(state.tx)
+	}
+	if isPinned(ctx) || len(d.Replicas) == 0 {
+		return d.primary(d.Conn)
+	}
+
+	start := d.next.Add(1)
+	for i := range d.Replicas {
+		replica := d.Replicas[(int(start)+i)%len(d.Replicas)]
+		if replica.Healthy() {
+			return tracedDB{db: replica.Conn, d: d, node: replica.Name, stmts: replica.statements}
+		}
+	}
+	return d.primary(d.Conn)
+}
+
+// CheckReplicas measures the lag of every replica and marks it unhealthy when
+// it cannot be reached, is not receiving WAL or lags more than MaxLag.
+func (d *Database) CheckReplicas(ctx context.Context) {
+	maxLag := d.MaxLag
+	if maxLag <= 0 {
+		maxLag = defaultMaxReplicaLag
+	}
+
+	for _, replica := range d.Replicas {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		var streaming bool
+		var seconds float64
+		err := replica.Conn.QueryRowContext(ctx, lagQuery).Scan(&streaming, &seconds)
+		cancel()
+
+		if err != nil {
+			if replica.healthy.Swap(false) && d.Log != nil {
+				d.Log.Warn(ctx, fmt.Sprintf("replica %s is unreachable: %v", replica.Name, err), "replica", replica.Name)
+			}
+			continue
+		}
+
+		lag := time.Duration(seconds * float64(time.Second))
+		replica.lag.Store(int64(lag))
+		healthy := streaming && lag <= maxLag
+		if replica.healthy.Swap(healthy) == healthy || d.Log == nil {
+			continue
+		}
+		if healthy {
+			d.Log.Info(ctx, fmt.Sprintf("replica %s is healthy again", replica.Name), "replica", replica.Name, "lag", lag.String())
+		} else {
+			d.Log.Warn(ctx, fmt.Sprintf("replica %s is unhealthy", replica.Name), "replica", replica.Name, "streaming", streaming, "lag", lag.String())
+		}
+	}
+}
+
+// MonitorReplicas runs CheckReplicas every interval until ctx is done.
+func (d *Database) MonitorReplicas(ctx context.Context, interval time.Duration) {
+	if len(d.Replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.CheckReplicas(ctx)
+		}
+	}
+}
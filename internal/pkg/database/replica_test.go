@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// newTestDatabase opens pools that never connect, so routing can be checked without Postgres.
+func newTestDatabase(t *testing.T, replicas ...string) *Database {
+	t.Helper()
+	open := func() *sql.DB {
+		conn, err := sql.Open("postgres", "host=localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	db := &Database{Conn: open()}
+	for _, name := range replicas {
+		replica := &Replica{Name: name, Conn: open()}
+		replica.healthy.Store(true)
+		db.Replicas = append(db.Replicas, replica)
+	}
+	return db
+}
+
+func TestReaderWithoutReplicasUsesPrimary(t *testing.T) {
+	db := newTestDatabase(t)
+
+	if node(db.Reader(context.Background())) != db.Conn {
+		t.Error("expected reads to go to the primary")
+	}
+}
+
+func TestReaderRoundRobinsHealthyReplicas(t *testing.T) {
+	db := newTestDatabase(t, "r1", "r2", "r3")
+	db.Replicas[1].healthy.Store(false)
+
+	seen := make(map[DBTX]int)
+	for i := 0; i < 6; i++ {
+		seen[node(db.Reader(context.Background()))]++
+	}
+
+	if seen[db.Replicas[0].Conn] == 0 || seen[db.Replicas[2].Conn] == 0 {
+		t.Errorf("expected both healthy replicas to serve reads, got %v", seen)
+	}
+	if seen[db.Replicas[1].Conn] != 0 || seen[db.Conn] != 0 {
+		t.Error("expected unhealthy replica and primary to receive no reads")
+	}
+}
+
+func TestReaderFallsBackToPrimaryWhenNoReplicaIsHealthy(t *testing.T) {
+	db := newTestDatabase(t, "r1")
+	db.Replicas[0].healthy.Store(false)
+
+	if node(db.Reader(context.Background())) != db.Conn {
+		t.Error("expected reads to fall back to the primary")
+	}
+}
+
+func TestReaderPinnedToPrimaryAfterWrite(t *testing.T) {
+	db := newTestDatabase(t, "r1")
+	ctx := WithPinning(context.Background())
+
+	if node(db.Reader(ctx)) != db.Replicas[0].Conn {
+		t.Fatal("expected reads before a write to go to the replica")
+	}
+
+	db.Executor(ctx)
+
+	if node(db.Reader(ctx)) != db.Conn {
+		t.Error("expected reads after a write to be pinned to the primary")
+	}
+	if node(db.Reader(context.Background())) != db.Replicas[0].Conn {
+		t.Error("expected other requests to keep reading from the replica")
+	}
+}
+
+func TestCheckReplicasMarksUnreachableReplicaUnhealthy(t *testing.T) {
+	db := newTestDatabase(t, "r1")
+	db.Replicas[0].Conn.Close()
+
+	db.CheckReplicas(context.Background())
+
+	if db.Replicas[0].Healthy() {
+		t.Error("expected unreachable replica to be unhealthy")
+	}
+}
+
+// node unwraps the instrumentation to get the pool a query was routed to.
+func node(db DBTX) DBTX {
+	return db.(tracedDB).db
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// maxCachedStatements bounds the registry so dynamically built queries cannot grow it forever.
+// Queries beyond the limit run unprepared.
+const maxCachedStatements = 256
+
+// statementGracePeriod is how long a dropped statement stays usable.
+const statementGracePeriod = time.Minute
+
+// stmtCache prepares each query once per pool. database/sql then prepares the
+// statement lazily on every connection it runs on and reuses it afterwards.
+type stmtCache struct {
+	conn  *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(conn *sql.DB) *stmtCache {
+	return &stmtCache{conn: conn, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get returns the statement for query, preparing it on a miss. It returns nil
+// when the registry is full.
+func (c *stmtCache) get(ctx context.Context, query string) (stmt *sql.Stmt, hit bool, err error) {
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	c.mu.RUnlock()
+	if ok {
+		return stmt, true, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, true, nil
+	}
+	if len(c.stmts) >= maxCachedStatements {
+		return nil, false, nil
+	}
+
+	stmt, err = c.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, false, err
+	}
+	c.stmts[query] = stmt
+	return stmt, false, nil
+}
+
+// reset drops every cached statement so the next use prepares it again. The
+// old statements are closed after a grace period because queries that looked
+// them up just before the reset may still be running them.
+func (c *stmtCache) reset() {
+	c.mu.Lock()
+	stmts := c.stmts
+	c.stmts = make(map[string]*sql.Stmt)
+	c.mu.Unlock()
+
+	time.AfterFunc(statementGracePeriod, func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	})
+}
+
+// EnableStatementCache makes the primary and every replica reuse prepared
+// statements. Leave it off behind a pooler in transaction mode, which does not
+// keep prepared statements across transactions.
+func (d *Database) EnableStatementCache() {
+	d.statements = newStmtCache(d.Conn)
+	for _, replica := range d.Replicas {
+		replica.statements = newStmtCache(replica.Conn)
+	}
+}
+
+// InvalidateStatements drops every cached statement. Call it after running
+// schema migrations so no statement keeps a plan for the old schema.
+func (d *Database) InvalidateStatements() {
+	if d.statements != nil {
+		d.statements.reset()
+	}
+	for _, replica := range d.Replicas {
+		if replica.statements != nil {
+			replica.statements.reset()
+		}
+	}
+}
+
+// schemaVersionQuery changes whenever a migration is applied or rolled back:
+// ids only grow and rolled back rows are kept.
+const schemaVersionQuery = `SELECT COALESCE(max(id), 0) + COUNT(rolled_back_at) FROM _migrations`
+
+// WatchSchema polls _migrations every interval until ctx is done and drops
+// the cached statements when migrations ran, so servers do not wait for a
+// query to fail on a stale plan. The migrate command only resets the cache of
+// its own process.
+func (d *Database) WatchSchema(ctx context.Context, interval time.Duration) {
+	if d.statements == nil {
+		return
+	}
+
+	var last int64
+	known := d.Conn.QueryRowContext(ctx, schemaVersionQuery).Scan(&last) == nil
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var version int64
+		if err := d.Conn.QueryRowContext(ctx, schemaVersionQuery).Scan(&version); err != nil {
+			// _migrations may not exist yet; the next poll tries again.
+			continue
+		}
+		if known && version != last {
+			d.InvalidateStatements()
+			if d.Log != nil {
+				d.Log.Info(ctx, "schema changed, prepared statements dropped")
+			}
+		}
+		last, known = version, true
+	}
+}
+
+// statement returns the cached statement for query bound to the executor, or
+// nil when the query should run unprepared.
+func (t tracedDB) statement(ctx context.Context, query string) *sql.Stmt {
+	if t.stmts == nil {
+		return nil
+	}
+
+	stmt, hit, err := t.stmts.get(ctx, query)
+	if t.d.statementLookups != nil {
+		t.d.statementLookups.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("db.node", t.node),
+			attribute.Bool("hit", hit),
+		))
+	}
+	// A query that cannot be prepared runs unprepared so the caller sees the error it produces.
+	if err != nil || stmt == nil {
+		return nil
+	}
+
+	if tx, ok := t.db.(*sql.Tx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+// retryStale reports whether err means the cached statement no longer matches
+// the schema. The cache is reset and, outside a transaction, the query can run again.
+func (t tracedDB) retryStale(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	// 0A000 is raised when a cached plan's result type changed, 26000 when the
+	// statement was dropped, for example by DISCARD ALL.
+	stale := pqErr.Code == "26000" || (pqErr.Code == "0A000" && strings.Contains(pqErr.Message, "cached plan"))
+	if !stale {
+		return false
+	}
+
+	t.stmts.reset()
+	_, inTx := t.db.(*sql.Tx)
+	return !inTx
+}
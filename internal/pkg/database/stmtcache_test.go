@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// countingDriver counts prepares so the tests can see when a statement is reused.
+type countingDriver struct {
+	prepares atomic.Int64
+	// stale makes the next execution of a prepared statement fail like
+	// Postgres does after the schema changed under a cached plan.
+	stale atomic.Bool
+	// value is what every query returns.
+	value atomic.Int64
+}
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{d: d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.prepares.Add(1)
+	return &countingStmt{d: c.d}, nil
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return countingTx{}, nil }
+
+type countingTx struct{}
+
+func (countingTx) Commit() error   { return nil }
+func (countingTx) Rollback() error { return nil }
+
+type countingStmt struct{ d *countingDriver }
+
+func (s *countingStmt) Close() error  { return nil }
+func (s *countingStmt) NumInput() int { return -1 }
+func (s *countingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *countingStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.d.stale.CompareAndSwap(true, false) {
+		return nil, &pq.Error{Code: "0A000", Message: "cached plan must not change result type"}
+	}
+	return &countingRows{value: s.d.value.Load()}, nil
+}
+
+type countingRows struct {
+	value int64
+	done  bool
+}
+
+func (r *countingRows) Columns() []string { return []string{"id"} }
+func (r *countingRows) Close() error      { return nil }
+func (r *countingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+var (
+	registerOnce sync.Once
+	counting     = &countingDriver{}
+)
+
+func newCountingDatabase(t *testing.T) (*Database, *metricsdk.ManualReader) {
+	t.Helper()
+	registerOnce.Do(func() { sql.Register("counting", counting) })
+	counting.prepares.Store(0)
+	counting.value.Store(1)
+
+	conn, err := sql.Open("counting", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	reader := metricsdk.NewManualReader()
+	db := &Database{Conn: conn}
+	if err := db.RegisterMetrics(metricsdk.NewMeterProvider(metricsdk.WithReader(reader)).Meter("test")); err != nil {
+		t.Fatal(err)
+	}
+	db.EnableStatementCache()
+	return db, reader
+}
+
+func queryID(t *testing.T, db DBTX) {
+	t.Helper()
+	var id int64
+	if err := db.QueryRowContext(context.Background(), `SELECT id FROM users WHERE id=$1`, 1).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// statementCount is the number of cached statements of the primary.
+func (d *Database) statementCount() int {
+	d.statements.mu.RLock()
+	defer d.statements.mu.RUnlock()
+	return len(d.statements.stmts)
+}
+
+func lookups(t *testing.T, reader *metricsdk.ManualReader) (hits, misses int64) {
+	t.Helper()
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatal(err)
+	}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok || m.Name != "db.client.statement_cache.lookups" {
+				continue
+			}
+			for _, point := range sum.DataPoints {
+				if hit, _ := point.Attributes.Value("hit"); hit.AsBool() {
+					hits += point.Value
+				} else {
+					misses += point.Value
+				}
+			}
+		}
+	}
+	return hits, misses
+}
+
+func TestStatementCachePreparesOnce(t *testing.T) {
+	db, reader := newCountingDatabase(t)
+
+	for i := 0; i < 5; i++ {
+		queryID(t, db.Reader(context.Background()))
+	}
+
+	if n := counting.prepares.Load(); n != 1 {
+		t.Errorf("expected one prepare, got %d", n)
+	}
+	if hits, misses := lookups(t, reader); hits != 4 || misses != 1 {
+		t.Errorf("got %d hits and %d misses want 4 and 1", hits, misses)
+	}
+}
+
+func TestStatementCacheReusedInTransaction(t *testing.T) {
+	db, _ := newCountingDatabase(t)
+	queryID(t, db.Reader(context.Background()))
+
+	err := db.WithTx(context.Background(), func(ctx context.Context) error {
+		queryID(t, db.Executor(ctx))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := counting.prepares.Load(); n != 1 {
+		t.Errorf("expected the transaction to reuse the statement, got %d prepares", n)
+	}
+}
+
+func TestInvalidateStatementsPreparesAgain(t *testing.T) {
+	db, _ := newCountingDatabase(t)
+	queryID(t, db.Reader(context.Background()))
+
+	db.InvalidateStatements()
+	queryID(t, db.Reader(context.Background()))
+
+	if n := counting.prepares.Load(); n != 2 {
+		t.Errorf("expected a new prepare after invalidation, got %d", n)
+	}
+}
+
+func TestStaleStatementIsRetried(t *testing.T) {
+	db, _ := newCountingDatabase(t)
+	queryID(t, db.Reader(context.Background()))
+
+	counting.stale.Store(true)
+	queryID(t, db.Reader(context.Background()))
+
+	if len(db.statements.stmts) != 0 {
+		t.Error("expected the stale statement to be dropped from the cache")
+	}
+}
+
+func TestWatchSchemaDropsStatementsAfterMigrating(t *testing.T) {
+	db, _ := newCountingDatabase(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.WatchSchema(ctx, 5*time.Millisecond)
+
+	time.Sleep(20 * time.Millisecond)
+	queryID(t, db.Reader(context.Background()))
+	time.Sleep(20 * time.Millisecond)
+	if n := db.statementCount(); n != 1 {
+		t.Fatalf("expected the statement to stay cached while the schema is unchanged, got %d", n)
+	}
+
+	// A migration bumps the version reported by _migrations.
+	counting.value.Store(2)
+	deadline := time.Now().Add(2 * time.Second)
+	for db.statementCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the statements to be dropped after the schema changed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx so repositories can run
+// the same queries inside or outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Transactor runs a unit of work in a transaction. *Database implements it;
+// usecases depend on the interface so they can be tested without Postgres.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// maxTxAttempts bounds how often a transaction is retried after a serialization failure or deadlock.
+const maxTxAttempts = 3
+
+type txKey struct{}
+
+type txState struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+// Executor returns the transaction carried by ctx, or the primary when there
+// is none. Use it for writes: later reads made with ctx are pinned to the
+// primary so they see the write. Read-only queries should use Reader.
+func (d *Database) Executor(ctx context.Context) DBTX {
+	PinPrimary(ctx)
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return d.primary(state.tx)
+	}
+	return d.primary(d.Conn)
+}
+
+// primary wraps the pool or a transaction on the primary.
+func (d *Database) primary(db DBTX) tracedDB {
+	return tracedDB{db: db, d: d, node: "primary", stmts: d.statements}
+}
+
+// InTx reports whether ctx carries a transaction.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*txState)
+	return ok
+}
+
+// WithTx runs fn in a transaction carried through ctx. Repositories called with
+// that ctx join the transaction. A nested call runs inside a savepoint, so its
+// failure only rolls back its own work. The outermost transaction is retried
+// when Postgres reports a serialization failure or deadlock.
+func (d *Database) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.WithTxOptions(ctx, nil, fn)
+}
+
+// WithTxOptions is WithTx with explicit isolation level and read-only flag for the outermost transaction.
+func (d *Database) WithTxOptions(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return withSavepoint(ctx, state, fn)
+	}
+	PinPrimary(ctx)
+
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = d.runTx(ctx, opts, fn)
+		if !isRetryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+func (d *Database) runTx(ctx context.Context, opts *sql.TxOptions, fn func(ctx context.Context) error) (err error) {
+	tx, err := d.Conn.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(context.WithValue(ctx, txKey{}, &txState{tx: tx})); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func withSavepoint(ctx context.Context, state *txState, fn func(ctx context.Context) error) (err error) {
+	state.savepoints++
+	name := fmt.Sprintf("sp_%d", state.savepoints)
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("could not create savepoint: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	if err = fn(ctx); err != nil {
+		if _, rbErr := state.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	_, err = state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// isRetryable reports whether err is a serialization failure or deadlock.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -3,13 +3,13 @@ package httpresponse
 import (
 	"context"
 	"net/http"
-	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/pkg/cache"
 
 	"github.com/bytedance/sonic"
 )
 
 type Response struct {
-	Cache *redis.Cache
+	Cache cache.Cache
 }
 
 func (r Response) SetMarshal(ctx context.Context, w http.ResponseWriter, statusCode int, response interface{}, key string) {
@@ -22,7 +22,7 @@ func (r Response) SetMarshal(ctx context.Context, w http.ResponseWriter, statusC
 	w.WriteHeader(statusCode)
 	w.Write(data)
 	if len(key) > 0 {
-		r.Cache.Add(ctx, key, data)
+		r.Cache.Set(ctx, key, data, 0)
 	}
 }
 
@@ -13,12 +13,15 @@ type MyCustomClaims struct {
 	jwt.RegisteredClaims
 }
 
-var mySigningKey = []byte(os.Getenv("TOKEN_SALT"))
+// signingKey is read on use: the CLI loads .env after package initialization.
+func signingKey() []byte {
+	return []byte(os.Getenv("TOKEN_SALT"))
+}
 
 // ValidateToken for check token validation
 func ValidateToken(myToken string) (bool, string) {
 	token, err := jwt.ParseWithClaims(myToken, &MyCustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(mySigningKey), nil
+		return signingKey(), nil
 	})
 
 	if err != nil {
@@ -31,15 +34,20 @@ func ValidateToken(myToken string) (bool, string) {
 
 // ClaimToken function
 func ClaimToken(email string) (string, error) {
+	return ClaimTokenFor(email, time.Hour*1)
+}
+
+// ClaimTokenFor signs a token for email that expires after ttl.
+func ClaimTokenFor(email string, ttl time.Duration) (string, error) {
 	claims := MyCustomClaims{
 		email,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 1)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign the token with our secret
-	return token.SignedString(mySigningKey)
+	return token.SignedString(signingKey())
 }
@@ -0,0 +1,80 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Elector keeps one instance at a time as leader by holding a named lock.
+type Elector struct {
+	locker   *Locker
+	name     string
+	ttl      time.Duration
+	isLeader atomic.Bool
+}
+
+// NewElector creates an Elector campaigning for the lock called name.
+func NewElector(locker *Locker, name string, ttl time.Duration) *Elector {
+	return &Elector{locker: locker, name: name, ttl: ttl}
+}
+
+// Run campaigns until ctx is done. While this instance is leader every job
+// runs with a context that is cancelled when leadership is lost; Run waits
+// for the jobs to return before campaigning again.
+func (e *Elector) Run(ctx context.Context, jobs ...func(ctx context.Context)) {
+	for {
+		lk, err := e.locker.Acquire(ctx, e.name, e.ttl)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.ttl / 3):
+			}
+			continue
+		}
+
+		e.lead(ctx, lk, jobs)
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (e *Elector) lead(ctx context.Context, lk *Lock, jobs []func(ctx context.Context)) {
+	e.isLeader.Store(true)
+	defer e.isLeader.Store(false)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job func(ctx context.Context)) {
+			defer wg.Done()
+			job(leaderCtx)
+		}(job)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-lk.Lost():
+	}
+	cancel()
+	wg.Wait()
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer releaseCancel()
+	lk.Release(releaseCtx)
+}
+
+// IsLeader reports whether this instance currently holds leadership.
+func (e *Elector) IsLeader() bool {
+	return e.isLeader.Load()
+}
+
+// Leader returns the owner of the leadership lock, or an empty string when there is none.
+func (e *Elector) Leader(ctx context.Context) (string, error) {
+	return e.locker.Holder(ctx, e.name)
+}
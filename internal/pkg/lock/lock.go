@@ -0,0 +1,214 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// ErrNotHeld is returned when a lock is released or renewed by someone who no longer owns it.
+var ErrNotHeld = errors.New("lock is not held")
+
+// acquireScript sets the lock and bumps its fencing counter in one step.
+// Both keys share a hash tag so they live in the same cluster slot.
+var acquireScript = redis.NewScript(`
+if redis.call('set', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('incr', KEYS[2])
+end
+return 0`)
+
+var renewScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('pexpire', KEYS[1], ARGV[2])
+end
+return 0`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('del', KEYS[1])
+end
+return 0`)
+
+// Locker hands out distributed locks stored in Redis.
+type Locker struct {
+	client redis.UniversalClient
+	owner  string
+}
+
+// NewLocker creates a Locker. Locks it takes are tagged with the host name and
+// a random id so the holder can be identified from any instance.
+func NewLocker(client redis.UniversalClient) *Locker {
+	host, _ := os.Hostname()
+	return &Locker{client: client, owner: host + "-" + uuid.NewString()[:8]}
+}
+
+// Owner identifies this instance in lock values.
+func (l *Locker) Owner() string {
+	return l.owner
+}
+
+// Lock is a held lock. It is renewed in the background until released or lost.
+type Lock struct {
+	locker *Locker
+	name   string
+	token  string
+	ttl    time.Duration
+	// Fence increases every time the lock is acquired. Pass it to the
+	// protected resource so writes from a stale holder can be rejected.
+	Fence int64
+
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func key(name string) string {
+	return "locks.{" + name + "}"
+}
+
+// TryAcquire takes the lock if it is free. It returns nil without error when someone else holds it.
+func (l *Locker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token := l.owner + "/" + uuid.NewString()
+	fence, err := acquireScript.Run(ctx, l.client, []string{key(name), key(name) + ".fence"}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire lock %s: %w", name, err)
+	}
+	if fence == 0 {
+		return nil, nil
+	}
+
+	lk := &Lock{
+		locker: l,
+		name:   name,
+		token:  token,
+		ttl:    ttl,
+		Fence:  fence,
+		lost:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go lk.renew()
+
+	return lk, nil
+}
+
+// Acquire waits until the lock is taken or ctx is done.
+func (l *Locker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	retry := ttl / 10
+	if retry < 50*time.Millisecond {
+		retry = 50 * time.Millisecond
+	}
+
+	for {
+		lk, err := l.TryAcquire(ctx, name, ttl)
+		if err != nil || lk != nil {
+			return lk, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// Holder returns the owner of the named lock, or an empty string when it is free.
+func (l *Locker) Holder(ctx context.Context, name string) (string, error) {
+	value, err := l.client.Get(ctx, key(name)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	owner, _, _ := strings.Cut(value, "/")
+	return owner, nil
+}
+
+// WithLock runs fn while holding the lock. The context passed to fn is
+// cancelled if the lock is lost, and the lock is released when fn returns.
+func (l *Locker) WithLock(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lk, err := l.Acquire(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lk.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	fnErr := fn(ctx)
+
+	releaseCtx, releaseCancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer releaseCancel()
+	if err := lk.Release(releaseCtx); err != nil && fnErr == nil && !errors.Is(err, ErrNotHeld) {
+		return err
+	}
+	return fnErr
+}
+
+// Lost is closed when the lock could not be renewed and may now be held by someone else.
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Release stops renewing and deletes the lock if it is still ours.
+func (lk *Lock) Release(ctx context.Context) error {
+	lk.stopOnce.Do(func() { close(lk.stop) })
+	<-lk.done
+
+	n, err := releaseScript.Run(ctx, lk.locker.client, []string{key(lk.name)}, lk.token).Int64()
+	if err != nil {
+		return fmt.Errorf("could not release lock %s: %w", lk.name, err)
+	}
+	if n == 0 {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+func (lk *Lock) renew() {
+	defer close(lk.done)
+
+	ticker := time.NewTicker(lk.ttl / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-lk.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), lk.ttl/3)
+			n, err := renewScript.Run(ctx, lk.locker.client, []string{key(lk.name)}, lk.token, lk.ttl.Milliseconds()).Int64()
+			cancel()
+
+			// A failed call is retried on the next tick as long as the last
+			// renewal still covers us. A zero reply means the key is gone.
+			if err == nil && n == 1 {
+				renewed = time.Now()
+				continue
+			}
+			if (err == nil && n == 0) || time.Since(renewed) >= lk.ttl {
+				lk.lostOnce.Do(func() { close(lk.lost) })
+				return
+			}
+		}
+	}
+}
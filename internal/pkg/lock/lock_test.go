@@ -0,0 +1,143 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestLocker(t *testing.T) (*Locker, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewLocker(client), srv
+}
+
+func TestTryAcquireIsExclusive(t *testing.T) {
+	ctx := context.Background()
+	locker, _ := newTestLocker(t)
+
+	first, err := locker.TryAcquire(ctx, "sync", time.Second)
+	if err != nil || first == nil {
+		t.Fatalf("expected first acquire to succeed, got %v, %v", first, err)
+	}
+
+	second, err := locker.TryAcquire(ctx, "sync", time.Second)
+	if err != nil || second != nil {
+		t.Fatalf("expected second acquire to fail, got %v, %v", second, err)
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := locker.TryAcquire(ctx, "sync", time.Second)
+	if err != nil || third == nil {
+		t.Fatalf("expected acquire after release to succeed, got %v, %v", third, err)
+	}
+	if third.Fence <= first.Fence {
+		t.Errorf("expected fence to increase, got %d after %d", third.Fence, first.Fence)
+	}
+	third.Release(ctx)
+}
+
+func TestReleaseAfterExpiryIsRejected(t *testing.T) {
+	ctx := context.Background()
+	locker, srv := newTestLocker(t)
+
+	lk, _ := locker.TryAcquire(ctx, "sync", time.Hour)
+	srv.FastForward(2 * time.Hour)
+
+	other, _ := locker.TryAcquire(ctx, "sync", time.Hour)
+	if other == nil {
+		t.Fatal("expected expired lock to be free")
+	}
+
+	if err := lk.Release(ctx); !errors.Is(err, ErrNotHeld) {
+		t.Errorf("expected ErrNotHeld, got %v", err)
+	}
+	if owner, _ := locker.Holder(ctx, "sync"); owner != locker.Owner() {
+		t.Errorf("expected other lock to stay held, got holder %q", owner)
+	}
+	other.Release(ctx)
+}
+
+func TestLockIsRenewedAndLostSignal(t *testing.T) {
+	ctx := context.Background()
+	locker, srv := newTestLocker(t)
+
+	lk, _ := locker.TryAcquire(ctx, "sync", 150*time.Millisecond)
+	srv.FastForward(100 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if ttl := srv.TTL(key("sync")); ttl != 150*time.Millisecond {
+		t.Fatalf("expected renewal to reset the ttl, got %v", ttl)
+	}
+
+	srv.Del(key("sync"))
+	select {
+	case <-lk.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expected lost signal after key disappeared")
+	}
+}
+
+func TestElectorRunsJobsOnOneInstance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	locker, _ := newTestLocker(t)
+	a := NewElector(locker, "leader", 300*time.Millisecond)
+	b := NewElector(locker, "leader", 300*time.Millisecond)
+
+	var running int32
+	job := func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("job runs on more than one instance")
+		}
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+	}
+
+	go a.Run(ctx, job)
+	go b.Run(ctx, job)
+
+	time.Sleep(200 * time.Millisecond)
+	if a.IsLeader() == b.IsLeader() {
+		t.Fatalf("expected exactly one leader, got a=%v b=%v", a.IsLeader(), b.IsLeader())
+	}
+
+	leader, err := a.Leader(ctx)
+	if err != nil || !strings.HasPrefix(leader, locker.Owner()) {
+		t.Errorf("unexpected leader %q, %v", leader, err)
+	}
+}
+
+func TestElectorStopsWhileBackingOff(t *testing.T) {
+	locker, srv := newTestLocker(t)
+	srv.Close()
+	e := NewElector(locker, "leader", time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	// Acquire fails at once against the closed server, so Run is waiting
+	// out the backoff of ttl/3 when ctx is cancelled.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return when ctx is cancelled")
+	}
+}
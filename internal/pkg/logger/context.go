@@ -0,0 +1,43 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"rest-skeleton/internal/pkg/myctx"
+)
+
+// Context keys read by the logger. The values are set by the middleware:
+// traceID by TraceAndMetricLatency, user_id by Authentication and route by
+// the router.
+const (
+	keyTraceID = myctx.Key("traceID")
+	keyUserID  = myctx.Key("user_id")
+	keyRoute   = myctx.Key("route")
+)
+
+// contextHandler adds the trace id, user id and route found in the context
+// of an entry, so every entry of a request can be told apart.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if traceID, ok := ctx.Value(keyTraceID).(string); ok && traceID != "" {
+		record.AddAttrs(slog.String("trace_id", traceID))
+	}
+	if userID, ok := ctx.Value(keyUserID).(int64); ok && userID != 0 {
+		record.AddAttrs(slog.Int64("user_id", userID))
+	}
+	if route, ok := ctx.Value(keyRoute).(string); ok && route != "" {
+		record.AddAttrs(slog.String("route", route))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
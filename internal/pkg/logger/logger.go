@@ -3,91 +3,304 @@ package logger
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path"
-	"rest-skeleton/internal/pkg/myctx"
 	"runtime"
+	"sync"
 	"time"
 
-	"github.com/bytedance/sonic"
-	"github.com/grafana/loki-client-go/loki"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 )
 
+// Logger writes leveled, structured entries through log/slog. Entries logged
+// with the context of a request carry its trace id, user id and route.
 type Logger struct {
-	Log              *log.Logger
-	LokiClient       *loki.Client
-	Format           LoggerFormat
 	ErrorCountMetric metric.Int64Counter
+
+	handler slog.Handler
+	level   *slog.LevelVar
+	out     *output
+	loki    *lokiSink
+	file    *RotatingFile
+}
+
+// Options configure the entries a Logger writes.
+type Options struct {
+	Level slog.Level
+	// Format is "json" or "text".
+	Format string
+	// Loki pushes entries to Loki when its URL is set.
+	Loki LokiConfig
+	// File configures the log files written in production.
+	File RotateConfig
+}
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// OptionsFromEnv reads LOG_LEVEL (debug, info, warn or error, info by
+// default), LOG_FORMAT (json or text, json by default), the Loki
+// configuration and the rotation of log files.
+func OptionsFromEnv() (Options, error) {
+	opts := Options{Level: slog.LevelInfo, Format: FormatJSON}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := opts.Level.UnmarshalText([]byte(v)); err != nil {
+			return opts, fmt.Errorf("invalid LOG_LEVEL %q", v)
+		}
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		if v != FormatJSON && v != FormatText {
+			return opts, fmt.Errorf("invalid LOG_FORMAT %q, want json or text", v)
+		}
+		opts.Format = v
+	}
+
+	var err error
+	if opts.Loki, err = LokiConfigFromEnv(); err != nil {
+		return opts, err
+	}
+	opts.File, err = RotateConfigFromEnv()
+	return opts, err
 }
-type LoggerFormat struct {
-	Timestamp string `json:"timestamp"`
-	Level     string `json:"level"`
-	Message   string `json:"message"`
-	File      string `json:"file"`
-	Line      int    `json:"line"`
-	Context   string `json:"context"`
+
+// New logs to rotating files in production and to stdout otherwise, with
+// the options of the environment.
+func New() *Logger {
+	opts, err := OptionsFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log, err := Open(opts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return log
 }
 
-func New(filename string) *Logger {
+// Open logs to the rotating files of opts.File in production and to stdout
+// otherwise. With Loki configured, the files or stdout only receive the
+// entries Loki does not.
+func Open(opts Options) (*Logger, error) {
 	if os.Getenv("APP_ENV") == "production" {
-		file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		file, err := OpenRotating(opts.File)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+			return nil, err
 		}
-		return &Logger{Log: log.New(file, "", 0), LokiClient: nil}
+		log := newLogger(&output{w: file}, opts)
+		log.file = file
+		return log, nil
 	}
-	return &Logger{Log: log.New(os.Stdout, "", 0), LokiClient: nil}
+	return NewWriter(os.Stdout, opts), nil
 }
 
-func (l *Logger) Error(ctx context.Context, err error) error {
-	if ok := l.format(ctx, "ERROR", err.Error()); ok {
-		l.ErrorCountMetric.Add(ctx, 1)
-		message, _ := sonic.Marshal(l.Format)
-		l.Log.Println(string(message))
+// NewWriter logs to w.
+func NewWriter(w io.Writer, opts Options) *Logger {
+	return newLogger(&output{w: w}, opts)
+}
 
-		// span := trace.SpanFromContext(ctx)
-		_, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "Error")
-		defer span.End()
+func newLogger(out *output, opts Options) *Logger {
+	level := new(slog.LevelVar)
+	level.Set(opts.Level)
 
-		span.SetAttributes(attribute.String("error", err.Error()))
-		span.SetStatus(codes.Error, "Error handling request")
-		span.RecordError(err)
+	var w io.Writer = out
+	var sink *lokiSink
+	if opts.Loki.URL != "" {
+		sink = newLokiSink(opts.Loki, out)
+		w = sink
+	}
+
+	handlerOpts := &slog.HandlerOptions{AddSource: true, Level: level, ReplaceAttr: replaceAttr}
+	var handler slog.Handler
+	if opts.Format == FormatText {
+		handler = slog.NewTextHandler(w, handlerOpts)
 	} else {
-		l.Log.Println(err.Error())
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	}
+	if sink != nil {
+		handler = lokiHandler{handler, sink}
+	}
+	return &Logger{handler: contextHandler{handler}, level: level, out: out, loki: sink}
+}
+
+// replaceAttr keeps the field names of the entries written before slog:
+// timestamp, message and a short file:line source.
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		return slog.String("timestamp", a.Value.Time().UTC().Format(time.RFC3339))
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.SourceKey:
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			return slog.String("source", fmt.Sprintf("%s:%d", path.Base(src.File), src.Line))
+		}
+	}
+	return a
+}
+
+// With returns a child logger that adds args, as key/value pairs or
+// slog.Attr, to every entry. The child shares the level and output.
+func (l *Logger) With(args ...any) *Logger {
+	child := *l
+	child.handler = l.handler.WithAttrs(argsToAttrs(args))
+	return &child
+}
+
+// SetLevel changes the minimum level of the logger and of its children.
+func (l *Logger) SetLevel(level slog.Level) {
+	l.level.Set(level)
+}
+
+// Enabled reports whether entries of level are written.
+func (l *Logger) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.handler.Enabled(ctx, level)
+}
+
+// RegisterMetrics exports the number of entries that could not be pushed to
+// Loki and were written to the file or stdout instead.
+func (l *Logger) RegisterMetrics(meter metric.Meter) error {
+	if l.loki == nil {
+		return nil
 	}
+	_, err := meter.Int64ObservableCounter("log.loki.dropped",
+		metric.WithDescription("Log entries written to the fallback output instead of Loki"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(l.loki.dropped.Load())
+			return nil
+		}))
 	return err
 }
-func (l *Logger) Info(ctx context.Context, msg string) {
-	if ok := l.format(ctx, "INFO", msg); ok {
-		message, _ := sonic.Marshal(l.Format)
-		l.Log.Println(string(message))
-	} else {
-		l.Log.Println(msg)
+
+// Close pushes the entries waiting for Loki and waits for rotated log files
+// to be compressed. Entries logged afterwards are still written to the file
+// or stdout.
+func (l *Logger) Close(ctx context.Context) error {
+	if l.loki != nil {
+		if err := l.loki.close(ctx); err != nil {
+			return err
+		}
+	}
+	if l.file != nil {
+		done := make(chan struct{})
+		go func() {
+			l.file.pending.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Rotate starts the log file of a new day and removes old rotated files.
+// Loggers writing to stdout are left alone.
+func (l *Logger) Rotate() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Rotate()
+}
+
+// Reopen reopens the log file by name after it was moved away. Loggers
+// writing to stdout are left alone.
+func (l *Logger) Reopen() error {
+	if l.file == nil {
+		return nil
 	}
+	return l.file.Reopen()
 }
 
-func (l *Logger) Fatal(ctx context.Context, err error) {
-	l.Error(ctx, err)
+func (l *Logger) Debug(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelDebug, msg, args...)
+}
+
+func (l *Logger) Info(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelInfo, msg, args...)
+}
+
+func (l *Logger) Warn(ctx context.Context, msg string, args ...any) {
+	l.log(ctx, slog.LevelWarn, msg, args...)
+}
+
+// Error logs err, counts it and records it on a span, then returns it so
+// callers can write return l.Error(ctx, err).
+func (l *Logger) Error(ctx context.Context, err error, args ...any) error {
+	ctx = orBackground(ctx)
+	l.log(ctx, slog.LevelError, err.Error(), args...)
+	if l.ErrorCountMetric != nil {
+		l.ErrorCountMetric.Add(ctx, 1)
+	}
+
+	_, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "Error")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("error", err.Error()))
+	span.SetStatus(codes.Error, "Error handling request")
+	span.RecordError(err)
+	return err
+}
+
+func (l *Logger) Fatal(ctx context.Context, err error, args ...any) {
+	l.Error(ctx, err, args...)
 	os.Exit(1)
 }
 
-func (l *Logger) format(ctx context.Context, level string, msg string) bool {
-	_, file, line, ok := runtime.Caller(2)
-	if ok {
-		l.Format = LoggerFormat{
-			Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05Z"),
-			Level:     level,
-			Message:   msg,
-			File:      path.Base(file),
-			Line:      line,
-			Context:   ctx.Value(myctx.Key("traceID")).(string),
-		}
+// log writes an entry whose source is the caller of the exported method.
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	ctx = orBackground(ctx)
+	if !l.handler.Enabled(ctx, level) {
+		return
 	}
-	return ok
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(args...)
+	l.handler.Handle(ctx, record)
+}
+
+func orBackground(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	var record slog.Record
+	record.Add(args...)
+	attrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// output is the writer shared by a logger and its children. It serializes
+// writes so entries never interleave.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.w.Write(p)
 }
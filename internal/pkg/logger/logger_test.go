@@ -0,0 +1,160 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// entries decodes the JSON lines written to buf.
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid JSON entry %q: %v", line, err)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelWarn, Format: FormatJSON})
+	child := log.With("component", "test")
+
+	log.Debug(context.Background(), "debug")
+	log.Info(context.Background(), "info")
+	child.Warn(context.Background(), "warn")
+	if got := entries(t, &buf); len(got) != 1 || got[0]["message"] != "warn" {
+		t.Fatalf("expected only the warning, got %v", got)
+	}
+
+	buf.Reset()
+	log.SetLevel(slog.LevelDebug)
+	child.Debug(context.Background(), "debug")
+	if got := entries(t, &buf); len(got) != 1 || got[0]["level"] != "DEBUG" {
+		t.Fatalf("expected SetLevel to reach the child, got %v", got)
+	}
+}
+
+func TestContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelInfo, Format: FormatJSON}).With("component", "users")
+
+	ctx := context.WithValue(context.Background(), keyTraceID, "abc123")
+	ctx = context.WithValue(ctx, keyUserID, int64(7))
+	ctx = context.WithValue(ctx, keyRoute, "GET /users/:id")
+	log.Info(ctx, "audit", "action", "user updated")
+
+	got := entries(t, &buf)
+	if len(got) != 1 {
+		t.Fatalf("expected one entry, got %v", got)
+	}
+	entry := got[0]
+	want := map[string]any{
+		"message":   "audit",
+		"trace_id":  "abc123",
+		"user_id":   float64(7),
+		"route":     "GET /users/:id",
+		"component": "users",
+		"action":    "user updated",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["timestamp"].(string); !ok {
+		t.Errorf("expected a timestamp in %v", entry)
+	}
+	if source, _ := entry["source"].(string); !strings.HasPrefix(source, "logger_test.go:") {
+		t.Errorf("expected the caller as source, got %q", source)
+	}
+}
+
+func TestMissingOrMistypedContextValues(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelInfo, Format: FormatJSON})
+
+	ctx := context.WithValue(context.Background(), keyTraceID, 42)
+	log.Info(ctx, "no trace")
+	log.Info(nil, "no context")
+
+	for _, entry := range entries(t, &buf) {
+		if _, ok := entry["trace_id"]; ok {
+			t.Errorf("expected no trace_id in %v", entry)
+		}
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelInfo, Format: FormatText})
+
+	log.Info(context.WithValue(context.Background(), keyTraceID, "abc123"), "started", "port", 8081)
+
+	line := buf.String()
+	for _, want := range []string{"level=INFO", "message=started", "trace_id=abc123", "port=8081"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %s in %q", want, line)
+		}
+	}
+}
+
+func TestErrorReturnsErr(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelInfo, Format: FormatJSON})
+
+	err := errors.New("boom")
+	if got := log.Error(context.Background(), err, "id", 3); got != err {
+		t.Fatalf("expected the error back, got %v", got)
+	}
+	if got := entries(t, &buf); len(got) != 1 || got[0]["message"] != "boom" || got[0]["level"] != "ERROR" {
+		t.Fatalf("unexpected entries %v", got)
+	}
+}
+
+func TestConcurrentLogging(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewWriter(&buf, Options{Level: slog.LevelInfo, Format: FormatJSON})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			log.With("worker", i).Info(context.Background(), "tick")
+			log.SetLevel(slog.LevelInfo)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := entries(t, &buf); len(got) != 20 {
+		t.Fatalf("expected 20 whole entries, got %d", len(got))
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "text")
+	opts, err := OptionsFromEnv()
+	if err != nil || opts.Level != slog.LevelDebug || opts.Format != FormatText {
+		t.Fatalf("unexpected options %+v, %v", opts, err)
+	}
+
+	t.Setenv("LOG_FORMAT", "xml")
+	if _, err := OptionsFromEnv(); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
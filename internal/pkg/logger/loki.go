@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LokiConfig configures pushing entries straight to Loki. A Logger with an
+// empty URL does not push.
+type LokiConfig struct {
+	// URL is the push endpoint, e.g. http://localhost:3100/loki/api/v1/push.
+	URL string
+	// Labels are added to every stream next to level and route.
+	Labels map[string]string
+	// A batch is pushed once it holds BatchSize entries or BatchWait after
+	// its first entry.
+	BatchSize int
+	BatchWait time.Duration
+	// BufferSize bounds the entries waiting to be pushed.
+	BufferSize int
+	Client     *http.Client
+}
+
+// LokiConfigFromEnv reads LOKI_PUSH, LOKI_URL, LOKI_BATCH_SIZE,
+// LOKI_BATCH_WAIT and LOKI_BUFFER_SIZE. Streams are labelled with APP_NAME
+// and APP_ENV. Without LOKI_PUSH=true the URL is left empty.
+func LokiConfigFromEnv() (LokiConfig, error) {
+	cfg := LokiConfig{
+		Labels:     map[string]string{"app": os.Getenv("APP_NAME"), "env": os.Getenv("APP_ENV")},
+		BatchSize:  500,
+		BatchWait:  time.Second,
+		BufferSize: 10000,
+	}
+	push, err := strconv.ParseBool(cmp.Or(os.Getenv("LOKI_PUSH"), "false"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid LOKI_PUSH: %w", err)
+	}
+	if !push {
+		return cfg, nil
+	}
+
+	cfg.URL = os.Getenv("LOKI_URL")
+	if cfg.URL == "" {
+		return cfg, fmt.Errorf("LOKI_URL is required with LOKI_PUSH")
+	}
+	for name, value := range map[string]*int{"LOKI_BATCH_SIZE": &cfg.BatchSize, "LOKI_BUFFER_SIZE": &cfg.BufferSize} {
+		if v := os.Getenv(name); v != "" {
+			if *value, err = strconv.Atoi(v); err != nil || *value < 1 {
+				return cfg, fmt.Errorf("%s must be a positive number, got %q", name, v)
+			}
+		}
+	}
+	if v := os.Getenv("LOKI_BATCH_WAIT"); v != "" {
+		if cfg.BatchWait, err = time.ParseDuration(v); err != nil || cfg.BatchWait <= 0 {
+			return cfg, fmt.Errorf("invalid LOKI_BATCH_WAIT %q", v)
+		}
+	}
+	return cfg, nil
+}
+
+// lokiEntry is a formatted line with the labels of its stream.
+type lokiEntry struct {
+	level string
+	route string
+	time  time.Time
+	line  string
+}
+
+// lokiSink batches entries and pushes them to Loki in the background.
+// Entries that do not fit in the buffer, or whose push fails, are written to
+// the fallback output instead and counted as dropped.
+type lokiSink struct {
+	cfg      LokiConfig
+	fallback io.Writer
+	entries  chan lokiEntry
+	done     chan struct{}
+	dropped  atomic.Int64
+
+	// mu pairs the labels set by lokiHandler with the line the wrapped
+	// handler writes, and orders writes with close.
+	mu      sync.Mutex
+	current lokiEntry
+	closed  bool
+}
+
+func newLokiSink(cfg LokiConfig, fallback io.Writer) *lokiSink {
+	cfg.BatchSize = cmp.Or(cfg.BatchSize, 500)
+	cfg.BatchWait = cmp.Or(cfg.BatchWait, time.Second)
+	cfg.BufferSize = cmp.Or(cfg.BufferSize, 10000)
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	s := &lokiSink{
+		cfg:      cfg,
+		fallback: fallback,
+		entries:  make(chan lokiEntry, cfg.BufferSize),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write queues the line formatted for the current entry. It is called by
+// the wrapped handler while lokiHandler holds mu.
+func (s *lokiSink) Write(p []byte) (int, error) {
+	entry := s.current
+	entry.line = strings.TrimSuffix(string(p), "\n")
+	if s.closed {
+		return s.fallback.Write(p)
+	}
+
+	select {
+	case s.entries <- entry:
+	default:
+		s.dropped.Add(1)
+		return s.fallback.Write(p)
+	}
+	return len(p), nil
+}
+
+func (s *lokiSink) run() {
+	defer close(s.done)
+
+	timer := time.NewTimer(s.cfg.BatchWait)
+	timer.Stop()
+	var batch []lokiEntry
+	for {
+		select {
+		case entry, ok := <-s.entries:
+			if !ok {
+				s.push(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(s.cfg.BatchWait)
+			}
+			batch = append(batch, entry)
+			if len(batch) >= s.cfg.BatchSize {
+				timer.Stop()
+				s.push(batch)
+				batch = nil
+			}
+		case <-timer.C:
+			s.push(batch)
+			batch = nil
+		}
+	}
+}
+
+// push sends batch, grouped in streams by labels, and falls back when Loki
+// cannot be reached or rejects it.
+func (s *lokiSink) push(batch []lokiEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.send(batch); err != nil {
+		s.dropped.Add(int64(len(batch)))
+		var lines bytes.Buffer
+		for _, entry := range batch {
+			lines.WriteString(entry.line + "\n")
+		}
+		s.fallback.Write(lines.Bytes())
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *lokiSink) send(batch []lokiEntry) error {
+	var streams []*lokiStream
+	byLabels := map[[2]string]*lokiStream{}
+	for _, entry := range batch {
+		key := [2]string{entry.level, entry.route}
+		stream, ok := byLabels[key]
+		if !ok {
+			stream = &lokiStream{Stream: map[string]string{"level": entry.level}}
+			for name, value := range s.cfg.Labels {
+				if value != "" {
+					stream.Stream[name] = value
+				}
+			}
+			if entry.route != "" {
+				stream.Stream["route"] = entry.route
+			}
+			byLabels[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), entry.line})
+	}
+
+	body, err := json.Marshal(map[string]any{"streams": streams})
+	if err != nil {
+		return err
+	}
+	resp, err := s.cfg.Client.Post(s.cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("loki push: %s", resp.Status)
+	}
+	return nil
+}
+
+// close pushes the queued entries. Entries written afterwards go to the
+// fallback output.
+func (s *lokiSink) close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.entries)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lokiHandler sets the labels of the entry its wrapped handler writes to
+// the sink.
+type lokiHandler struct {
+	slog.Handler
+	sink *lokiSink
+}
+
+func (h lokiHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.sink.mu.Lock()
+	defer h.sink.mu.Unlock()
+
+	route, _ := ctx.Value(keyRoute).(string)
+	h.sink.current = lokiEntry{level: strings.ToLower(record.Level.String()), route: route, time: record.Time}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h lokiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return lokiHandler{h.Handler.WithAttrs(attrs), h.sink}
+}
+
+func (h lokiHandler) WithGroup(name string) slog.Handler {
+	return lokiHandler{h.Handler.WithGroup(name), h.sink}
+}
@@ -0,0 +1,201 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lokiStandIn records the streams pushed to it.
+type lokiStandIn struct {
+	mu      sync.Mutex
+	pushes  int
+	streams []lokiStream
+	status  int
+}
+
+func (l *lokiStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pushes++
+	if l.status != 0 {
+		w.WriteHeader(l.status)
+		return
+	}
+	l.streams = append(l.streams, body.Streams...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (l *lokiStandIn) values() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, stream := range l.streams {
+		n += len(stream.Values)
+	}
+	return n
+}
+
+func newLokiLogger(t *testing.T, standIn *lokiStandIn, cfg LokiConfig) (*Logger, *bytes.Buffer) {
+	t.Helper()
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	cfg.URL = server.URL
+	var fallback bytes.Buffer
+	log := NewWriter(&fallback, Options{Level: slog.LevelInfo, Format: FormatJSON, Loki: cfg})
+	return log, &fallback
+}
+
+func TestLokiPushesLabelledStreams(t *testing.T) {
+	standIn := &lokiStandIn{}
+	log, fallback := newLokiLogger(t, standIn, LokiConfig{
+		Labels:    map[string]string{"app": "skeleton", "env": "test"},
+		BatchSize: 3,
+		BatchWait: time.Hour,
+	})
+
+	ctx := context.WithValue(context.Background(), keyRoute, "GET /users")
+	log.Info(ctx, "listed")
+	log.Warn(ctx, "slow")
+	log.Info(context.Background(), "started")
+	if err := log.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if standIn.pushes != 1 {
+		t.Fatalf("expected the entries in one batch, got %d pushes", standIn.pushes)
+	}
+	if len(standIn.streams) != 3 {
+		t.Fatalf("expected a stream per level and route, got %+v", standIn.streams)
+	}
+	first := standIn.streams[0]
+	want := map[string]string{"app": "skeleton", "env": "test", "level": "info", "route": "GET /users"}
+	for name, value := range want {
+		if first.Stream[name] != value {
+			t.Errorf("expected label %s=%s, got %v", name, value, first.Stream)
+		}
+	}
+	if _, ok := standIn.streams[2].Stream["route"]; ok {
+		t.Errorf("expected no route label outside a request, got %v", standIn.streams[2].Stream)
+	}
+	if line := first.Values[0][1]; !strings.Contains(line, `"message":"listed"`) {
+		t.Errorf("expected the formatted entry as line, got %s", line)
+	}
+	if fallback.Len() != 0 {
+		t.Errorf("expected nothing in the fallback, got %s", fallback.String())
+	}
+}
+
+func TestLokiFlushesOnClose(t *testing.T) {
+	standIn := &lokiStandIn{}
+	log, _ := newLokiLogger(t, standIn, LokiConfig{BatchSize: 100, BatchWait: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		log.With("i", i).Info(context.Background(), "pending")
+	}
+	if err := log.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := standIn.values(); n != 5 {
+		t.Fatalf("expected 5 entries pushed on close, got %d", n)
+	}
+}
+
+func TestLokiBatchWait(t *testing.T) {
+	standIn := &lokiStandIn{}
+	log, _ := newLokiLogger(t, standIn, LokiConfig{BatchSize: 100, BatchWait: 10 * time.Millisecond})
+	defer log.Close(context.Background())
+
+	log.Info(context.Background(), "waiting")
+	deadline := time.Now().Add(2 * time.Second)
+	for standIn.values() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the batch to be pushed after BatchWait")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLokiFallsBackWhenRejected(t *testing.T) {
+	standIn := &lokiStandIn{status: http.StatusServiceUnavailable}
+	log, fallback := newLokiLogger(t, standIn, LokiConfig{BatchSize: 2, BatchWait: time.Hour})
+
+	log.Info(context.Background(), "first")
+	log.Info(context.Background(), "second")
+	log.Close(context.Background())
+
+	if got := log.loki.dropped.Load(); got != 2 {
+		t.Errorf("expected 2 dropped entries, got %d", got)
+	}
+	if got := entries(t, fallback); len(got) != 2 || got[0]["message"] != "first" {
+		t.Errorf("expected the entries in the fallback, got %v", got)
+	}
+}
+
+func TestLokiFallsBackWhenBufferIsFull(t *testing.T) {
+	var fallback bytes.Buffer
+	// The sink is not running, so nothing drains the buffer of one entry.
+	sink := &lokiSink{cfg: LokiConfig{BatchSize: 10}, fallback: &fallback, entries: make(chan lokiEntry, 1)}
+	log := NewWriter(&fallback, Options{Level: slog.LevelInfo, Format: FormatJSON})
+	handler := lokiHandler{slog.NewJSONHandler(sink, nil), sink}
+	log.handler = contextHandler{handler}
+
+	log.Info(context.Background(), "buffered")
+	log.Info(context.Background(), "spilled")
+
+	if got := sink.dropped.Load(); got != 1 {
+		t.Errorf("expected 1 dropped entry, got %d", got)
+	}
+	if !strings.Contains(fallback.String(), "spilled") || strings.Contains(fallback.String(), "buffered") {
+		t.Errorf("expected only the spilled entry in the fallback, got %s", fallback.String())
+	}
+}
+
+func TestLokiWritesToFallbackAfterClose(t *testing.T) {
+	standIn := &lokiStandIn{}
+	log, fallback := newLokiLogger(t, standIn, LokiConfig{})
+	log.Close(context.Background())
+
+	log.Info(context.Background(), "late")
+	if !strings.Contains(fallback.String(), "late") {
+		t.Errorf("expected the entry in the fallback, got %q", fallback.String())
+	}
+}
+
+func TestLokiConfigFromEnv(t *testing.T) {
+	t.Setenv("LOKI_URL", "http://localhost:3100/loki/api/v1/push")
+	t.Setenv("LOKI_PUSH", "")
+	cfg, err := LokiConfigFromEnv()
+	if err != nil || cfg.URL != "" {
+		t.Fatalf("expected pushing to be off by default, got %+v, %v", cfg, err)
+	}
+
+	t.Setenv("LOKI_PUSH", "true")
+	t.Setenv("LOKI_BATCH_WAIT", "250ms")
+	t.Setenv("APP_NAME", "skeleton")
+	cfg, err = LokiConfigFromEnv()
+	if err != nil || cfg.URL == "" || cfg.BatchWait != 250*time.Millisecond || cfg.Labels["app"] != "skeleton" {
+		t.Fatalf("unexpected config %+v, %v", cfg, err)
+	}
+
+	t.Setenv("LOKI_BUFFER_SIZE", "0")
+	if _, err := LokiConfigFromEnv(); err == nil {
+		t.Error("expected an error for an empty buffer")
+	}
+}
@@ -0,0 +1,327 @@
+package logger
+
+import (
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateConfig configures a set of rotating log files.
+type RotateConfig struct {
+	Dir string
+	// Prefix names the files <prefix>-<date>.log, api by default.
+	Prefix string
+	// MaxSize rotates the file of the day once it would grow past it. Zero
+	// rotates by date only.
+	MaxSize int64
+	// Rotated files older than MaxAge are removed, and only the MaxFiles
+	// newest are kept. Zero keeps them all.
+	MaxAge   time.Duration
+	MaxFiles int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// RotateConfigFromEnv reads LOG_DIR, LOG_MAX_SIZE_MB, LOG_MAX_AGE,
+// LOG_MAX_FILES and LOG_COMPRESS.
+func RotateConfigFromEnv() (RotateConfig, error) {
+	cfg := RotateConfig{
+		Dir:      cmp.Or(os.Getenv("LOG_DIR"), "log"),
+		MaxSize:  100 << 20,
+		MaxAge:   14 * 24 * time.Hour,
+		MaxFiles: 30,
+		Compress: true,
+	}
+	if v := os.Getenv("LOG_MAX_SIZE_MB"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid LOG_MAX_SIZE_MB %q", v)
+		}
+		cfg.MaxSize = n << 20
+	}
+	if v := os.Getenv("LOG_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid LOG_MAX_AGE %q", v)
+		}
+		cfg.MaxAge = d
+	}
+	if v := os.Getenv("LOG_MAX_FILES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid LOG_MAX_FILES %q", v)
+		}
+		cfg.MaxFiles = n
+	}
+	if v := os.Getenv("LOG_COMPRESS"); v != "" {
+		compress, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LOG_COMPRESS %q", v)
+		}
+		cfg.Compress = compress
+	}
+	return cfg, nil
+}
+
+// DailyFile is the log file for the day of t.
+func (cfg RotateConfig) DailyFile(t time.Time) string {
+	return filepath.Join(cfg.Dir, cmp.Or(cfg.Prefix, "api")+"-"+t.Format("2006-01-02")+".log")
+}
+
+// RotatingFile writes to the DailyFile of the current day. It switches to a
+// new file when the day changes or the file reaches MaxSize, and compresses
+// and prunes rotated files in the background. Rotation happens between
+// writes, so every line lands whole in exactly one file.
+type RotatingFile struct {
+	cfg RotateConfig
+	now func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	day  string
+	size int64
+
+	// cleanup serializes compressing and pruning rotated files.
+	cleanup sync.Mutex
+	pending sync.WaitGroup
+}
+
+// OpenRotating opens the file of the current day in cfg.Dir, appending to it
+// when it exists.
+func OpenRotating(cfg RotateConfig) (*RotatingFile, error) {
+	return openRotating(cfg, time.Now)
+}
+
+func openRotating(cfg RotateConfig, now func() time.Time) (*RotatingFile, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{cfg: cfg, now: now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if err := r.rotateIfDue(int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate switches to the file of the new day if the day changed, then
+// compresses and prunes the rotated files. The writer does the same on its
+// own; Rotate covers days without a single entry.
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	err := r.rotateIfDue(0)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.clean()
+}
+
+// Reopen closes the file and opens it again by name, for tools such as
+// logrotate that move the file away and signal the process. Lines written
+// before Reopen stay in the moved file.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close closes the file and waits for rotated files to be compressed.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+
+	r.pending.Wait()
+	return err
+}
+
+// rotateIfDue rotates before a write of n bytes when the day changed or the
+// write would take the file past MaxSize. It is called with mu held.
+func (r *RotatingFile) rotateIfDue(n int64) error {
+	dayChanged := r.now().Format("2006-01-02") != r.day
+	full := r.cfg.MaxSize > 0 && r.size > 0 && r.size+n > r.cfg.MaxSize
+	if !dayChanged && !full {
+		return nil
+	}
+
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if !dayChanged {
+		// Keep the name of the day for the new file and number the full one.
+		name := r.file.Name()
+		if err := os.Rename(name, r.numbered(name)); err != nil {
+			return err
+		}
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		if err := r.clean(); err != nil {
+			fmt.Fprintln(os.Stderr, "log rotation:", err)
+		}
+	}()
+	return nil
+}
+
+// open opens the file of the current day. It is called with mu held.
+func (r *RotatingFile) open() error {
+	now := r.now()
+	file, err := os.OpenFile(r.cfg.DailyFile(now), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.day, r.size = file, now.Format("2006-01-02"), info.Size()
+	return nil
+}
+
+// numbered is the first free name <prefix>-<date>.<n>.log for a full file.
+func (r *RotatingFile) numbered(name string) string {
+	base := strings.TrimSuffix(name, ".log")
+	for i := 1; ; i++ {
+		candidate := base + "." + strconv.Itoa(i) + ".log"
+		if !exists(candidate) && !exists(candidate+".gz") {
+			return candidate
+		}
+	}
+}
+
+// clean compresses the rotated files, then removes those past MaxAge and
+// MaxFiles.
+func (r *RotatingFile) clean() error {
+	r.cleanup.Lock()
+	defer r.cleanup.Unlock()
+
+	r.mu.Lock()
+	active := r.cfg.DailyFile(r.now())
+	if r.file != nil {
+		active = r.file.Name()
+	}
+	r.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(r.cfg.Dir, cmp.Or(r.cfg.Prefix, "api")+"-*.log*"))
+	if err != nil {
+		return err
+	}
+
+	type rotated struct {
+		name    string
+		modTime time.Time
+	}
+	var all []rotated
+	for _, name := range files {
+		if name == active {
+			continue
+		}
+		if r.cfg.Compress && strings.HasSuffix(name, ".log") {
+			if name, err = compress(name); err != nil {
+				return err
+			}
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		all = append(all, rotated{name, info.ModTime()})
+	}
+
+	// Newest first, so the files past MaxFiles are the oldest.
+	slices.SortFunc(all, func(a, b rotated) int { return b.modTime.Compare(a.modTime) })
+	cutoff := r.now().Add(-r.cfg.MaxAge)
+	for i, file := range all {
+		tooMany := r.cfg.MaxFiles > 0 && i >= r.cfg.MaxFiles
+		tooOld := r.cfg.MaxAge > 0 && file.modTime.Before(cutoff)
+		if tooMany || tooOld {
+			if err := os.Remove(file.name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compress gzips name into name.gz, keeping its modification time, and
+// removes name once the copy is complete.
+func compress(name string) (string, error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	target := name + ".gz"
+	dst, err := os.OpenFile(target+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(target+".tmp", target)
+	}
+	if err != nil {
+		os.Remove(target + ".tmp")
+		return "", err
+	}
+
+	os.Chtimes(target, info.ModTime(), info.ModTime())
+	return target, os.Remove(name)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
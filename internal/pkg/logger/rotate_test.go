@@ -0,0 +1,214 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for RotatingFile.
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+func openTestRotating(t *testing.T, cfg RotateConfig, c *clock) *RotatingFile {
+	t.Helper()
+	cfg.Dir = t.TempDir()
+	r, err := openRotating(cfg, c.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+// files lists the names in dir.
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lines reads every line of the log files in dir, gzipped or not.
+func lines(t *testing.T, dir string) []string {
+	t.Helper()
+	var all []string
+	for _, name := range files(t, dir) {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = file
+		if strings.HasSuffix(name, ".gz") {
+			if r, err = gzip.NewReader(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			all = append(all, scanner.Text())
+		}
+		file.Close()
+	}
+	return all
+}
+
+func TestRotatingFileRotatesByDate(t *testing.T) {
+	c := &clock{t: time.Date(2026, 10, 18, 23, 59, 0, 0, time.Local)}
+	r := openTestRotating(t, RotateConfig{Compress: true}, c)
+
+	fmt.Fprintln(r, "yesterday")
+	c.set(c.now().Add(2 * time.Minute))
+	fmt.Fprintln(r, "today")
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"api-2026-10-18.log.gz", "api-2026-10-19.log"}
+	if got := files(t, r.cfg.Dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got := lines(t, r.cfg.Dir); strings.Join(got, ",") != "yesterday,today" {
+		t.Fatalf("unexpected lines %v", got)
+	}
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	c := &clock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)}
+	r := openTestRotating(t, RotateConfig{MaxSize: 10}, c)
+
+	for _, line := range []string{"first", "second", "third"} {
+		fmt.Fprintln(r, line)
+	}
+	r.Close()
+
+	want := []string{"api-2026-10-19.1.log", "api-2026-10-19.2.log", "api-2026-10-19.log"}
+	if got := files(t, r.cfg.Dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if data, _ := os.ReadFile(filepath.Join(r.cfg.Dir, "api-2026-10-19.log")); string(data) != "third\n" {
+		t.Fatalf("expected the last line in the active file, got %q", data)
+	}
+}
+
+func TestRotatingFilePrunesByCountAndAge(t *testing.T) {
+	c := &clock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)}
+	r := openTestRotating(t, RotateConfig{MaxAge: 5 * 24 * time.Hour, MaxFiles: 2}, c)
+
+	for i := 1; i <= 10; i++ {
+		name := filepath.Join(r.cfg.Dir, fmt.Sprintf("api-2026-10-%02d.log", i+8))
+		os.WriteFile(name, []byte("old\n"), 0644)
+		day := time.Date(2026, 10, i+8, 12, 0, 0, 0, time.Local)
+		os.Chtimes(name, day, day)
+	}
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 17th and 18th are the newest rotated files within five days.
+	want := []string{"api-2026-10-17.log", "api-2026-10-18.log", "api-2026-10-19.log"}
+	if got := files(t, r.cfg.Dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	c := &clock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)}
+	r := openTestRotating(t, RotateConfig{}, c)
+
+	fmt.Fprintln(r, "before")
+	active := filepath.Join(r.cfg.Dir, "api-2026-10-19.log")
+	moved := active + ".1"
+	if err := os.Rename(active, moved); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(r, "moved")
+	if err := r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(r, "after")
+
+	if data, _ := os.ReadFile(moved); string(data) != "before\nmoved\n" {
+		t.Errorf("expected the lines before Reopen in the moved file, got %q", data)
+	}
+	if data, _ := os.ReadFile(active); string(data) != "after\n" {
+		t.Errorf("expected a new file after Reopen, got %q", data)
+	}
+}
+
+func TestRotatingFileKeepsEveryLine(t *testing.T) {
+	c := &clock{t: time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)}
+	r := openTestRotating(t, RotateConfig{MaxSize: 200, Compress: true}, c)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				fmt.Fprintf(r, "worker %d line %d\n", w, i)
+				if i == 25 {
+					r.Reopen()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := lines(t, r.cfg.Dir)
+	if len(got) != 400 {
+		t.Fatalf("expected 400 lines, got %d", len(got))
+	}
+	for _, line := range got {
+		if !strings.HasPrefix(line, "worker ") {
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestRotateConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_MAX_SIZE_MB", "5")
+	t.Setenv("LOG_MAX_FILES", "7")
+	t.Setenv("LOG_COMPRESS", "false")
+	cfg, err := RotateConfigFromEnv()
+	if err != nil || cfg.MaxSize != 5<<20 || cfg.MaxFiles != 7 || cfg.Compress || cfg.Dir != "log" {
+		t.Fatalf("unexpected config %+v, %v", cfg, err)
+	}
+
+	t.Setenv("LOG_MAX_AGE", "two weeks")
+	if _, err := RotateConfigFromEnv(); err == nil {
+		t.Error("expected an error for an invalid LOG_MAX_AGE")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package logger
+
+import "context"
+
+// ReopenOnSignal waits for ctx: there is no SIGUSR1 to reopen log files on.
+func ReopenOnSignal(ctx context.Context, reopen ...func() error) {
+	<-ctx.Done()
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReopenOnSignal calls every reopen function, such as Logger.Reopen, on
+// SIGUSR1 until ctx is done, so logrotate can move the files away and signal
+// the process in postrotate.
+func ReopenOnSignal(ctx context.Context, reopen ...func() error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			for _, fn := range reopen {
+				if err := fn(); err != nil {
+					fmt.Fprintln(os.Stderr, "log reopen:", err)
+				}
+			}
+		}
+	}
+}
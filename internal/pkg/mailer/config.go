@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/logger"
+	"strconv"
+	"time"
+)
+
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// Config selects and configures the Mailer.
+type Config struct {
+	// Driver is one of DriverLog (the default), DriverFile or DriverSMTP.
+	Driver string
+	// From is the sender of messages that do not set one.
+	From string
+	// Dir is where DriverFile writes messages.
+	Dir string
+	// Locale is the default locale of the templates.
+	Locale string
+
+	SMTP SMTP
+}
+
+// ConfigFromEnv reads MAIL_* and SMTP_*.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Driver: os.Getenv("MAIL_DRIVER"),
+		From:   os.Getenv("MAIL_FROM"),
+		Dir:    os.Getenv("MAIL_DIR"),
+		Locale: os.Getenv("MAIL_LOCALE"),
+		SMTP: SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     587, // 465 when SMTP_TLS is tls
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			TLS:      os.Getenv("SMTP_TLS"),
+		},
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = DriverLog
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = "log/mail"
+	}
+	if cfg.Locale == "" {
+		cfg.Locale = "en"
+	}
+
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+		cfg.SMTP.Port = port
+	}
+	if v := os.Getenv("SMTP_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_TIMEOUT: %w", err)
+		}
+		cfg.SMTP.Timeout = d
+	}
+
+	switch cfg.SMTP.TLS {
+	case TLSImplicit:
+		if os.Getenv("SMTP_PORT") == "" {
+			cfg.SMTP.Port = 465
+		}
+	case "", TLSStartTLS, TLSNone:
+	default:
+		return cfg, fmt.Errorf("invalid SMTP_TLS %q", cfg.SMTP.TLS)
+	}
+	return cfg, nil
+}
+
+// New builds the Mailer selected by cfg.Driver.
+func New(cfg Config, log *logger.Logger) (Mailer, error) {
+	var m Mailer
+	switch cfg.Driver {
+	case DriverLog:
+		m = Log{Log: log}
+	case DriverFile:
+		m = File{Dir: cfg.Dir}
+	case DriverSMTP:
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required by the smtp mail driver")
+		}
+		smtp := cfg.SMTP
+		m = &smtp
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+	return WithFrom(m, cfg.From), nil
+}
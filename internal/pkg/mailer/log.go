@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rest-skeleton/internal/pkg/logger"
+	"strings"
+	"time"
+)
+
+// Log writes messages to the application log instead of sending them. It is
+// meant for development.
+type Log struct {
+	Log *logger.Logger
+}
+
+func (m Log) Send(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	body := msg.Text
+	if body == "" {
+		body = msg.HTML
+	}
+	m.Log.Info(ctx, fmt.Sprintf("mail from %s to %s: %s\n%s", msg.From, strings.Join(msg.To, ", "), msg.Subject, body))
+	return nil
+}
+
+// File writes every message as an .eml file to Dir, where a mail client can
+// open it.
+type File struct {
+	Dir string
+}
+
+func (m File) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := msg.Bytes(now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0644)
+}
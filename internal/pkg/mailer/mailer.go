@@ -0,0 +1,168 @@
+// Package mailer builds and sends email.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a text part, an HTML part or both.
+type Message struct {
+	From    string   `json:"from,omitempty"`
+	To      []string `json:"to"`
+	ReplyTo string   `json:"reply_to,omitempty"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text,omitempty"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// Mailer sends messages. A nil error means the message was handed over, not
+// that it was delivered.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Validate checks the addresses and rejects header values that span lines.
+func (m Message) Validate() error {
+	if m.From == "" {
+		return fmt.Errorf("message has no sender")
+	}
+	if len(m.To) == 0 {
+		return fmt.Errorf("message has no recipient")
+	}
+	if m.Text == "" && m.HTML == "" {
+		return fmt.Errorf("message has no body")
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("subject must be a single line")
+	}
+
+	addrs := append([]string{m.From}, m.To...)
+	if m.ReplyTo != "" {
+		addrs = append(addrs, m.ReplyTo)
+	}
+	for _, addr := range addrs {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// Bytes renders m as an RFC 5322 message. Both parts are sent as
+// multipart/alternative with the text part first.
+func (m Message) Bytes(now time.Time) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) { fmt.Fprintf(&buf, "%s: %s\r\n", key, value) }
+
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	if m.ReplyTo != "" {
+		header("Reply-To", m.ReplyTo)
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.From))
+	header("MIME-Version", "1.0")
+
+	if m.Text == "" || m.HTML == "" {
+		contentType, body := "text/plain; charset=utf-8", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html; charset=utf-8", m.HTML
+		}
+		header("Content-Type", contentType)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// envelopeAddress strips the display name, which SMTP commands do not take.
+func envelopeAddress(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// WithFrom fills in the sender of messages that have none.
+func WithFrom(m Mailer, from string) Mailer {
+	if from == "" {
+		return m
+	}
+	return defaultFrom{Mailer: m, from: from}
+}
+
+type defaultFrom struct {
+	Mailer
+	from string
+}
+
+func (d defaultFrom) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = d.from
+	}
+	return d.Mailer.Send(ctx, msg)
+}
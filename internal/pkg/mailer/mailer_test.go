@@ -0,0 +1,407 @@
+package mailer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/queue"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// smtpServer is a minimal in-process SMTP server that records what it receives.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	// reject answers RCPT for these addresses with 550.
+	reject map[string]bool
+
+	mu       sync.Mutex
+	auth     []string
+	from     string
+	rcpt     []string
+	data     []string
+	startTLS bool
+}
+
+func newSMTPServer(t *testing.T, startTLS bool) (*smtpServer, *tls.Config) {
+	t.Helper()
+	cert, pool := testCertificate(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: ln, reject: map[string]bool{}}
+	if startTLS {
+		s.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, &tls.Config{RootCAs: pool}
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ready")
+
+	secure := false
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			ext := []string{"250-localhost", "250-AUTH PLAIN"}
+			if s.tls != nil && !secure {
+				ext = append(ext, "250-STARTTLS")
+			}
+			for _, l := range append(ext, "250 8BITMIME") {
+				text.PrintfLine("%s", l)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 go ahead")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, secure = tlsConn, textproto.NewConn(tlsConn), true
+			s.mu.Lock()
+			s.startTLS = true
+			s.mu.Unlock()
+		case "AUTH":
+			_, payload, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(payload)
+			s.mu.Lock()
+			s.auth = strings.Split(string(decoded), "\x00")
+			s.mu.Unlock()
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mu.Lock()
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			s.from = strings.Trim(from, "<>")
+			s.mu.Unlock()
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if s.reject[rcpt] {
+				text.PrintfLine("550 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, rcpt)
+			s.mu.Unlock()
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 send data")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = append(s.data, string(data))
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func testMessage() Message {
+	return Message{
+		From:    "App <noreply@example.com>",
+		To:      []string{"john@example.com"},
+		Subject: "Selamat datang",
+		Text:    "Hello John",
+		HTML:    "<p>Hello John</p>",
+	}
+}
+
+func TestSMTPSendsOverSTARTTLSWithAuth(t *testing.T) {
+	srv, clientTLS := newSMTPServer(t, true)
+	m := &SMTP{Host: "127.0.0.1", Port: srv.port(), Username: "user", Password: "secret", TLSConfig: clientTLS}
+
+	if err := m.Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !srv.startTLS {
+		t.Error("expected the session to be upgraded with STARTTLS")
+	}
+	if len(srv.auth) != 3 || srv.auth[1] != "user" || srv.auth[2] != "secret" {
+		t.Errorf("unexpected credentials %q", srv.auth)
+	}
+	if srv.from != "noreply@example.com" || len(srv.rcpt) != 1 || srv.rcpt[0] != "john@example.com" {
+		t.Errorf("unexpected envelope from %q to %q", srv.from, srv.rcpt)
+	}
+	if len(srv.data) != 1 {
+		t.Fatalf("expected one message, got %d", len(srv.data))
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(srv.data[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject")); subject != "Selamat datang" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	if len(bodies) != 2 || !strings.HasSuffix(bodies[0], "Hello John") || !strings.HasSuffix(bodies[1], "<p>Hello John</p>") {
+		t.Errorf("unexpected parts %q", bodies)
+	}
+}
+
+func TestSMTPRefusesServerWithoutSTARTTLS(t *testing.T) {
+	srv, _ := newSMTPServer(t, false)
+	m := &SMTP{Host: "127.0.0.1", Port: srv.port(), Username: "user", Password: "secret"}
+
+	if err := m.Send(context.Background(), testMessage()); err == nil {
+		t.Fatal("expected an error when the server does not offer STARTTLS")
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.auth != nil || len(srv.data) != 0 {
+		t.Error("expected no credentials or message to be sent in clear text")
+	}
+}
+
+func TestSMTPRejectionIsPermanent(t *testing.T) {
+	srv, _ := newSMTPServer(t, false)
+	srv.reject["john@example.com"] = true
+	m := &SMTP{Host: "127.0.0.1", Port: srv.port(), TLS: TLSNone}
+
+	err := m.Send(context.Background(), testMessage())
+	if !Rejected(err) {
+		t.Fatalf("expected a rejection, got %v", err)
+	}
+	if Rejected(io.ErrUnexpectedEOF) {
+		t.Error("expected a network error to be retried")
+	}
+}
+
+func TestMessageRejectsHeaderInjection(t *testing.T) {
+	msg := testMessage()
+	msg.Subject = "Hi\r\nBcc: everyone@example.com"
+	if err := msg.Validate(); err == nil {
+		t.Error("expected a multi-line subject to be rejected")
+	}
+
+	msg = testMessage()
+	msg.To = []string{"john@example.com\r\nBcc: everyone@example.com"}
+	if err := msg.Validate(); err == nil {
+		t.Error("expected a multi-line address to be rejected")
+	}
+}
+
+func TestTemplatesRenderLocalizedMessages(t *testing.T) {
+	templates := NewTemplates(fstest.MapFS{
+		"en/welcome.subject.txt": {Data: []byte("Welcome, {{.Name}}\n")},
+		"en/welcome.txt":         {Data: []byte("Hi {{.Name}}")},
+		"en/welcome.html":        {Data: []byte("<p>Hi {{.Name}}</p>")},
+		"id/welcome.subject.txt": {Data: []byte("Selamat datang, {{.Name}}")},
+		"id/welcome.txt":         {Data: []byte("Halo {{.Name}}")},
+	}, "en")
+	data := map[string]string{"Name": "<John>"}
+
+	msg, err := templates.Render("welcome", "en", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Welcome, <John>" || msg.Text != "Hi <John>" || msg.HTML != "<p>Hi &lt;John&gt;</p>" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	msg, err = templates.Render("welcome", "id_ID", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Selamat datang, <John>" || msg.HTML != "" {
+		t.Errorf("expected id-ID to fall back to id, got %+v", msg)
+	}
+
+	msg, err = templates.Render("welcome", "fr", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "Welcome, <John>" {
+		t.Errorf("expected fr to fall back to en, got %+v", msg)
+	}
+
+	if _, err := templates.Render("reset", "en", data); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestFileWritesMessages(t *testing.T) {
+	dir := t.TempDir()
+	if err := (File{Dir: dir}).Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if _, err := mail.ReadMessage(strings.NewReader(string(data))); err != nil {
+		t.Errorf("expected a readable message: %v", err)
+	}
+}
+
+func TestQueuedMessagesAreSentByWorker(t *testing.T) {
+	srv, _ := newSMTPServer(t, false)
+	srv.reject["nobody@example.com"] = true
+
+	redisSrv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisSrv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	q := queue.New(client, "mail")
+	w := queue.NewWorker(q, nil)
+	Register(w, &SMTP{Host: "127.0.0.1", Port: srv.port(), TLS: TLSNone})
+
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "test")
+	queued := Queued{Jobs: q, From: "noreply@example.com"}
+
+	msg := testMessage()
+	msg.From = ""
+	if err := queued.Send(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.To = []string{"nobody@example.com"}
+	if err := queued.Send(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	msg.To = []string{"not an address"}
+	if err := queued.Send(ctx, msg); err == nil {
+		t.Error("expected an invalid address to be refused before queueing")
+	}
+
+	for i := 0; i < 2; i++ {
+		if worked, _ := w.Work(ctx); !worked {
+			t.Fatal("expected a queued message")
+		}
+	}
+
+	srv.mu.Lock()
+	delivered := len(srv.data)
+	srv.mu.Unlock()
+	if delivered != 1 {
+		t.Errorf("expected one delivered message, got %d", delivered)
+	}
+	if stats, _ := q.Stats(ctx); stats.Dead != 1 || stats.Scheduled != 0 {
+		t.Errorf("expected the rejected message to be dead-lettered without retry, got %+v", stats)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "smtp")
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_TLS", "tls")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SMTP.Port != 465 || cfg.Locale != "en" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("SMTP_PORT", strconv.Itoa(2525))
+	if cfg, _ = ConfigFromEnv(); cfg.SMTP.Port != 2525 {
+		t.Errorf("expected SMTP_PORT to win, got %d", cfg.SMTP.Port)
+	}
+
+	t.Setenv("SMTP_TLS", "maybe")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected an invalid SMTP_TLS to be rejected")
+	}
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"rest-skeleton/internal/pkg/queue"
+)
+
+// SendTask sends a message from a background worker.
+var SendTask = queue.Task[Message]{Type: "mail.send"}
+
+// Queued hands messages to the job queue so callers do not wait on the mail
+// server. Failed sends are retried with the queue's backoff.
+type Queued struct {
+	Jobs queue.Enqueuer
+	// From is the sender of messages that do not set one.
+	From string
+}
+
+func (q Queued) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = q.From
+	}
+	// Bad addresses will not get better on retry.
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	_, err := SendTask.Enqueue(ctx, q.Jobs, msg)
+	return err
+}
+
+// Register sends the queued messages with m. Messages the server rejects are
+// dead-lettered without further attempts.
+func Register(w *queue.Worker, m Mailer) {
+	SendTask.Register(w, func(ctx context.Context, msg Message) error {
+		err := m.Send(ctx, msg)
+		if Rejected(err) {
+			return queue.Permanent(err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,152 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+const (
+	// TLSStartTLS upgrades a plain connection and fails when the server does
+	// not offer STARTTLS.
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS from the start, usually on port 465.
+	TLSImplicit = "tls"
+	// TLSNone sends in clear text and is meant for local relays only.
+	TLSNone = "none"
+)
+
+// SMTP sends messages through a mail server.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// TLS is one of TLSStartTLS (the default), TLSImplicit or TLSNone.
+	TLS string
+	// TLSConfig overrides the TLS settings, for example to trust a private CA.
+	TLSConfig *tls.Config
+	// Timeout bounds a whole send when ctx has no deadline; it defaults to 30s.
+	Timeout time.Duration
+	// LocalName is sent in EHLO; it defaults to localhost.
+	LocalName string
+}
+
+// Send delivers msg in a single SMTP session.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	data, err := msg.Bytes(time.Now())
+	if err != nil {
+		return err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.timeout())
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	if s.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tlsConfig()}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Hello(s.localName()); err != nil {
+		return err
+	}
+
+	if s.TLS == "" || s.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(s.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		rcpt, err := envelopeAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Rejected reports whether err is a permanent SMTP failure (5xx), such as an
+// unknown recipient, which retrying will not fix.
+func Rejected(err error) bool {
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+func (s *SMTP) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		cfg := s.TLSConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = s.Host
+		}
+		return cfg
+	}
+	return &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+}
+
+func (s *SMTP) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return 30 * time.Second
+}
+
+func (s *SMTP) localName() string {
+	if s.LocalName != "" {
+		return s.LocalName
+	}
+	return "localhost"
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Templates renders messages from files laid out per locale:
+//
+//	<locale>/<name>.subject.txt  the subject line
+//	<locale>/<name>.txt          the text body
+//	<locale>/<name>.html         the HTML body, escaped with html/template
+//
+// Either body may be left out. A locale such as pt-BR falls back to pt and
+// then to the default locale.
+type Templates struct {
+	fsys          fs.FS
+	defaultLocale string
+
+	mu     sync.Mutex
+	parsed map[string]*parsedTemplate
+}
+
+type parsedTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+func NewTemplates(fsys fs.FS, defaultLocale string) *Templates {
+	return &Templates{fsys: fsys, defaultLocale: normalizeLocale(defaultLocale), parsed: make(map[string]*parsedTemplate)}
+}
+
+// Render builds the message name in locale with data. Only the subject and
+// bodies are set; the caller fills in the recipients.
+func (t *Templates) Render(name, locale string, data any) (Message, error) {
+	tpl, err := t.lookup(name, locale)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var msg Message
+	var buf bytes.Buffer
+	if err := tpl.subject.Execute(&buf, data); err != nil {
+		return Message{}, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	if tpl.text != nil {
+		buf.Reset()
+		if err := tpl.text.Execute(&buf, data); err != nil {
+			return Message{}, err
+		}
+		msg.Text = buf.String()
+	}
+	if tpl.html != nil {
+		buf.Reset()
+		if err := tpl.html.Execute(&buf, data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
+
+func (t *Templates) lookup(name, locale string) (*parsedTemplate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, candidate := range t.locales(locale) {
+		key := path.Join(candidate, name)
+		if tpl, ok := t.parsed[key]; ok {
+			return tpl, nil
+		}
+
+		tpl, err := t.parse(key)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.parsed[key] = tpl
+		return tpl, nil
+	}
+	return nil, fmt.Errorf("no mail template %q for locale %q", name, locale)
+}
+
+func (t *Templates) parse(key string) (*parsedTemplate, error) {
+	subject, err := fs.ReadFile(t.fsys, key+".subject.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var tpl parsedTemplate
+	if tpl.subject, err = texttemplate.New(key + ".subject.txt").Parse(string(subject)); err != nil {
+		return nil, err
+	}
+	if text, err := fs.ReadFile(t.fsys, key+".txt"); err == nil {
+		if tpl.text, err = texttemplate.New(key + ".txt").Parse(string(text)); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if html, err := fs.ReadFile(t.fsys, key+".html"); err == nil {
+		if tpl.html, err = htmltemplate.New(key + ".html").Parse(string(html)); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if tpl.text == nil && tpl.html == nil {
+		return nil, fmt.Errorf("mail template %s has no body", key)
+	}
+	return &tpl, nil
+}
+
+// locales lists the directories to try for locale, most specific first.
+func (t *Templates) locales(locale string) []string {
+	var list []string
+	if locale = normalizeLocale(locale); locale != "" {
+		list = append(list, locale)
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			list = append(list, base)
+		}
+	}
+	return append(list, t.defaultLocale)
+}
+
+// normalizeLocale turns pt_BR and PT-br into pt-BR.
+func normalizeLocale(locale string) string {
+	base, region, ok := strings.Cut(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	if !ok {
+		return strings.ToLower(base)
+	}
+	return strings.ToLower(base) + "-" + strings.ToUpper(region)
+}
@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create scaffolds an up and down pair for name in dir and returns their
+// paths. Migrations are grouped by the first number of their version, as
+// named in the README: fn_ names go in group 1 and everything else, tables
+// included, in group 2. The new version follows the last one of its group.
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.Trim(nonWord.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name is empty")
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	group := 2
+	if strings.HasPrefix(name, "fn_") {
+		group = 1
+	}
+
+	next := 1
+	for _, mig := range migrations {
+		parts, _ := parseVersion(mig.Version)
+		if len(parts) == 2 && parts[0] == group && parts[1] >= next {
+			next = parts[1] + 1
+		}
+	}
+
+	key := fmt.Sprintf("%d.%03d_%s", group, next, name)
+	up, down = filepath.Join(dir, key+".up.sql"), filepath.Join(dir, key+".down.sql")
+	files := map[string]string{
+		up:   "-- " + key + ": write the change here.\n",
+		down: "-- " + key + ": undo the up migration here, or delete this file if it cannot be undone.\n",
+	}
+	for path, content := range files {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = file.WriteString(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
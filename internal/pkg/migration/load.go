@@ -0,0 +1,248 @@
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Load reads the migrations at the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %v", err)
+	}
+
+	byKey := make(map[string]*Migration)
+	downs := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".sql" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file %s: %v", name, err)
+		}
+
+		switch {
+		case strings.HasSuffix(name, ".down.sql"):
+			downs[strings.TrimSuffix(name, ".down.sql")] = string(content)
+		case strings.HasSuffix(name, ".up.sql"):
+			key := strings.TrimSuffix(name, ".up.sql")
+			mig, err := newMigration(key, name)
+			if err != nil {
+				return nil, err
+			}
+			mig.Up = string(content)
+			mig.NoTransaction = markerLine(mig.Up, markerNoTransaction) >= 0
+			byKey[key] = &mig
+		default:
+			key := strings.TrimSuffix(name, ".sql")
+			mig, err := newMigration(key, name)
+			if err != nil {
+				return nil, err
+			}
+			if mig.Up, mig.Down, err = splitSections(string(content)); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			mig.NoTransaction = markerLine(string(content), markerNoTransaction) >= 0
+			byKey[key] = &mig
+		}
+	}
+
+	for key, down := range downs {
+		mig, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("%s.down.sql has no matching up migration", key)
+		}
+		if !strings.HasSuffix(mig.Filename, ".up.sql") {
+			return nil, fmt.Errorf("%s.down.sql pairs with %s, which should be named %s.up.sql", key, mig.Filename, key)
+		}
+		mig.Down = down
+		mig.NoTransaction = mig.NoTransaction || markerLine(down, markerNoTransaction) >= 0
+	}
+
+	migrations := make([]Migration, 0, len(byKey))
+	for _, mig := range byKey {
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersions(migrations[i].Version, migrations[j].Version) < 0
+	})
+	for i := 1; i < len(migrations); i++ {
+		if compareVersions(migrations[i-1].Version, migrations[i].Version) == 0 {
+			return nil, fmt.Errorf("%s and %s share version %s", migrations[i-1].Filename, migrations[i].Filename, migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+func newMigration(key, filename string) (Migration, error) {
+	version, name, ok := strings.Cut(key, "_")
+	if _, err := parseVersion(version); !ok || err != nil {
+		return Migration{}, fmt.Errorf("%s: migration files are named <version>_<name>.sql with a version such as 2.001", filename)
+	}
+	return Migration{Version: version, Name: name, Filename: filename}, nil
+}
+
+// splitSections splits a file on its "-- +migrate Up" and "-- +migrate Down"
+// lines. A file without markers is all up script. The line break before a
+// marker belongs to the marker, so appending a down section to an applied
+// migration keeps its checksum.
+func splitSections(content string) (up, down string, err error) {
+	upAt, downAt := markerLine(content, markerUp), markerLine(content, markerDown)
+	if downAt < 0 {
+		if upAt < 0 {
+			return content, "", nil
+		}
+		return afterLine(content, upAt), "", nil
+	}
+	if upAt > downAt {
+		return "", "", fmt.Errorf("the up section must come before the down section")
+	}
+
+	up = strings.TrimSuffix(strings.TrimSuffix(content[:downAt], "\n"), "\r")
+	if upAt >= 0 {
+		up = strings.TrimSuffix(strings.TrimSuffix(afterLine(content[:downAt], upAt), "\n"), "\r")
+	}
+	return up, afterLine(content, downAt), nil
+}
+
+// markerLine returns the offset of the line that is marker, or -1.
+func markerLine(content, marker string) int {
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.TrimSpace(line) == marker {
+			return offset
+		}
+		offset += len(line)
+	}
+	return -1
+}
+
+func afterLine(content string, at int) string {
+	if end := strings.IndexByte(content[at:], '\n'); end >= 0 {
+		return content[at+end+1:]
+	}
+	return ""
+}
+
+// parseVersion splits a version such as 2.001 into its numbers.
+func parseVersion(version string) ([]int, error) {
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 || field[0] == '+' {
+			return nil, fmt.Errorf("invalid version %q", version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions orders versions number by number, so 2.010 comes after
+// 2.009 and 10.001 after 9.001. A version that does not parse sorts last.
+func compareVersions(a, b string) int {
+	pa, errA := parseVersion(a)
+	pb, errB := parseVersion(b)
+	if errA != nil || errB != nil {
+		if errA != nil && errB != nil {
+			return strings.Compare(a, b)
+		}
+		if errA != nil {
+			return 1
+		}
+		return -1
+	}
+
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// splitStatements splits a script on the semicolons that end its
+// statements, skipping those in quotes, dollar quotes and comments.
+func splitStatements(script string) []string {
+	var stmts []string
+	start := 0
+	for i := 0; i < len(script); i++ {
+		switch {
+		case script[i] == '\'' || script[i] == '"':
+			if end := strings.IndexByte(script[i+1:], script[i]); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(script)
+			}
+		case strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case script[i] == '$':
+			if tag := dollarTag(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(script)
+				}
+			}
+		case script[i] == ';':
+			stmts = appendStatement(stmts, script[start:i+1])
+			start = i + 1
+		}
+	}
+	if start < len(script) {
+		stmts = appendStatement(stmts, script[start:])
+	}
+	return stmts
+}
+
+// dollarTag returns the $tag$ or $$ opening s, if any.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func appendStatement(stmts []string, stmt string) []string {
+	if strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt), ";")) == "" {
+		return stmts
+	}
+	return append(stmts, strings.TrimSpace(stmt))
+}
+
+// hasStatements reports whether script holds more than comments, so that a
+// scaffolded down file left untouched does not count as a down script.
+func hasStatements(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,123 +1,464 @@
 package migration
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
+	embedded "rest-skeleton/migration"
+	"time"
 )
 
-type walk filepath.WalkFunc
+const (
+	markerUp            = "-- +migrate Up"
+	markerDown          = "-- +migrate Down"
+	markerNoTransaction = "-- +migrate NoTransaction"
+)
+
+// defaultLockKey identifies the advisory lock held while migrating.
+const defaultLockKey int64 = 0x6d6967726174 // "migrat"
 
+// Migration is one versioned schema change, read either from a single
+// <version>_<name>.sql file, optionally split with "-- +migrate Up" and
+// "-- +migrate Down" sections, or from a <version>_<name>.up.sql and
+// <version>_<name>.down.sql pair.
+type Migration struct {
+	Version string
+	Name    string
+	// Filename identifies the migration in _migrations: the .sql or .up.sql file.
+	Filename string
+	Up       string
+	// Down undoes Up. Migrations without one cannot be rolled back.
+	Down string
+	// NoTransaction runs the migration outside the command's transaction,
+	// one statement at a time, for statements such as CREATE INDEX
+	// CONCURRENTLY. It is set by a "-- +migrate NoTransaction" line.
+	NoTransaction bool
+}
+
+// Checksum covers the up script only, so adding a down section to an
+// applied migration does not invalidate it.
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrator applies and rolls back the migrations found in FS. Every command
+// runs in a single transaction: it either completes or leaves the schema
+// untouched. A NoTransaction migration commits the work before it and runs
+// on its own, so a failure after it keeps what was done up to it.
+//
+// Commands hold a Postgres advisory lock, so replicas starting at the same
+// time migrate one after the other.
+type Migrator struct {
+	DB *sql.DB
+	// FS holds the migration files. New uses the ones embedded in the binary;
+	// os.DirFS points it at a directory instead.
+	FS fs.FS
+	// LockTimeout bounds the wait for another migrator; it defaults to one minute.
+	LockTimeout time.Duration
+	// LockKey is the advisory lock key, for databases shared by several applications.
+	LockKey int64
+	// DryRun runs the command in a transaction that is rolled back, so that
+	// Report lists what would be executed.
+	DryRun bool
+	// Report, if set, is called before each migration is applied or rolled back.
+	Report func(step Step)
+	// Warn, if set, is told about applied migrations passed over because
+	// their file no longer exists.
+	Warn func(msg string)
+}
+
+// Step is a migration applied or rolled back by a command.
+type Step struct {
+	Migration
+	Down bool
+}
+
+// SQL is the script the step runs.
+func (s Step) SQL() string {
+	if s.Down {
+		return s.Migration.Down
+	}
+	return s.Migration.Up
+}
+
+func New(db *sql.DB) *Migrator {
+	return &Migrator{DB: db, FS: embedded.FS}
+}
+
+// Migrate applies every pending migration.
 func Migrate(db *sql.DB) error {
-	// Buat tabel migrations jika belum ada
-	err := createMigrationsTable(db)
+	return New(db).Up()
+}
+
+// Up applies every pending migration.
+func (m *Migrator) Up() error {
+	return m.run(func(s *session) error {
+		for _, mig := range s.migrations {
+			if err := s.apply(mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last n applied migrations, newest first. Nothing is
+// rolled back when one of them has no down script.
+func (m *Migrator) Down(n int) error {
+	if n < 1 {
+		return fmt.Errorf("number of migrations to roll back must be positive")
+	}
+	return m.run(func(s *session) error {
+		last := s.lastApplied(n)
+		if len(last) == 0 {
+			return fmt.Errorf("no migration has been applied")
+		}
+		return s.rollback(last)
+	})
+}
+
+// To migrates up or down to version: later applied migrations are rolled
+// back, then pending migrations up to and including version are applied.
+func (m *Migrator) To(version string) error {
+	return m.run(func(s *session) error {
+		target := -1
+		for i, mig := range s.migrations {
+			if compareVersions(mig.Version, version) == 0 {
+				target = i
+			}
+		}
+		if target < 0 {
+			return fmt.Errorf("unknown migration version %s", version)
+		}
+
+		later := make(map[string]bool)
+		for _, mig := range s.migrations[target+1:] {
+			later[mig.Filename] = true
+		}
+		var undo []string
+		for _, filename := range s.applied {
+			if later[filename] {
+				undo = append(undo, filename)
+			}
+		}
+		if err := s.rollback(undo); err != nil {
+			return err
+		}
+
+		for _, mig := range s.migrations[:target+1] {
+			if err := s.apply(mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Redo rolls back the last applied migration and applies it again.
+func (m *Migrator) Redo() error {
+	return m.run(func(s *session) error {
+		last := s.lastApplied(1)
+		if len(last) == 0 {
+			return fmt.Errorf("no migration has been applied")
+		}
+		if err := s.rollback(last); err != nil {
+			return err
+		}
+		return s.apply(s.byFilename[last[0]])
+	})
+}
+
+// session is the state of one command inside its transaction.
+type session struct {
+	ctx        context.Context
+	conn       *sql.Conn
+	tx         *sql.Tx
+	host       string
+	migrations []Migration
+	byFilename map[string]Migration
+	// applied lists the applied migrations in the order they were applied,
+	// and records holds what _migrations says about them.
+	applied []string
+	records map[string]record
+	dryRun  bool
+	report  func(step Step)
+	warn    func(msg string)
+}
+
+type record struct {
+	checksum   string
+	executedAt time.Time
+	appliedBy  string
+	duration   time.Duration
+}
+
+// executor is a transaction, or the connection for NoTransaction migrations.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (m *Migrator) run(fn func(s *session) error) error {
+	migrations, err := Load(m.FS)
 	if err != nil {
 		return err
 	}
 
-	tx, err := db.Begin()
+	// The lock belongs to a session, so the whole command runs on one connection.
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
 	if err != nil {
-		return fmt.Errorf("could not begin transaction: %v", err)
+		return fmt.Errorf("could not connect: %v", err)
 	}
+	defer conn.Close()
 
-	var mywalk walk = func(path string, info os.FileInfo, err error) error {
-		if filepath.Ext(path) == ".sql" {
-			err := executeSQLFile(tx, path)
-			if err != nil {
-				_ = tx.Rollback()
-				return err
-			}
+	if err := m.lock(ctx, conn); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", m.lockKey())
+
+	host, _ := os.Hostname()
+	s := &session{
+		ctx:        ctx,
+		conn:       conn,
+		host:       host,
+		migrations: migrations,
+		byFilename: make(map[string]Migration),
+		records:    make(map[string]record),
+		dryRun:     m.DryRun,
+		report:     m.Report,
+		warn:       m.Warn,
+	}
+	for _, mig := range migrations {
+		s.byFilename[mig.Filename] = mig
+	}
+
+	if s.tx, err = conn.BeginTx(ctx, nil); err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer func() {
+		if s.tx != nil {
+			s.tx.Rollback()
 		}
-		return nil
+	}()
+
+	// The table is created in the transaction so a dry run leaves no trace.
+	if err := createMigrationsTable(ctx, s.tx); err != nil {
+		return err
 	}
 
-	err = filepath.Walk("migration", filepath.WalkFunc(mywalk))
+	// Rows of rolled back migrations are kept as history. Only the latest
+	// row of a migration can be live, which the ORDER BY id relies on.
+	rows, err := s.tx.QueryContext(ctx, "SELECT filename, checksum, executed_at, applied_by, duration_ms FROM _migrations WHERE rolled_back_at IS NULL ORDER BY id")
 	if err != nil {
-		return fmt.Errorf("error walking the path: %v", err)
+		return fmt.Errorf("could not read migrations: %v", err)
+	}
+	for rows.Next() {
+		var filename, checksum string
+		var executedAt sql.NullTime
+		var appliedBy sql.NullString
+		var durationMs sql.NullInt64
+		if err := rows.Scan(&filename, &checksum, &executedAt, &appliedBy, &durationMs); err != nil {
+			rows.Close()
+			return fmt.Errorf("could not read migrations: %v", err)
+		}
+		s.applied = append(s.applied, filename)
+		s.records[filename] = record{
+			checksum:   checksum,
+			executedAt: executedAt.Time,
+			appliedBy:  appliedBy.String,
+			duration:   time.Duration(durationMs.Int64) * time.Millisecond,
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not read migrations: %v", err)
 	}
 
-	return tx.Commit()
+	if err := fn(s); err != nil {
+		return err
+	}
+	if m.DryRun {
+		return nil
+	}
+	return s.tx.Commit()
 }
 
-func createMigrationsTable(db *sql.DB) error {
-	createTableSQL := `
-    CREATE TABLE IF NOT EXISTS _migrations (
-        id SERIAL PRIMARY KEY,
-        filename TEXT NOT NULL,
-        checksum TEXT NOT NULL,
-        executed_at TIMESTAMPTZ DEFAULT timezone('utc', now())
-    );`
-	_, err := db.Exec(createTableSQL)
-	if err != nil {
-		return fmt.Errorf("could not create migrations table: %v", err)
+// lock waits for the advisory lock until LockTimeout.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	timeout := m.LockTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
 	}
+	deadline := time.Now().Add(timeout)
 
-	return nil
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", m.lockKey()).Scan(&locked); err != nil {
+			return fmt.Errorf("could not take the migration lock: %v", err)
+		}
+		if locked {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("another migration is running; gave up waiting after %s", timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
 }
 
-// executeSQLFile membaca dan mengeksekusi file SQL
-func executeSQLFile(tx *sql.Tx, path string) error {
-	// Hitung checksum file SQL
-	checksum, err := calculateChecksum(path)
-	if err != nil {
-		return fmt.Errorf("could not calculate checksum for file %s: %v", path, err)
+func (m *Migrator) lockKey() int64 {
+	if m.LockKey != 0 {
+		return m.LockKey
 	}
+	return defaultLockKey
+}
 
-	// Periksa apakah file sudah dieksekusi sebelumnya
-	var exists bool
-	var storedChecksum string
-	err = tx.QueryRow(`
-		SELECT EXISTS(SELECT 1 FROM _migrations WHERE filename = $1), checksum 
-		FROM _migrations 
-		WHERE filename = $1
-	`, filepath.Base(path)).Scan(&exists, &storedChecksum)
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("could not check migrations: %v", err)
+// exec runs step, then record, which keeps _migrations in step with it. A
+// NoTransaction step commits the transaction so far, runs with record on
+// the bare connection and opens a new transaction for the steps after it.
+// In a dry run the step is only reported.
+func (s *session) exec(step Step, record func(ex executor, took time.Duration) error) error {
+	if s.report != nil {
+		s.report(step)
+	}
+	if s.dryRun {
+		return nil
 	}
 
-	if exists {
-		if storedChecksum != checksum {
-			return fmt.Errorf("checksum mismatch for file %s; file has changed", filepath.Base(path))
+	if !step.NoTransaction {
+		start := time.Now()
+		if _, err := s.tx.ExecContext(s.ctx, step.SQL()); err != nil {
+			return err
 		}
-		return nil
+		return record(s.tx, time.Since(start))
 	}
 
-	// Baca isi file SQL dan eksekusi
-	sqlBytes, err := os.ReadFile(path)
+	err := s.tx.Commit()
+	s.tx = nil
 	if err != nil {
-		return fmt.Errorf("could not read file %s: %v", filepath.Base(path), err)
+		return fmt.Errorf("could not commit before %s: %v", step.Filename, err)
 	}
 
-	_, err = tx.Exec(string(sqlBytes))
-	if err != nil {
-		return fmt.Errorf("could not execute SQL file %s: %v", filepath.Base(path), err)
+	start := time.Now()
+	for _, stmt := range splitStatements(step.SQL()) {
+		if _, err := s.conn.ExecContext(s.ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if err := record(s.conn, time.Since(start)); err != nil {
+		return err
+	}
+
+	if s.tx, err = s.conn.BeginTx(s.ctx, nil); err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	return nil
+}
+
+// apply runs mig unless it has already been applied with the same checksum.
+func (s *session) apply(mig Migration) error {
+	if stored, ok := s.records[mig.Filename]; ok {
+		if stored.checksum != mig.Checksum() {
+			return fmt.Errorf("checksum mismatch for file %s; file has changed, run migrate repair once the change is approved", mig.Filename)
+		}
+		return nil
 	}
 
-	// Insert ke tabel migrations
-	_, err = tx.Exec("INSERT INTO _migrations (filename, checksum) VALUES ($1, $2)", filepath.Base(path), checksum)
+	var took time.Duration
+	err := s.exec(Step{Migration: mig}, func(ex executor, d time.Duration) error {
+		took = d
+		if _, err := ex.ExecContext(s.ctx, "INSERT INTO _migrations (filename, checksum, applied_by, duration_ms) VALUES ($1, $2, $3, $4)", mig.Filename, mig.Checksum(), s.host, d.Milliseconds()); err != nil {
+			return fmt.Errorf("could not insert migration record: %v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("could not insert migration record for file %s: %v", filepath.Base(path), err)
+		return fmt.Errorf("could not execute SQL file %s: %v", mig.Filename, err)
 	}
 
+	s.applied = append(s.applied, mig.Filename)
+	s.records[mig.Filename] = record{checksum: mig.Checksum(), executedAt: time.Now(), appliedBy: s.host, duration: took}
 	return nil
 }
 
-// calculateChecksum menghitung checksum SHA256 dari file
-func calculateChecksum(path string) (string, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return "", err
+// lastApplied returns up to n of the last applied migrations, in the order
+// they were applied. Migrations whose file was removed, such as the seed
+// migrations replaced by seeders, cannot be rolled back: they are passed over
+// with a warning and stay recorded as applied.
+func (s *session) lastApplied(n int) []string {
+	var last []string
+	for i := len(s.applied) - 1; i >= 0 && len(last) < n; i-- {
+		filename := s.applied[i]
+		if _, ok := s.byFilename[filename]; !ok {
+			if s.warn != nil {
+				s.warn(fmt.Sprintf("skipping %s: it is applied but its file is missing", filename))
+			}
+			continue
+		}
+		last = append([]string{filename}, last...)
 	}
-	defer file.Close()
+	return last
+}
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
+// rollback runs the down scripts of filenames, last first. It checks every
+// migration has a down script before running any of them.
+func (s *session) rollback(filenames []string) error {
+	for _, filename := range filenames {
+		mig, ok := s.byFilename[filename]
+		if !ok {
+			return fmt.Errorf("cannot roll back %s: file not found", filename)
+		}
+		if !hasStatements(mig.Down) {
+			return fmt.Errorf("cannot roll back %s: it has no down script", filename)
+		}
 	}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	for i := len(filenames) - 1; i >= 0; i-- {
+		mig := s.byFilename[filenames[i]]
+		err := s.exec(Step{Migration: mig, Down: true}, func(ex executor, _ time.Duration) error {
+			if _, err := ex.ExecContext(s.ctx, "UPDATE _migrations SET rolled_back_at = timezone('utc', now()), rolled_back_by = $2 WHERE filename = $1 AND rolled_back_at IS NULL", mig.Filename, s.host); err != nil {
+				return fmt.Errorf("could not record rollback: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not roll back %s: %v", mig.Filename, err)
+		}
+
+		delete(s.records, mig.Filename)
+		for j, filename := range s.applied {
+			if filename == mig.Filename {
+				s.applied = append(s.applied[:j], s.applied[j+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func createMigrationsTable(ctx context.Context, tx *sql.Tx) error {
+	// rolled_back_at keeps the history of rollbacks: a migration applied
+	// again gets a new row. applied_by and rolled_back_by hold the host name.
+	createTableSQL := `
+    CREATE TABLE IF NOT EXISTS _migrations (
+        id SERIAL PRIMARY KEY,
+        filename TEXT NOT NULL,
+        checksum TEXT NOT NULL,
+        executed_at TIMESTAMPTZ DEFAULT timezone('utc', now())
+    );
+    ALTER TABLE _migrations ADD COLUMN IF NOT EXISTS rolled_back_at TIMESTAMPTZ;
+    ALTER TABLE _migrations ADD COLUMN IF NOT EXISTS applied_by TEXT;
+    ALTER TABLE _migrations ADD COLUMN IF NOT EXISTS duration_ms BIGINT;
+    ALTER TABLE _migrations ADD COLUMN IF NOT EXISTS rolled_back_by TEXT;`
+	_, err := tx.ExecContext(ctx, createTableSQL)
+	if err != nil {
+		return fmt.Errorf("could not create migrations table: %v", err)
+	}
+
+	return nil
 }
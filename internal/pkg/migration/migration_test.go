@@ -0,0 +1,220 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	embedded "rest-skeleton/migration"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadReadsSectionsAndPairs(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"1.001_plain.sql":     "CREATE TABLE a (id int);\n",
+		"1.002_sections.sql":  "-- +migrate Up\nCREATE TABLE b (id int);\n-- +migrate Down\nDROP TABLE b;\n",
+		"1.003_pair.up.sql":   "CREATE TABLE c (id int);\n",
+		"1.003_pair.down.sql": "DROP TABLE c;\n",
+		"README.md":           "not a migration",
+	})
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("expected 3 migrations, got %+v", migrations)
+	}
+
+	plain, sections, pair := migrations[0], migrations[1], migrations[2]
+	if plain.Version != "1.001" || plain.Name != "plain" || plain.Up != "CREATE TABLE a (id int);\n" || plain.Down != "" {
+		t.Errorf("unexpected plain migration %+v", plain)
+	}
+	if sections.Up != "CREATE TABLE b (id int);" || sections.Down != "DROP TABLE b;\n" {
+		t.Errorf("unexpected sections %+v", sections)
+	}
+	if pair.Filename != "1.003_pair.up.sql" || pair.Up != "CREATE TABLE c (id int);\n" || pair.Down != "DROP TABLE c;\n" {
+		t.Errorf("unexpected pair %+v", pair)
+	}
+}
+
+func TestAddingDownSectionKeepsChecksum(t *testing.T) {
+	for _, up := range []string{"CREATE TABLE a (id int);\n", "CREATE TABLE a (id int);"} {
+		before := Migration{Up: up}.Checksum()
+
+		dir := writeFiles(t, map[string]string{"1.001_a.sql": up + "\n-- +migrate Down\nDROP TABLE a;\n"})
+		migrations, err := Load(os.DirFS(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migrations[0].Checksum() != before {
+			t.Errorf("expected the checksum of %q to survive a down section, got up %q", up, migrations[0].Up)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidLayouts(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"orphan down":       {"1.001_a.down.sql": "DROP TABLE a;"},
+		"down for sql file": {"1.001_a.sql": "CREATE TABLE a (id int);", "1.001_a.down.sql": "DROP TABLE a;"},
+		"shared version":    {"1.001_a.sql": "SELECT 1;", "1.001_b.sql": "SELECT 2;"},
+		"no version":        {"create_a.sql": "SELECT 1;"},
+		"down before up":    {"1.001_a.sql": "-- +migrate Down\nDROP TABLE a;\n-- +migrate Up\nCREATE TABLE a (id int);"},
+	} {
+		if _, err := Load(os.DirFS(writeFiles(t, files))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRepositoryMigrationsCanBeRolledBack(t *testing.T) {
+	migrations, err := Load(embedded.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mig := range migrations {
+		if !hasStatements(mig.Down) {
+			t.Errorf("%s has no down script", mig.Filename)
+		}
+	}
+}
+
+func TestLoadSortsVersionsNumerically(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"10.001_last.sql":  "SELECT 4;",
+		"2.010_third.sql":  "SELECT 3;",
+		"2.9_second.sql":   "SELECT 2;",
+		"1.002_first.sql":  "SELECT 1;",
+		"README.migration": "ignored",
+	})
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, mig := range migrations {
+		order = append(order, mig.Version)
+	}
+	if strings.Join(order, " ") != "1.002 2.9 2.010 10.001" {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	if _, err := Load(os.DirFS(writeFiles(t, map[string]string{"2.1_a.sql": "SELECT 1;", "2.001_b.sql": "SELECT 2;"}))); err == nil {
+		t.Error("expected 2.1 and 2.001 to be the same version")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.002", "1.010", -1},
+		{"9.001", "10.001", -1},
+		{"2.005", "2.5", 0},
+		{"2", "2.001", -1},
+		{"3.001", "2.999", 1},
+	} {
+		got := compareVersions(tc.a, tc.b)
+		if (got < 0 && tc.want >= 0) || (got > 0 && tc.want <= 0) || (got == 0 && tc.want != 0) {
+			t.Errorf("compareVersions(%s, %s) = %d, want sign %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestLoadDetectsNoTransaction(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"1.001_index.sql":    "-- +migrate NoTransaction\n-- +migrate Up\nCREATE INDEX CONCURRENTLY a_idx ON a (id);\n-- +migrate Down\nDROP INDEX CONCURRENTLY a_idx;\n",
+		"1.002_plain.up.sql": "CREATE TABLE b (id int);\n",
+	})
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrations[0].NoTransaction || migrations[1].NoTransaction {
+		t.Errorf("unexpected NoTransaction flags %v, %v", migrations[0].NoTransaction, migrations[1].NoTransaction)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- an index per tenant
+CREATE INDEX CONCURRENTLY a_idx ON a (id);
+INSERT INTO notes (body) VALUES ('a; b'), ("odd;name");
+/* block; comment */ CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;
+SELECT $1;
+  `
+
+	stmts := splitStatements(script)
+	if len(stmts) != 4 {
+		t.Fatalf("expected 4 statements, got %d: %q", len(stmts), stmts)
+	}
+	if !strings.HasPrefix(stmts[0], "-- an index per tenant\nCREATE INDEX") || !strings.Contains(stmts[1], "'a; b'") || !strings.HasSuffix(stmts[2], "LANGUAGE plpgsql;") || stmts[3] != "SELECT $1;" {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+}
+
+func TestCreateScaffoldsNextVersion(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"1.001_fn_a.sql":       "SELECT 1;",
+		"2.001_t_a.sql":        "SELECT 1;",
+		"2.009_t_b.up.sql":     "SELECT 1;",
+		"2.009_t_b.down.sql":   "SELECT 1;",
+		"3.001_seed.sql":       "SELECT 1;",
+		"10.001_unrelated.sql": "SELECT 1;",
+	})
+
+	up, down, err := Create(dir, "T Products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "2.010_t_products.up.sql" || filepath.Base(down) != "2.010_t_products.down.sql" {
+		t.Errorf("unexpected files %s, %s", up, down)
+	}
+	if up, _, _ := Create(dir, "fn_add_tax"); filepath.Base(up) != "1.002_fn_add_tax.up.sql" {
+		t.Errorf("expected a function in group 1, got %s", up)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mig := range migrations {
+		if mig.Version == "2.010" && hasStatements(mig.Down) {
+			t.Error("expected the scaffolded down script not to count until it is written")
+		}
+	}
+}
+
+func TestLastAppliedPassesOverMissingFiles(t *testing.T) {
+	// Installs from before the seeders still have the seed migrations
+	// recorded as applied, after the latest schema migration.
+	var warnings []string
+	s := &session{
+		byFilename: map[string]Migration{"2.007_t_webhooks.sql": {}, "2.008_users_disabled_at.sql": {}},
+		applied:    []string{"2.007_t_webhooks.sql", "3.001_seed.sql", "3.002_seed_webhook_access.sql", "2.008_users_disabled_at.sql"},
+		warn:       func(msg string) { warnings = append(warnings, msg) },
+	}
+
+	got := s.lastApplied(2)
+	if strings.Join(got, ",") != "2.007_t_webhooks.sql,2.008_users_disabled_at.sql" {
+		t.Errorf("unexpected migrations to roll back %v", got)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "3.002_seed_webhook_access.sql") {
+		t.Errorf("expected a warning per missing file, got %v", warnings)
+	}
+	if len(s.applied) != 4 {
+		t.Errorf("expected the applied list to be left alone, got %v", s.applied)
+	}
+}
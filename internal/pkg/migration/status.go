@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatePending  = "pending"
+	StateApplied  = "applied"
+	StateModified = "modified"
+	// StateMissing is an applied migration whose file no longer exists.
+	StateMissing = "missing"
+)
+
+// Status describes one migration, known from its file, from _migrations or
+// from both.
+type Status struct {
+	Version  string
+	Filename string
+	State    string
+	// Checksum is the checksum of the file, or the recorded one when the
+	// file is missing.
+	Checksum string
+	// RecordedChecksum is the checksum stored when the migration was applied.
+	RecordedChecksum string
+	AppliedAt        time.Time
+	// AppliedBy is the host that applied the migration.
+	AppliedBy string
+	Duration  time.Duration
+}
+
+// Status lists every migration in version order, followed by applied
+// migrations whose file is missing.
+func (m *Migrator) Status() ([]Status, error) {
+	var list []Status
+	err := m.readOnly(func(s *session) error {
+		for _, mig := range s.migrations {
+			status := Status{Version: mig.Version, Filename: mig.Filename, State: StatePending, Checksum: mig.Checksum()}
+			if rec, ok := s.records[mig.Filename]; ok {
+				status.State, status.RecordedChecksum = StateApplied, rec.checksum
+				status.AppliedAt, status.AppliedBy, status.Duration = rec.executedAt, rec.appliedBy, rec.duration
+				if rec.checksum != status.Checksum {
+					status.State = StateModified
+				}
+			}
+			list = append(list, status)
+		}
+		for _, filename := range s.applied {
+			if _, ok := s.byFilename[filename]; !ok {
+				rec := s.records[filename]
+				list = append(list, Status{
+					Filename:         filename,
+					State:            StateMissing,
+					Checksum:         rec.checksum,
+					RecordedChecksum: rec.checksum,
+					AppliedAt:        rec.executedAt,
+					AppliedBy:        rec.appliedBy,
+					Duration:         rec.duration,
+				})
+			}
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Repair stores the current checksum of applied migrations whose file was
+// edited after they ran, and returns their file names. Use it only once the
+// edit is known to leave the schema as the migration originally made it.
+func (m *Migrator) Repair() ([]string, error) {
+	var repaired []string
+	err := m.run(func(s *session) error {
+		for _, filename := range s.applied {
+			mig, ok := s.byFilename[filename]
+			if !ok || s.records[filename].checksum == mig.Checksum() {
+				continue
+			}
+			if !s.dryRun {
+				if _, err := s.tx.ExecContext(s.ctx, "UPDATE _migrations SET checksum = $1 WHERE filename = $2 AND rolled_back_at IS NULL", mig.Checksum(), filename); err != nil {
+					return fmt.Errorf("could not repair %s: %v", filename, err)
+				}
+			}
+			repaired = append(repaired, filename)
+		}
+		return nil
+	})
+	return repaired, err
+}
+
+// readOnly runs fn like a dry run, whatever DryRun is set to.
+func (m *Migrator) readOnly(fn func(s *session) error) error {
+	dry := *m
+	dry.DryRun = true
+	return dry.run(fn)
+}
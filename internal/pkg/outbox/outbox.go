@@ -0,0 +1,41 @@
+// Package outbox relays domain events written to the outbox table to sinks.
+//
+// Events are inserted in the same transaction as the change they describe,
+// so an event exists if and only if the change was committed. The Relay
+// delivers them at least once, in order per aggregate.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is one row of the outbox table.
+type Event struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"occurred_at"`
+	Attempts      int             `json:"-"`
+}
+
+// NewEvent builds an event with payload encoded as JSON.
+func NewEvent(aggregateType string, aggregateID int64, eventType string, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("could not encode %s payload: %w", eventType, err)
+	}
+	return Event{AggregateType: aggregateType, AggregateID: aggregateID, Type: eventType, Payload: data}, nil
+}
+
+// Sink receives relayed events. Publish must be idempotent on Event.ID:
+// an event is redelivered when any sink fails or the relay stops before
+// marking it published.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event Event) error
+}
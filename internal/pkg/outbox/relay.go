@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// claimQuery picks the oldest pending event of every aggregate that is due.
+// Later events of an aggregate wait until the earlier ones are published, so
+// a failing event holds back its aggregate instead of being overtaken. It
+// pushes next_attempt_at past the lease so the claimed events stay invisible
+// to other relays while they are delivered, without holding a transaction
+// open across the sinks.
+const claimQuery = `
+	UPDATE outbox
+	SET next_attempt_at = timezone('utc', now()) + $2 * interval '1 millisecond'
+	WHERE id IN (
+		SELECT o.id
+		FROM outbox o
+		WHERE o.published_at IS NULL
+			AND o.next_attempt_at <= timezone('utc', now())
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox p
+				WHERE p.published_at IS NULL
+					AND p.aggregate_type = o.aggregate_type
+					AND p.aggregate_id = o.aggregate_id
+					AND p.id < o.id
+			)
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, aggregate_type, aggregate_id, event_type, payload, created_at, attempts`
+
+// Relay moves pending events from the outbox to the sinks.
+type Relay struct {
+	DB    *database.Database
+	Log   *logger.Logger
+	Sinks []Sink
+
+	BatchSize int
+	Interval  time.Duration
+	// Lease hides claimed events from other relays. Events of the batch not
+	// delivered within it are left for the next claim; those of a relay that
+	// died are retried after it.
+	Lease      time.Duration
+	MaxBackoff time.Duration
+}
+
+// Run relays events every Interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		// Drain the backlog before waiting for the next tick.
+		for {
+			n, err := r.RelayOnce(ctx)
+			if err != nil && ctx.Err() == nil && r.Log != nil {
+				r.Log.Error(ctx, fmt.Errorf("outbox relay: %w", err))
+			}
+			if err != nil || n < r.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce delivers one batch and returns how many events it claimed.
+// Delivered events are marked published; failed ones are rescheduled with
+// exponential backoff. Each of these updates commits on its own, so a failed
+// update only affects its event, which is delivered again after the lease.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "outbox.relay")
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	claimedAt := time.Now()
+	events, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, event := range events {
+		// Past the lease another relay may claim the rest of the batch.
+		if time.Since(claimedAt) >= r.lease() {
+			break
+		}
+		if err := r.deliver(ctx, event); err != nil {
+			if err := r.reschedule(ctx, event, err); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := r.markPublished(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(events), errors.Join(errs...)
+}
+
+func (r *Relay) claim(ctx context.Context) ([]Event, error) {
+	rows, err := r.DB.Executor(ctx).QueryContext(ctx, claimQuery, r.batchSize(), r.lease().Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("could not claim events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.AggregateType, &event.AggregateID, &event.Type, &event.Payload, &event.CreatedAt, &event.Attempts); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	// RETURNING does not keep the order of the subquery.
+	slices.SortFunc(events, func(a, b Event) int { return cmp.Compare(a.ID, b.ID) })
+	return events, rows.Err()
+}
+
+// deliver publishes event to every sink. It gets its own span and trace ID so
+// sinks log and trace like request handlers do.
+func (r *Relay) deliver(ctx context.Context, event Event) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "outbox.deliver "+event.Type)
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	span.SetAttributes(
+		attribute.Int64("outbox.event_id", event.ID),
+		attribute.String("outbox.aggregate", fmt.Sprintf("%s/%d", event.AggregateType, event.AggregateID)),
+		attribute.Int("outbox.attempt", event.Attempts+1),
+	)
+
+	var errs []error
+	for _, sink := range r.Sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *Relay) markPublished(ctx context.Context, event Event) error {
+	const q = `UPDATE outbox SET published_at = timezone('utc', now()), attempts = attempts + 1, last_error = NULL WHERE id = $1`
+	if _, err := r.DB.Executor(ctx).ExecContext(ctx, q, event.ID); err != nil {
+		return fmt.Errorf("could not mark event %d published: %w", event.ID, err)
+	}
+	return nil
+}
+
+func (r *Relay) reschedule(ctx context.Context, event Event, cause error) error {
+	delay := Backoff(event.Attempts+1, r.maxBackoff())
+	if r.Log != nil {
+		r.Log.Warn(ctx, fmt.Sprintf("outbox event %d %s failed: %v", event.ID, event.Type, cause), "event_id", event.ID, "event_type", event.Type, "attempt", event.Attempts+1, "retry_in", delay.String())
+	}
+
+	const q = `UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = timezone('utc', now()) + $2 * interval '1 millisecond' WHERE id = $3`
+	message := strings.ToValidUTF8(cause.Error(), "")
+	if _, err := r.DB.Executor(ctx).ExecContext(ctx, q, message, delay.Milliseconds(), event.ID); err != nil {
+		return fmt.Errorf("could not reschedule event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// Backoff returns the wait before the given attempt: one second doubled per
+// failed attempt, capped at limit.
+func Backoff(attempt int, limit time.Duration) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return 100
+	}
+	return r.BatchSize
+}
+
+func (r *Relay) interval() time.Duration {
+	if r.Interval <= 0 {
+		return time.Second
+	}
+	return r.Interval
+}
+
+func (r *Relay) lease() time.Duration {
+	if r.Lease <= 0 {
+		return 5 * time.Minute
+	}
+	return r.Lease
+}
+
+func (r *Relay) maxBackoff() time.Duration {
+	if r.MaxBackoff <= 0 {
+		return time.Hour
+	}
+	return r.MaxBackoff
+}
@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"rest-skeleton/internal/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler processes an event delivered in process.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus delivers events to in-process subscribers.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers fn for eventType. Use "*" to receive every event.
+func (b *Bus) Subscribe(eventType string, fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], fn)
+}
+
+func (b *Bus) Name() string { return "bus" }
+
+// Publish runs the subscribers in registration order and stops at the first error.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[event.Type]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		if err := fn(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogSink writes every event to the application log.
+type LogSink struct {
+	Log *logger.Logger
+}
+
+func (s LogSink) Name() string { return "log" }
+
+func (s LogSink) Publish(ctx context.Context, event Event) error {
+	s.Log.Info(ctx, fmt.Sprintf("event %d %s %s/%d: %s", event.ID, event.Type, event.AggregateType, event.AggregateID, event.Payload))
+	return nil
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookSink posts every event as JSON to URL. Any status outside 2xx is a
+// failure and the event is retried. Receivers deduplicate on the
+// Idempotency-Key header, which carries the event id.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Name() string { return "webhook " + s.URL }
+
+func (s WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("event-%d", event.ID))
+
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s answered %d", s.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// SinksFromEnv builds the sinks listed in OUTBOX_SINKS. The in-process bus is always included.
+func SinksFromEnv(log *logger.Logger, bus *Bus) ([]Sink, error) {
+	sinks := []Sink{bus}
+	for _, name := range strings.Split(os.Getenv("OUTBOX_SINKS"), ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "log":
+			sinks = append(sinks, LogSink{Log: log})
+		case "webhook":
+			for _, url := range strings.Split(os.Getenv("OUTBOX_WEBHOOK_URLS"), ",") {
+				if url = strings.TrimSpace(url); url != "" {
+					sinks = append(sinks, WebhookSink{URL: url})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown outbox sink %q", name)
+		}
+	}
+	return sinks, nil
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBusDeliversToTypedAndWildcardSubscribers(t *testing.T) {
+	bus := NewBus()
+	var got []string
+	bus.Subscribe("UserCreated", func(ctx context.Context, event Event) error {
+		got = append(got, "typed")
+		return nil
+	})
+	bus.Subscribe("*", func(ctx context.Context, event Event) error {
+		got = append(got, "all")
+		return nil
+	})
+
+	if err := bus.Publish(context.Background(), Event{Type: "UserCreated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(context.Background(), Event{Type: "UserDeleted"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 || got[0] != "typed" || got[1] != "all" || got[2] != "all" {
+		t.Errorf("unexpected deliveries %v", got)
+	}
+}
+
+func TestBusReturnsSubscriberError(t *testing.T) {
+	bus := NewBus()
+	errBoom := errors.New("boom")
+	bus.Subscribe("*", func(ctx context.Context, event Event) error { return errBoom })
+
+	if err := bus.Publish(context.Background(), Event{Type: "UserCreated"}); !errors.Is(err, errBoom) {
+		t.Errorf("got %v want boom", err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Event
+	var key string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	event, err := NewEvent("user", 7, "UserCreated", map[string]string{"name": "John"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.ID = 42
+
+	sink := WebhookSink{URL: server.URL}
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if received.ID != 42 || received.Type != "UserCreated" || string(received.Payload) != `{"name":"John"}` {
+		t.Errorf("unexpected delivery %+v", received)
+	}
+	if key != "event-42" {
+		t.Errorf("got Idempotency-Key %q", key)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Publish(context.Background(), event); err == nil {
+		t.Error("expected a 500 answer to fail the delivery")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{30, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt, time.Minute); got != tt.want {
+			t.Errorf("Backoff(%d) = %s want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Package queue runs background jobs through Redis.
+//
+// A job is enqueued ready, or scheduled for later, and picked up by a Worker.
+// While a worker runs it the job is in flight with a visibility deadline the
+// worker keeps extending; a job whose worker died becomes ready again once
+// the deadline passes. Failed jobs are retried with backoff until they run
+// out of attempts and land in the dead-letter set.
+//
+// All keys of a queue share a hash tag, so the Lua scripts that move jobs
+// between sets also work on Redis Cluster.
+package queue
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Priorities. Ready jobs run highest priority first, then oldest first.
+const (
+	PriorityLow     = 0
+	PriorityDefault = 5
+	PriorityHigh    = 9
+)
+
+// ErrDuplicate is returned by Enqueue when a job with the same unique key is
+// still queued or running.
+var ErrDuplicate = errors.New("duplicate job")
+
+// Job is a unit of work stored in Redis.
+type Job struct {
+	ID          string            `json:"id"`
+	Type        string            `json:"type"`
+	Payload     json.RawMessage   `json:"payload"`
+	Priority    int               `json:"priority"`
+	MaxAttempts int               `json:"max_attempts"`
+	UniqueKey   string            `json:"unique_key,omitempty"`
+	Trace       map[string]string `json:"trace,omitempty"`
+	EnqueuedAt  time.Time         `json:"enqueued_at"`
+
+	// Attempt counts the runs so far, including the current one.
+	Attempt int `json:"-"`
+	// LastError is set on dead jobs.
+	LastError string `json:"-"`
+}
+
+// Enqueuer adds jobs to a queue. Usecases depend on it rather than on Queue.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, jobType string, payload any, opts ...Option) (string, error)
+}
+
+// Option configures an enqueued job.
+type Option func(*enqueueOptions)
+
+type enqueueOptions struct {
+	delay     time.Duration
+	runAt     time.Time
+	uniqueTTL time.Duration
+	job       *Job
+}
+
+// Delay runs the job no earlier than d from now.
+func Delay(d time.Duration) Option {
+	return func(o *enqueueOptions) { o.delay = d }
+}
+
+// At runs the job no earlier than t.
+func At(t time.Time) Option {
+	return func(o *enqueueOptions) { o.runAt = t }
+}
+
+// Priority sets the priority, from PriorityLow to PriorityHigh.
+func Priority(p int) Option {
+	return func(o *enqueueOptions) { o.job.Priority = min(max(p, PriorityLow), PriorityHigh) }
+}
+
+// MaxAttempts sets how often the job runs before it is dead-lettered.
+func MaxAttempts(n int) Option {
+	return func(o *enqueueOptions) { o.job.MaxAttempts = max(n, 1) }
+}
+
+// Unique rejects the job with ErrDuplicate while another job with key is
+// queued or running, for at most ttl (a day when ttl is zero).
+func Unique(key string, ttl time.Duration) Option {
+	return func(o *enqueueOptions) {
+		o.job.UniqueKey = key
+		o.uniqueTTL = cmp.Or(ttl, 24*time.Hour)
+	}
+}
+
+// Queue is a named queue in Redis.
+type Queue struct {
+	client redis.UniversalClient
+	name   string
+	now    func() time.Time
+}
+
+// New returns the queue called name.
+func New(client redis.UniversalClient, name string) *Queue {
+	return &Queue{client: client, name: name, now: time.Now}
+}
+
+func (q *Queue) Name() string { return q.name }
+
+func (q *Queue) key(part string) string {
+	return "jobs.{" + q.name + "}." + part
+}
+
+// Enqueue adds a job running jobType with payload encoded as JSON and returns
+// its id. The trace context of ctx travels with the job. For a duplicate
+// unique job it returns the id of the queued job and ErrDuplicate.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload any, opts ...Option) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("could not encode %s payload: %w", jobType, err)
+	}
+
+	job := &Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		Payload:     data,
+		Priority:    PriorityDefault,
+		MaxAttempts: 5,
+		Trace:       map[string]string{},
+		EnqueuedAt:  q.now(),
+	}
+	o := enqueueOptions{job: job}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(job.Trace))
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	var runAt int64
+	if o.delay > 0 {
+		o.runAt = job.EnqueuedAt.Add(o.delay)
+	}
+	if o.runAt.After(job.EnqueuedAt) {
+		runAt = o.runAt.UnixMilli()
+	}
+	keys := []string{q.key("ready"), q.key("scheduled"), q.key("data"), q.key("score"), q.key("unique." + job.UniqueKey)}
+	id, err := enqueueScript.Run(ctx, q.client, keys, job.ID, encoded, readyScore(job), runAt, o.uniqueTTL.Milliseconds()).Text()
+	if err != nil {
+		return "", fmt.Errorf("could not enqueue %s: %w", jobType, err)
+	}
+	if id != job.ID {
+		return id, ErrDuplicate
+	}
+	return id, nil
+}
+
+// readyScore orders the ready set by priority, then enqueue time.
+func readyScore(job *Job) float64 {
+	return float64(PriorityHigh-job.Priority)*1e13 + float64(job.EnqueuedAt.UnixMilli())
+}
+
+// dequeue moves due scheduled jobs and expired in-flight jobs to the ready
+// set, then takes the next ready job in flight until the visibility deadline.
+func (q *Queue) dequeue(ctx context.Context, visibility time.Duration) (*Job, error) {
+	keys := []string{q.key("ready"), q.key("scheduled"), q.key("inflight"), q.key("data"), q.key("score"), q.key("attempts")}
+	result, err := dequeueScript.Run(ctx, q.client, keys, q.now().UnixMilli(), visibility.Milliseconds()).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not dequeue: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(result[1].(string)), &job); err != nil {
+		return nil, fmt.Errorf("could not decode job %v: %w", result[0], err)
+	}
+	job.Attempt = int(result[2].(int64))
+	return &job, nil
+}
+
+// extend pushes the visibility deadline of a running job.
+func (q *Queue) extend(ctx context.Context, job *Job, visibility time.Duration) error {
+	deadline := float64(q.now().Add(visibility).UnixMilli())
+	return q.client.ZAddXX(ctx, q.key("inflight"), &redis.Z{Score: deadline, Member: job.ID}).Err()
+}
+
+// ack removes a finished job.
+func (q *Queue) ack(ctx context.Context, job *Job) error {
+	keys := []string{q.key("inflight"), q.key("data"), q.key("score"), q.key("attempts"), q.key("errors"), q.key("unique." + job.UniqueKey)}
+	return ackScript.Run(ctx, q.client, keys, job.ID).Err()
+}
+
+// retry schedules a failed job to run again at runAt.
+func (q *Queue) retry(ctx context.Context, job *Job, runAt time.Time, cause error) error {
+	keys := []string{q.key("inflight"), q.key("scheduled"), q.key("errors")}
+	return retryScript.Run(ctx, q.client, keys, job.ID, runAt.UnixMilli(), cause.Error()).Err()
+}
+
+// bury moves a job to the dead-letter set.
+func (q *Queue) bury(ctx context.Context, job *Job, cause error) error {
+	keys := []string{q.key("inflight"), q.key("dead"), q.key("errors"), q.key("unique." + job.UniqueKey)}
+	return buryScript.Run(ctx, q.client, keys, job.ID, q.now().UnixMilli(), cause.Error()).Err()
+}
+
+// Dead returns up to limit dead-lettered jobs, most recent first.
+func (q *Queue) Dead(ctx context.Context, limit int) ([]Job, error) {
+	ids, err := q.client.ZRevRange(ctx, q.key("dead"), 0, int64(limit)-1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	data, err := q.client.HMGet(ctx, q.key("data"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	causes, err := q.client.HMGet(ctx, q.key("errors"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := q.client.HMGet(ctx, q.key("attempts"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, 0, len(ids))
+	for i := range ids {
+		encoded, ok := data[i].(string)
+		if !ok {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(encoded), &job); err != nil {
+			return nil, err
+		}
+		job.LastError, _ = causes[i].(string)
+		if n, ok := attempts[i].(string); ok {
+			fmt.Sscan(n, &job.Attempt)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Requeue makes a dead job ready again with a fresh set of attempts.
+func (q *Queue) Requeue(ctx context.Context, id string) error {
+	keys := []string{q.key("dead"), q.key("ready"), q.key("score"), q.key("attempts"), q.key("errors")}
+	n, err := requeueScript.Run(ctx, q.client, keys, id).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("job %s is not dead", id)
+	}
+	return nil
+}
+
+// Stats counts the jobs in every state.
+type Stats struct {
+	Ready     int64 `json:"ready"`
+	Scheduled int64 `json:"scheduled"`
+	InFlight  int64 `json:"in_flight"`
+	Dead      int64 `json:"dead"`
+}
+
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	pipe := q.client.Pipeline()
+	ready := pipe.ZCard(ctx, q.key("ready"))
+	scheduled := pipe.ZCard(ctx, q.key("scheduled"))
+	inflight := pipe.ZCard(ctx, q.key("inflight"))
+	dead := pipe.ZCard(ctx, q.key("dead"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Stats{}, err
+	}
+	return Stats{Ready: ready.Val(), Scheduled: scheduled.Val(), InFlight: inflight.Val(), Dead: dead.Val()}, nil
+}
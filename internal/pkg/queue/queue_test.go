@@ -0,0 +1,278 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"rest-skeleton/internal/pkg/myctx"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestQueue(t *testing.T) (*Queue, *clock) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	c := &clock{now: time.Now()}
+	q := New(client, "test")
+	q.now = c.Now
+	return q, c
+}
+
+func testContext() context.Context {
+	return context.WithValue(context.Background(), myctx.Key("traceID"), "test")
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+var greet = Task[greeting]{Type: "greet"}
+
+func TestTaskRoundTrip(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := testContext()
+
+	var got []string
+	w := NewWorker(q, nil)
+	greet.Register(w, func(ctx context.Context, payload greeting) error {
+		got = append(got, payload.Name)
+		return nil
+	})
+
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "John"}); err != nil {
+		t.Fatal(err)
+	}
+	if worked, err := w.Work(ctx); !worked || err != nil {
+		t.Fatalf("got %v, %v", worked, err)
+	}
+	if len(got) != 1 || got[0] != "John" {
+		t.Errorf("unexpected payloads %v", got)
+	}
+
+	if stats, _ := q.Stats(ctx); stats != (Stats{}) {
+		t.Errorf("expected an empty queue after ack, got %+v", stats)
+	}
+}
+
+func TestPriorityThenAge(t *testing.T) {
+	q, c := newTestQueue(t)
+	ctx := testContext()
+
+	var got []string
+	w := NewWorker(q, nil)
+	greet.Register(w, func(ctx context.Context, payload greeting) error {
+		got = append(got, payload.Name)
+		return nil
+	})
+
+	greet.Enqueue(ctx, q, greeting{Name: "low"}, Priority(PriorityLow))
+	c.Advance(time.Millisecond)
+	greet.Enqueue(ctx, q, greeting{Name: "first"})
+	c.Advance(time.Millisecond)
+	greet.Enqueue(ctx, q, greeting{Name: "second"})
+	c.Advance(time.Millisecond)
+	greet.Enqueue(ctx, q, greeting{Name: "high"}, Priority(PriorityHigh))
+
+	for i := 0; i < 4; i++ {
+		w.Work(ctx)
+	}
+	want := []string{"high", "first", "second", "low"}
+	for i := range want {
+		if i >= len(got) || got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+}
+
+func TestDelayedJobWaits(t *testing.T) {
+	q, c := newTestQueue(t)
+	ctx := testContext()
+
+	w := NewWorker(q, nil)
+	w.Register("greet", func(ctx context.Context, job *Job) error { return nil })
+	greet.Enqueue(ctx, q, greeting{Name: "later"}, Delay(time.Minute))
+
+	if worked, _ := w.Work(ctx); worked {
+		t.Fatal("expected the delayed job to wait")
+	}
+	c.Advance(time.Minute)
+	if worked, _ := w.Work(ctx); !worked {
+		t.Fatal("expected the delayed job to run once due")
+	}
+}
+
+func TestUniqueJobs(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := testContext()
+
+	w := NewWorker(q, nil)
+	w.Register("greet", func(ctx context.Context, job *Job) error { return nil })
+
+	first, err := greet.Enqueue(ctx, q, greeting{Name: "John"}, Unique("greet:john", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := greet.Enqueue(ctx, q, greeting{Name: "John"}, Unique("greet:john", time.Hour))
+	if !errors.Is(err, ErrDuplicate) || second != first {
+		t.Fatalf("expected duplicate of %s, got %s, %v", first, second, err)
+	}
+
+	w.Work(ctx)
+	if _, err := greet.Enqueue(ctx, q, greeting{Name: "John"}, Unique("greet:john", time.Hour)); err != nil {
+		t.Errorf("expected the key to be released after the job ran, got %v", err)
+	}
+}
+
+func TestRetryThenDeadLetter(t *testing.T) {
+	q, c := newTestQueue(t)
+	ctx := testContext()
+
+	w := NewWorker(q, nil)
+	w.MaxBackoff = time.Minute
+	runs := 0
+	w.Register("greet", func(ctx context.Context, job *Job) error {
+		runs++
+		return errors.New("smtp down")
+	})
+	id, _ := greet.Enqueue(ctx, q, greeting{Name: "John"}, MaxAttempts(3))
+
+	for i := 0; i < 3; i++ {
+		if worked, err := w.Work(ctx); !worked || err != nil {
+			t.Fatalf("run %d: got %v, %v", i+1, worked, err)
+		}
+		if worked, _ := w.Work(ctx); worked {
+			t.Fatalf("run %d: expected backoff before the retry", i+1)
+		}
+		c.Advance(time.Minute)
+	}
+
+	dead, err := q.Dead(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 3 || len(dead) != 1 || dead[0].ID != id || dead[0].Attempt != 3 || dead[0].LastError != "smtp down" {
+		t.Fatalf("expected one dead job after 3 runs, got %d runs and %+v", runs, dead)
+	}
+
+	if err := q.Requeue(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	w.Register("greet", func(ctx context.Context, job *Job) error { return nil })
+	if worked, err := w.Work(ctx); !worked || err != nil {
+		t.Fatalf("expected the requeued job to run, got %v, %v", worked, err)
+	}
+}
+
+func TestPermanentErrorSkipsRetries(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := testContext()
+
+	w := NewWorker(q, nil)
+	greet.Enqueue(ctx, q, greeting{Name: "John"})
+	w.Work(ctx) // no handler registered
+
+	if stats, _ := q.Stats(ctx); stats.Dead != 1 {
+		t.Errorf("expected an unknown job type to be dead-lettered, got %+v", stats)
+	}
+}
+
+func TestExpiredVisibilityMakesJobReadyAgain(t *testing.T) {
+	q, c := newTestQueue(t)
+	ctx := testContext()
+	greet.Enqueue(ctx, q, greeting{Name: "John"})
+
+	// A worker takes the job and dies without acking it.
+	job, err := q.dequeue(ctx, 30*time.Second)
+	if err != nil || job == nil {
+		t.Fatalf("got %v, %v", job, err)
+	}
+	if again, _ := q.dequeue(ctx, 30*time.Second); again != nil {
+		t.Fatal("expected the in-flight job to be hidden")
+	}
+
+	c.Advance(31 * time.Second)
+	again, err := q.dequeue(ctx, 30*time.Second)
+	if err != nil || again == nil || again.ID != job.ID || again.Attempt != 2 {
+		t.Fatalf("expected job %s on attempt 2, got %+v, %v", job.ID, again, err)
+	}
+}
+
+func TestTraceContextTravelsWithJob(t *testing.T) {
+	q, _ := newTestQueue(t)
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(testContext(), "request")
+	want := span.SpanContext().TraceID()
+	span.End()
+
+	var got trace.TraceID
+	w := NewWorker(q, nil)
+	w.Register("greet", func(ctx context.Context, job *Job) error {
+		got = trace.SpanContextFromContext(ctx).TraceID()
+		return nil
+	})
+	greet.Enqueue(ctx, q, greeting{Name: "John"})
+	w.Work(testContext())
+
+	if got != want {
+		t.Errorf("job ran in trace %s want %s", got, want)
+	}
+}
+
+func TestRunFinishesJobsOnShutdown(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx, cancel := context.WithCancel(testContext())
+
+	started := make(chan struct{})
+	finished := false
+	w := NewWorker(q, nil)
+	w.PollInterval = 10 * time.Millisecond
+	w.Register("greet", func(jobCtx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		finished = jobCtx.Err() == nil
+		return nil
+	})
+	greet.Enqueue(ctx, q, greeting{Name: "John"})
+
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	if !finished {
+		t.Error("expected the running job to finish with a live context")
+	}
+	if stats, _ := q.Stats(testContext()); stats != (Stats{}) {
+		t.Errorf("expected the job to be acked, got %+v", stats)
+	}
+}
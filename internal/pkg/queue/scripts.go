@@ -0,0 +1,82 @@
+package queue
+
+import "github.com/go-redis/redis/v8"
+
+// enqueueScript stores the job and adds it to the ready or scheduled set.
+// A unique job first claims its unique key; when another job holds it, the
+// id of that job is returned instead.
+var enqueueScript = redis.NewScript(`
+if ARGV[5] ~= '0' then
+	if not redis.call('set', KEYS[5], ARGV[1], 'NX', 'PX', ARGV[5]) then
+		return redis.call('get', KEYS[5])
+	end
+end
+redis.call('hset', KEYS[3], ARGV[1], ARGV[2])
+redis.call('hset', KEYS[4], ARGV[1], ARGV[3])
+if ARGV[4] ~= '0' then
+	redis.call('zadd', KEYS[2], ARGV[4], ARGV[1])
+else
+	redis.call('zadd', KEYS[1], ARGV[3], ARGV[1])
+end
+return ARGV[1]`)
+
+var dequeueScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+for _, from in ipairs({KEYS[2], KEYS[3]}) do
+	for _, id in ipairs(redis.call('zrangebyscore', from, '-inf', now, 'LIMIT', 0, 100)) do
+		redis.call('zrem', from, id)
+		redis.call('zadd', KEYS[1], redis.call('hget', KEYS[5], id) or 0, id)
+	end
+end
+while true do
+	local popped = redis.call('zpopmin', KEYS[1])
+	if #popped == 0 then
+		return false
+	end
+	local id = popped[1]
+	local data = redis.call('hget', KEYS[4], id)
+	if data then
+		redis.call('zadd', KEYS[3], now + tonumber(ARGV[2]), id)
+		return {id, data, redis.call('hincrby', KEYS[6], id, 1)}
+	end
+end`)
+
+var ackScript = redis.NewScript(`
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+for i = 2, 5 do
+	redis.call('hdel', KEYS[i], ARGV[1])
+end
+if redis.call('get', KEYS[6]) == ARGV[1] then
+	redis.call('del', KEYS[6])
+end
+return 1`)
+
+var retryScript = redis.NewScript(`
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('zadd', KEYS[2], ARGV[2], ARGV[1])
+redis.call('hset', KEYS[3], ARGV[1], ARGV[3])
+return 1`)
+
+var buryScript = redis.NewScript(`
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('zadd', KEYS[2], ARGV[2], ARGV[1])
+redis.call('hset', KEYS[3], ARGV[1], ARGV[3])
+if redis.call('get', KEYS[4]) == ARGV[1] then
+	redis.call('del', KEYS[4])
+end
+return 1`)
+
+var requeueScript = redis.NewScript(`
+if redis.call('zrem', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('zadd', KEYS[2], redis.call('hget', KEYS[3], ARGV[1]) or 0, ARGV[1])
+redis.call('hdel', KEYS[4], ARGV[1])
+redis.call('hdel', KEYS[5], ARGV[1])
+return 1`)
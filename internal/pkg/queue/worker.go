@@ -0,0 +1,255 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler runs a job. Returning an error retries the job unless it is
+// wrapped with Permanent.
+type Handler func(ctx context.Context, job *Job) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying: the job is dead-lettered at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Task is a job type with a typed payload.
+type Task[T any] struct {
+	Type string
+}
+
+// Enqueue queues payload for the task.
+func (t Task[T]) Enqueue(ctx context.Context, q Enqueuer, payload T, opts ...Option) (string, error) {
+	return q.Enqueue(ctx, t.Type, payload, opts...)
+}
+
+// Register handles the task on w. A payload that does not decode is dead-lettered.
+func (t Task[T]) Register(w *Worker, fn func(ctx context.Context, payload T) error) {
+	w.Register(t.Type, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("could not decode %s payload: %w", t.Type, err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Worker runs the jobs of a queue on a pool of goroutines.
+type Worker struct {
+	Queue *Queue
+	Log   *logger.Logger
+
+	Concurrency int
+	// VisibilityTimeout is how long a job stays hidden after its worker stops
+	// extending it. Running jobs are extended every third of it.
+	VisibilityTimeout time.Duration
+	// JobTimeout bounds a single run.
+	JobTimeout   time.Duration
+	PollInterval time.Duration
+	MaxBackoff   time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+func NewWorker(q *Queue, log *logger.Logger) *Worker {
+	return &Worker{Queue: q, Log: log, handlers: make(map[string]Handler)}
+}
+
+// Register handles jobType with fn.
+func (w *Worker) Register(jobType string, fn Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[jobType] = fn
+}
+
+// Run works jobs until ctx is done. Jobs already running are finished
+// before Run returns, so shutdown does not abandon them mid-way.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				worked, err := w.Work(ctx)
+				if err != nil && ctx.Err() == nil && w.Log != nil {
+					w.Log.Error(ctx, fmt.Errorf("job worker %s: %w", w.Queue.Name(), err), "queue", w.Queue.Name())
+				}
+				if worked && err == nil {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(w.pollInterval()):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Work runs the next ready job, if any, and reports whether there was one.
+func (w *Worker) Work(ctx context.Context) (bool, error) {
+	job, err := w.Queue.dequeue(ctx, w.visibilityTimeout())
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	// The job keeps running when ctx is cancelled for shutdown; it is only
+	// bounded by JobTimeout.
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.jobTimeout())
+	defer cancel()
+	return true, w.run(jobCtx, job)
+}
+
+func (w *Worker) run(ctx context.Context, job *Job) error {
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(job.Trace))
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "job "+job.Type, trace.WithSpanKind(trace.SpanKindConsumer))
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	span.SetAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.queue", w.Queue.Name()),
+		attribute.Int("job.attempt", job.Attempt),
+	)
+
+	stop := w.keepVisible(ctx, job)
+	err := w.handle(ctx, job)
+	stop()
+
+	if err == nil {
+		return w.Queue.ack(ctx, job)
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	var permanent permanentError
+	if errors.As(err, &permanent) || job.Attempt >= job.MaxAttempts {
+		w.logf(ctx, "job %s %s failed (attempt %d), moving to dead letter: %v", job.Type, job.ID, job.Attempt, err)
+		return w.Queue.bury(ctx, job, err)
+	}
+
+	delay := Backoff(job.Attempt, w.maxBackoff())
+	w.logf(ctx, "job %s %s failed (attempt %d), retrying in %s: %v", job.Type, job.ID, job.Attempt, delay, err)
+	return w.Queue.retry(ctx, job, w.Queue.now().Add(delay), err)
+}
+
+func (w *Worker) handle(ctx context.Context, job *Job) (err error) {
+	w.mu.RLock()
+	fn, ok := w.handlers[job.Type]
+	w.mu.RUnlock()
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %s", job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx, job)
+}
+
+// keepVisible extends the visibility deadline of job until the returned func is called.
+func (w *Worker) keepVisible(ctx context.Context, job *Job) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(w.visibilityTimeout() / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := w.Queue.extend(ctx, job, w.visibilityTimeout()); err != nil {
+					w.logf(ctx, "could not extend job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+func (w *Worker) logf(ctx context.Context, format string, args ...any) {
+	if w.Log != nil {
+		w.Log.Info(ctx, fmt.Sprintf(format, args...))
+	}
+}
+
+// Backoff returns the wait before retrying after the given failed attempt:
+// one second doubled per attempt and capped at limit, of which a random half
+// is jitter.
+func Backoff(attempt int, limit time.Duration) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func (w *Worker) concurrency() int {
+	if w.Concurrency <= 0 {
+		return 4
+	}
+	return w.Concurrency
+}
+
+func (w *Worker) visibilityTimeout() time.Duration {
+	if w.VisibilityTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return w.VisibilityTimeout
+}
+
+func (w *Worker) jobTimeout() time.Duration {
+	if w.JobTimeout <= 0 {
+		return 5 * time.Minute
+	}
+	return w.JobTimeout
+}
+
+func (w *Worker) pollInterval() time.Duration {
+	if w.PollInterval <= 0 {
+		return time.Second
+	}
+	return w.PollInterval
+}
+
+func (w *Worker) maxBackoff() time.Duration {
+	if w.MaxBackoff <= 0 {
+		return time.Hour
+	}
+	return w.MaxBackoff
+}
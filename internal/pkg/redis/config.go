@@ -0,0 +1,206 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Config describes how to reach Redis.
+type Config struct {
+	Mode string
+	// Addrs holds the server address in standalone mode, the sentinel addresses
+	// in sentinel mode and the seed nodes in cluster mode.
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int
+
+	TLS       bool
+	TLSCACert string
+
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	TTL time.Duration
+}
+
+// ConfigFromEnv reads the REDIS_* environment variables.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Mode:             os.Getenv("REDIS_MODE"),
+		MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		TLSCACert:        os.Getenv("REDIS_TLS_CA_CERT"),
+		TTL:              24 * time.Hour,
+	}
+
+	if cfg.Mode == "" {
+		cfg.Mode = ModeStandalone
+	}
+
+	for _, addr := range strings.Split(os.Getenv("REDIS_HOST"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Addrs = append(cfg.Addrs, addr)
+		}
+	}
+
+	var err error
+	if cfg.DB, err = envInt("REDIS_DB"); err != nil {
+		return cfg, err
+	}
+	if cfg.PoolSize, err = envInt("REDIS_POOL_SIZE"); err != nil {
+		return cfg, err
+	}
+	if cfg.MinIdleConns, err = envInt("REDIS_MIN_IDLE_CONNS"); err != nil {
+		return cfg, err
+	}
+	if cfg.DialTimeout, err = envDuration("REDIS_DIAL_TIMEOUT"); err != nil {
+		return cfg, err
+	}
+	if cfg.ReadTimeout, err = envDuration("REDIS_READ_TIMEOUT"); err != nil {
+		return cfg, err
+	}
+	if cfg.WriteTimeout, err = envDuration("REDIS_WRITE_TIMEOUT"); err != nil {
+		return cfg, err
+	}
+
+	if v := os.Getenv("REDIS_TLS"); v != "" {
+		if cfg.TLS, err = strconv.ParseBool(v); err != nil {
+			return cfg, fmt.Errorf("invalid REDIS_TLS: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func newClient(cfg Config) (redis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, fmt.Errorf("no redis address configured")
+	}
+
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Mode {
+	case "", ModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.Addrs[0],
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("REDIS_MASTER_NAME is required in sentinel mode")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     cfg.MinIdleConns,
+			DialTimeout:      cfg.DialTimeout,
+			ReadTimeout:      cfg.ReadTimeout,
+			WriteTimeout:     cfg.WriteTimeout,
+		}), nil
+	case ModeCluster:
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("redis cluster only supports DB 0")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Username:     cfg.Username,
+			Password:     cfg.Password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: cfg.MinIdleConns,
+			DialTimeout:  cfg.DialTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
+}
+
+func (cfg Config) tlsConfig() (*tls.Config, error) {
+	if !cfg.TLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCACert == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(cfg.TLSCACert)
+	if err != nil {
+		return nil, fmt.Errorf("could not read redis CA cert: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", cfg.TLSCACert)
+	}
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
+
+func envInt(name string) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func envDuration(name string) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
@@ -16,23 +16,23 @@ type Cache struct {
 
 const apqPrefix = ""
 
-// NewCache to create new object Cache
-func NewCache(ctx context.Context, redisAddress string, password string, ttl time.Duration) (*Cache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisAddress,
-		Password: password, // no password set
-		DB:       0,        // use default DB
-	})
-
-	err := client.Ping(ctx).Err()
+// NewCache to create new object Cache. The client type follows cfg.Mode.
+func NewCache(ctx context.Context, cfg Config) (*Cache, error) {
+	client, err := newClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not create cache: %w", err)
 	}
 
-	return &Cache{client: client, ttl: ttl}, nil
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("could not create cache: %w", err)
+	}
+
+	return &Cache{client: client, ttl: cfg.TTL}, nil
 }
 
-func NewCacheWithClient(ctx context.Context, client *redis.Client, ttl time.Duration) *Cache {
+func NewCacheWithClient(ctx context.Context, client redis.UniversalClient, ttl time.Duration) *Cache {
 	return &Cache{client: client, ttl: ttl}
 }
 
@@ -44,34 +44,37 @@ func (c *Cache) Exists(ctx context.Context, key string) bool {
 	return c.client.Exists(ctx, apqPrefix+key).Val() == 1
 }
 
-// SetTTL cache
-func (c *Cache) SetTTL(ttl time.Duration) {
-	c.ttl = ttl
-}
-
-// ResetTTL cache
-func (c *Cache) ResetTTL() {
-	c.ttl = 24 * time.Hour
-}
-
-// Add cache
-func (c *Cache) Add(ctx context.Context, key string, value interface{}) {
-	c.client.Set(ctx, apqPrefix+key, value, c.ttl)
+// Set cache. A zero ttl uses the default ttl of the cache.
+func (c *Cache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	return c.client.Set(ctx, apqPrefix+key, value, ttl).Err()
 }
 
 // Get Cache
-func (c *Cache) Get(ctx context.Context, key string) (interface{}, bool) {
-	s, err := c.client.Get(ctx, apqPrefix+key).Result()
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	b, err := c.client.Get(ctx, apqPrefix+key).Bytes()
 	if err != nil {
-		return struct{}{}, false
+		return nil, false
 	}
-	return s, true
+	return b, true
 }
 
-// DeleteByPrefix cache
+// DeleteByPrefix cache. In cluster mode every master is scanned, since SCAN only walks one node.
 func (c *Cache) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return c.deleteByPrefix(ctx, master, prefix)
+		})
+	}
+
+	return c.deleteByPrefix(ctx, c.client, prefix)
+}
+
+func (c *Cache) deleteByPrefix(ctx context.Context, node redis.Cmdable, prefix string) error {
 	var err error
-	iter := c.client.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	iter := node.Scan(ctx, 0, apqPrefix+prefix+"*", 0).Iterator()
 	for iter.Next(ctx) {
 		err = c.Del(ctx, iter.Val())
 		if err != nil {
@@ -79,10 +82,117 @@ func (c *Cache) DeleteByPrefix(ctx context.Context, prefix string) error {
 		}
 	}
 
-	return nil
+	return iter.Err()
 }
 
-// Del cache
+// Del cache. In cluster mode keys are deleted one by one because they may live in different slots.
 func (c *Cache) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if _, ok := c.client.(*redis.ClusterClient); ok {
+		pipe := c.client.Pipeline()
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+
 	return c.client.Del(ctx, keys...).Err()
 }
+
+const tagPrefix = "tags."
+
+// Tag records key as a member of every tag so it can be evicted by InvalidateTags.
+func (c *Cache) Tag(ctx context.Context, key string, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	for _, tag := range tags {
+		pipe.SAdd(ctx, apqPrefix+tagPrefix+tag, key)
+		pipe.Expire(ctx, apqPrefix+tagPrefix+tag, c.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// TagMembers returns the keys recorded under the given tags.
+func (c *Cache) TagMembers(ctx context.Context, tags ...string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	// SUNION is avoided so tags hashing to different cluster slots still work.
+	seen := make(map[string]struct{})
+	keys := make([]string, 0)
+	for _, tag := range tags {
+		members, err := c.client.SMembers(ctx, apqPrefix+tagPrefix+tag).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if _, ok := seen[member]; !ok {
+				seen[member] = struct{}{}
+				keys = append(keys, member)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// InvalidateTags deletes every key recorded under the given tags, and the tags themselves.
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	keys, err := c.TagMembers(ctx, tags...)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		keys = append(keys, tagPrefix+tag)
+	}
+	return c.Del(ctx, keys...)
+}
+
+// Publish sends message to every subscriber of channel.
+func (c *Cache) Publish(ctx context.Context, channel string, message []byte) error {
+	return c.client.Publish(ctx, apqPrefix+channel, message).Err()
+}
+
+// Subscribe listens on channel until ctx is done. The returned channel is closed afterwards.
+func (c *Cache) Subscribe(ctx context.Context, channel string) <-chan []byte {
+	pubsub := c.client.Subscribe(ctx, apqPrefix+channel)
+	out := make(chan []byte)
+
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case out <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Client exposes the underlying client for packages building primitives on top of Redis.
+func (c *Cache) Client() redis.UniversalClient {
+	return c.client
+}
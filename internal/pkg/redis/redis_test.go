@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCache(t *testing.T, mode string) (*Cache, *miniredis.Miniredis) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+
+	c, err := NewCache(context.Background(), Config{Mode: mode, Addrs: []string{srv.Addr()}, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c, srv
+}
+
+func TestDeleteByPrefix(t *testing.T) {
+	for _, mode := range []string{ModeStandalone, ModeCluster} {
+		t.Run(mode, func(t *testing.T) {
+			ctx := context.Background()
+			c, srv := newTestCache(t, mode)
+
+			c.Set(ctx, "users.1", []byte("1"), 0)
+			c.Set(ctx, "users.2", []byte("2"), 0)
+			c.Set(ctx, "roles.1", []byte("3"), 0)
+
+			if err := c.DeleteByPrefix(ctx, "users."); err != nil {
+				t.Fatal(err)
+			}
+
+			if keys := srv.Keys(); len(keys) != 1 || keys[0] != "roles.1" {
+				t.Errorf("expected only roles.1 to remain, got %v", keys)
+			}
+		})
+	}
+}
+
+func TestSetUsesPerCallTTL(t *testing.T) {
+	ctx := context.Background()
+	c, srv := newTestCache(t, ModeStandalone)
+
+	c.Set(ctx, "short", []byte("x"), time.Minute)
+	c.Set(ctx, "default", []byte("y"), 0)
+
+	if ttl := srv.TTL("short"); ttl != time.Minute {
+		t.Errorf("got ttl %v want 1m", ttl)
+	}
+	if ttl := srv.TTL("default"); ttl != time.Hour {
+		t.Errorf("got ttl %v want 1h", ttl)
+	}
+}
+
+func TestInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCache(t, ModeCluster)
+
+	c.Set(ctx, "users.1", []byte("1"), 0)
+	c.Set(ctx, "users.list.", []byte("[1]"), 0)
+	c.Tag(ctx, "users.1", "user.1")
+	c.Tag(ctx, "users.list.", "user.1", "users.list")
+
+	if err := c.InvalidateTags(ctx, "user.1"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Exists(ctx, "users.1") || c.Exists(ctx, "users.list.") {
+		t.Error("expected tagged keys to be deleted")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_MODE", ModeSentinel)
+	t.Setenv("REDIS_HOST", "sentinel-1:26379, sentinel-2:26379")
+	t.Setenv("REDIS_MASTER_NAME", "mymaster")
+	t.Setenv("REDIS_USERNAME", "app")
+	t.Setenv("REDIS_DB", "2")
+	t.Setenv("REDIS_POOL_SIZE", "20")
+	t.Setenv("REDIS_READ_TIMEOUT", "2s")
+	t.Setenv("REDIS_TLS", "true")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Mode != ModeSentinel || len(cfg.Addrs) != 2 || cfg.Addrs[1] != "sentinel-2:26379" {
+		t.Errorf("unexpected mode or addrs: %+v", cfg)
+	}
+	if cfg.MasterName != "mymaster" || cfg.Username != "app" || cfg.DB != 2 || cfg.PoolSize != 20 {
+		t.Errorf("unexpected options: %+v", cfg)
+	}
+	if cfg.ReadTimeout != 2*time.Second || !cfg.TLS {
+		t.Errorf("unexpected timeout or tls: %+v", cfg)
+	}
+
+	if _, err := newClient(Config{Mode: ModeSentinel, Addrs: cfg.Addrs}); err == nil {
+		t.Error("expected sentinel mode without master name to fail")
+	}
+	if _, err := newClient(Config{Mode: ModeCluster, Addrs: cfg.Addrs, DB: 1}); err == nil {
+		t.Error("expected cluster mode with a DB index to fail")
+	}
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a task runs next.
+type Schedule interface {
+	// Next returns the first run strictly after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Parse reads a five-field cron expression (minute hour day-of-month month
+// day-of-week) or one of the macros @yearly, @monthly, @weekly, @daily,
+// @hourly and @every <duration>. Fields accept *, lists, ranges and steps;
+// Sunday is 0 or 7. When both day fields are restricted a day matching
+// either runs, as in cron.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid interval in %q", expr)
+		}
+		return every(d), nil
+	}
+
+	switch expr {
+	case "@yearly", "@annually":
+		expr = "0 0 1 1 *"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@hourly":
+		expr = "0 * * * *"
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var s cron
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.anyDay = fields[2] == "*" || fields[4] == "*"
+	return s, nil
+}
+
+// parseField turns a field into a bit set of the allowed values.
+func parseField(field string, low, high int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		start, end := low, high
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			if end, err = strconv.Atoi(to); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			start = n
+			if !hasStep {
+				end = n
+			}
+		}
+
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, low, high)
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	anyDay                        bool
+}
+
+func (c cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	// Five years covers every valid expression, including 29 February.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Truncate(time.Duration(e)).Add(time.Duration(e))
+}
@@ -0,0 +1,254 @@
+// Package scheduler runs recurring maintenance tasks on cron schedules.
+//
+// Run the Scheduler as a job of the leader elector so only one instance
+// schedules tasks. Each run also holds a per-task lock, which keeps runs
+// from overlapping across a leadership change or with a run started by hand.
+// Tasks marked PerInstance go in a second scheduler that every instance runs.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"rest-skeleton/internal/pkg/lock"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrRunning is returned when a task is started while a run is still going.
+var ErrRunning = errors.New("task is already running")
+
+// Task is a recurring unit of work.
+type Task struct {
+	Name        string
+	Description string
+	// Schedule is a cron expression, see Parse.
+	Schedule string
+	// Jitter delays every run by a random duration up to Jitter, so replicas
+	// and neighbouring tasks do not all hit the database on the minute.
+	Jitter time.Duration
+	// Timeout bounds a run; it defaults to one hour.
+	Timeout time.Duration
+	// PerInstance tasks work on local state, such as log files, and must run
+	// on every instance: they take no lock and belong in a scheduler that is
+	// not behind the elector.
+	PerInstance bool
+	Run         func(ctx context.Context) error
+}
+
+type entry struct {
+	Task
+	schedule Schedule
+	running  atomic.Bool
+}
+
+// Scheduler runs tasks on their schedules.
+type Scheduler struct {
+	Log *logger.Logger
+	// Locker guards runs across instances. Without it runs only avoid
+	// overlapping within this process.
+	Locker *lock.Locker
+	// Location evaluates the cron expressions; it defaults to UTC.
+	Location *time.Location
+
+	tasks    map[string]*entry
+	runs     metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func New(log *logger.Logger, locker *lock.Locker) *Scheduler {
+	return &Scheduler{Log: log, Locker: locker, tasks: make(map[string]*entry)}
+}
+
+// RegisterMetrics records a run counter and a duration histogram, both
+// labelled with the task name and outcome.
+func (s *Scheduler) RegisterMetrics(meter metric.Meter) error {
+	var err error
+	s.runs, err = meter.Int64Counter("scheduler.task.runs", metric.WithDescription("Scheduled task runs by outcome"))
+	if err != nil {
+		return err
+	}
+	s.duration, err = meter.Float64Histogram("scheduler.task.duration", metric.WithUnit("s"), metric.WithDescription("Duration of scheduled task runs"))
+	return err
+}
+
+// Add registers task. It fails on an invalid schedule or a duplicate name.
+func (s *Scheduler) Add(task Task) error {
+	schedule, err := Parse(task.Schedule)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", task.Name, err)
+	}
+	if _, ok := s.tasks[task.Name]; ok {
+		return fmt.Errorf("task %s is already registered", task.Name)
+	}
+	s.tasks[task.Name] = &entry{Task: task, schedule: schedule}
+	return nil
+}
+
+// Entry describes a registered task.
+type Entry struct {
+	Task
+	Next time.Time
+}
+
+// Tasks lists the registered tasks by name with their next run after now.
+func (s *Scheduler) Tasks(now time.Time) []Entry {
+	list := make([]Entry, 0, len(s.tasks))
+	for _, e := range s.tasks {
+		list = append(list, Entry{Task: e.Task, Next: e.schedule.Next(now.In(s.location()))})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Run schedules every task until ctx is done and waits for running tasks to return.
+func (s *Scheduler) Run(ctx context.Context) {
+	var loops, runs sync.WaitGroup
+	for _, e := range s.tasks {
+		loops.Add(1)
+		go func(e *entry) {
+			defer loops.Done()
+			s.loop(ctx, e, &runs)
+		}(e)
+	}
+	loops.Wait()
+	runs.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry, runs *sync.WaitGroup) {
+	for {
+		next := e.schedule.Next(time.Now().In(s.location()))
+		if next.IsZero() {
+			return
+		}
+		wait := time.Until(next)
+		if e.Jitter > 0 {
+			wait += rand.N(e.Jitter)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		// A run that outlasts the interval makes the next one skip rather
+		// than pile up; RunTask logs the skip.
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			s.RunTask(ctx, e.Name)
+		}()
+	}
+}
+
+// RunTask runs the named task now. It returns ErrRunning when a run of the
+// task is in progress here or on another instance.
+func (s *Scheduler) RunTask(ctx context.Context, name string) error {
+	e, ok := s.tasks[name]
+	if !ok {
+		return fmt.Errorf("unknown task %s", name)
+	}
+
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "scheduler.run "+name)
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	if !e.running.CompareAndSwap(false, true) {
+		s.record(ctx, name, "skipped", 0)
+		s.logf(ctx, "task %s skipped: previous run still in progress", name)
+		return ErrRunning
+	}
+	defer e.running.Store(false)
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = time.Hour
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	s.logf(ctx, "task %s started", name)
+	err := s.withLock(ctx, e, e.Run)
+	elapsed := time.Since(start)
+
+	switch {
+	case errors.Is(err, ErrRunning):
+		s.record(ctx, name, "skipped", 0)
+		s.logf(ctx, "task %s skipped: running on another instance", name)
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		s.record(ctx, name, "failure", elapsed)
+		if s.Log != nil {
+			s.Log.Error(ctx, fmt.Errorf("task %s failed after %s: %w", name, elapsed.Round(time.Millisecond), err))
+		}
+	default:
+		s.record(ctx, name, "success", elapsed)
+		s.logf(ctx, "task %s finished in %s", name, elapsed.Round(time.Millisecond))
+	}
+	return err
+}
+
+// withLock runs fn under the task lock. The lock outlives fn's deadline so a
+// slow run cannot be overlapped by another instance.
+func (s *Scheduler) withLock(ctx context.Context, e *entry, fn func(ctx context.Context) error) error {
+	if s.Locker == nil || e.PerInstance {
+		return fn(ctx)
+	}
+
+	lk, err := s.Locker.TryAcquire(ctx, "scheduler."+e.Name, time.Minute)
+	if err != nil {
+		return err
+	}
+	if lk == nil {
+		return ErrRunning
+	}
+	defer lk.Release(context.WithoutCancel(ctx))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lk.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return fn(ctx)
+}
+
+func (s *Scheduler) record(ctx context.Context, name, status string, elapsed time.Duration) {
+	attrs := metric.WithAttributes(attribute.String("task", name), attribute.String("status", status))
+	if s.runs != nil {
+		s.runs.Add(ctx, 1, attrs)
+	}
+	if s.duration != nil && status != "skipped" {
+		s.duration.Record(ctx, elapsed.Seconds(), attrs)
+	}
+}
+
+func (s *Scheduler) logf(ctx context.Context, format string, args ...any) {
+	if s.Log != nil {
+		s.Log.Info(ctx, fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *Scheduler) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
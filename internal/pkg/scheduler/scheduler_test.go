@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"rest-skeleton/internal/pkg/lock"
+	"rest-skeleton/internal/pkg/myctx"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestParseAndNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"5 3 * * *", time.Date(2024, 2, 1, 3, 5, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1", time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{"20,40 10 * * *", time.Date(2024, 1, 31, 10, 20, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 10m", time.Date(2024, 1, 31, 10, 20, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: next = %s want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every soon"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should fail", expr)
+		}
+	}
+}
+
+func testContext() context.Context {
+	return context.WithValue(context.Background(), myctx.Key("traceID"), "test")
+}
+
+func TestRunTaskPreventsOverlap(t *testing.T) {
+	s := New(nil, nil)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s.Add(Task{Name: "slow", Schedule: "@hourly", Run: func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}})
+
+	done := make(chan error)
+	go func() { done <- s.RunTask(testContext(), "slow") }()
+	<-started
+
+	if err := s.RunTask(testContext(), "slow"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected an overlapping run to be skipped, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunTaskIsExclusiveAcrossInstances(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+
+	ran := 0
+	task := Task{Name: "purge", Schedule: "@daily", Run: func(ctx context.Context) error {
+		ran++
+		return nil
+	}}
+	first, second := New(nil, lock.NewLocker(client)), New(nil, lock.NewLocker(client))
+	first.Add(task)
+	second.Add(task)
+
+	held, err := lock.NewLocker(client).TryAcquire(testContext(), "scheduler.purge", time.Minute)
+	if err != nil || held == nil {
+		t.Fatalf("got %v, %v", held, err)
+	}
+	if err := first.RunTask(testContext(), "purge"); !errors.Is(err, ErrRunning) || ran != 0 {
+		t.Fatalf("expected the run to be skipped while another instance holds the task, got %v", err)
+	}
+	held.Release(testContext())
+
+	if err := second.RunTask(testContext(), "purge"); err != nil || ran != 1 {
+		t.Errorf("expected the run to proceed once the lock is free, got %v", err)
+	}
+}
+
+func TestAddRejectsDuplicatesAndBadSchedules(t *testing.T) {
+	s := New(nil, nil)
+	noop := func(ctx context.Context) error { return nil }
+	if err := s.Add(Task{Name: "a", Schedule: "@daily", Run: noop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Task{Name: "a", Schedule: "@daily", Run: noop}); err == nil {
+		t.Error("expected a duplicate name to be rejected")
+	}
+	if err := s.Add(Task{Name: "b", Schedule: "every day", Run: noop}); err == nil {
+		t.Error("expected an invalid schedule to be rejected")
+	}
+	if list := s.Tasks(time.Now()); len(list) != 1 || list[0].Name != "a" || list[0].Next.IsZero() {
+		t.Errorf("unexpected task list %+v", list)
+	}
+}
@@ -0,0 +1,156 @@
+// Package seed fills a database with data that is not part of its schema:
+// reference rows every environment needs, fixtures for development and
+// tests, and the first administrator of a new production database.
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Environments a seeder can be tagged with.
+const (
+	EnvDev           = "dev"
+	EnvTest          = "test"
+	EnvProdBootstrap = "prod-bootstrap"
+)
+
+const markerEnv = "-- +seed"
+
+// Seeder adds data in a transaction. Seeders must be idempotent: running one
+// twice leaves the same rows as running it once.
+type Seeder struct {
+	Name string
+	// Envs lists the environments the seeder runs in.
+	Envs []string
+	Run  func(ctx context.Context, tx *sql.Tx) error
+}
+
+// In reports whether the seeder runs in env.
+func (s Seeder) In(env string) bool {
+	return slices.Contains(s.Envs, env)
+}
+
+// EnvFromAppEnv picks the seed environment for an APP_ENV value.
+func EnvFromAppEnv(appEnv string) string {
+	switch appEnv {
+	case "production":
+		return EnvProdBootstrap
+	case "test":
+		return EnvTest
+	default:
+		return EnvDev
+	}
+}
+
+// LoadSQL reads the .sql files at the root of fsys, in file name order, as
+// seeders named after the file. Each file starts with a line listing its
+// environments, such as "-- +seed dev test".
+func LoadSQL(fsys fs.FS) ([]Seeder, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read seeders: %v", err)
+	}
+
+	var seeders []Seeder
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read seeder %s: %v", entry.Name(), err)
+		}
+
+		script := string(content)
+		first, _, _ := strings.Cut(script, "\n")
+		envs, ok := strings.CutPrefix(strings.TrimSpace(first), markerEnv)
+		if !ok || len(strings.Fields(envs)) == 0 {
+			return nil, fmt.Errorf("seeder %s must start with a line such as %q", entry.Name(), markerEnv+" dev test")
+		}
+
+		seeders = append(seeders, Seeder{
+			Name: strings.TrimSuffix(entry.Name(), ".sql"),
+			Envs: strings.Fields(envs),
+			Run: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, script)
+				return err
+			},
+		})
+	}
+	sort.SliceStable(seeders, func(i, j int) bool { return seeders[i].Name < seeders[j].Name })
+	return seeders, nil
+}
+
+// Run runs, in order, the seeders tagged with env, or only those in names.
+// Each seeder commits on its own. report, if set, is called before each one.
+func Run(ctx context.Context, db *sql.DB, seeders []Seeder, env string, names []string, report func(s Seeder)) error {
+	selected, err := selectSeeders(seeders, env, names)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range selected {
+		if report != nil {
+			report(s)
+		}
+		if err := runOne(ctx, db, s); err != nil {
+			return fmt.Errorf("seeder %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func selectSeeders(seeders []Seeder, env string, names []string) ([]Seeder, error) {
+	byName := make(map[string]Seeder, len(seeders))
+	for _, s := range seeders {
+		byName[s.Name] = s
+	}
+
+	var selected []Seeder
+	if len(names) == 0 {
+		for _, s := range seeders {
+			if s.In(env) {
+				selected = append(selected, s)
+			}
+		}
+	}
+	for _, name := range names {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown seeder %s", name)
+		}
+		if !s.In(env) {
+			return nil, fmt.Errorf("seeder %s does not run in %s, only in %s", name, env, strings.Join(s.Envs, ", "))
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+func runOne(ctx context.Context, db *sql.DB, s Seeder) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.Run(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reset drops everything in the public schema, migration history included,
+// so the database can be migrated and seeded from scratch. It is meant for
+// test databases only.
+func Reset(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP SCHEMA public CASCADE; CREATE SCHEMA public;")
+	return err
+}
@@ -0,0 +1,67 @@
+package seed
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadSQLReadsEnvironments(t *testing.T) {
+	seeders, err := LoadSQL(fstest.MapFS{
+		"b_users.sql":  {Data: []byte("-- +seed dev test\nINSERT INTO users VALUES (1);\n")},
+		"a_access.sql": {Data: []byte("-- +seed dev test prod-bootstrap\nINSERT INTO access VALUES (1);\n")},
+		"notes.md":     {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seeders) != 2 || seeders[0].Name != "a_access" || seeders[1].Name != "b_users" {
+		t.Fatalf("unexpected seeders %+v", seeders)
+	}
+	if !seeders[0].In(EnvProdBootstrap) || seeders[1].In(EnvProdBootstrap) || !seeders[1].In(EnvTest) {
+		t.Errorf("unexpected environments %v, %v", seeders[0].Envs, seeders[1].Envs)
+	}
+
+	if _, err := LoadSQL(fstest.MapFS{"untagged.sql": {Data: []byte("INSERT INTO users VALUES (1);")}}); err == nil {
+		t.Error("expected a seeder without environments to be rejected")
+	}
+}
+
+func TestSelectSeeders(t *testing.T) {
+	seeders := []Seeder{
+		{Name: "access", Envs: []string{EnvDev, EnvTest, EnvProdBootstrap}},
+		{Name: "users", Envs: []string{EnvDev, EnvTest}},
+		{Name: "admin", Envs: []string{EnvProdBootstrap}},
+	}
+
+	names := func(list []Seeder) (out []string) {
+		for _, s := range list {
+			out = append(out, s.Name)
+		}
+		return out
+	}
+
+	selected, err := selectSeeders(seeders, EnvProdBootstrap, nil)
+	if err != nil || len(selected) != 2 || selected[0].Name != "access" || selected[1].Name != "admin" {
+		t.Errorf("unexpected prod-bootstrap seeders %v, %v", names(selected), err)
+	}
+
+	selected, err = selectSeeders(seeders, EnvDev, []string{"users"})
+	if err != nil || len(selected) != 1 || selected[0].Name != "users" {
+		t.Errorf("unexpected named seeders %v, %v", names(selected), err)
+	}
+
+	if _, err := selectSeeders(seeders, EnvDev, []string{"admin"}); err == nil {
+		t.Error("expected a seeder outside its environment to be refused")
+	}
+	if _, err := selectSeeders(seeders, EnvDev, []string{"missing"}); err == nil {
+		t.Error("expected an unknown seeder to be refused")
+	}
+}
+
+func TestEnvFromAppEnv(t *testing.T) {
+	for appEnv, want := range map[string]string{"production": EnvProdBootstrap, "test": EnvTest, "development": EnvDev, "": EnvDev} {
+		if got := EnvFromAppEnv(appEnv); got != want {
+			t.Errorf("EnvFromAppEnv(%q) = %s, want %s", appEnv, got, want)
+		}
+	}
+}
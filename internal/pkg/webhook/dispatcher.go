@@ -0,0 +1,286 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Store persists subscriptions and deliveries for the Dispatcher and Fanout.
+type Store interface {
+	// SubscriptionsFor returns the active subscriptions that receive eventType.
+	SubscriptionsFor(ctx context.Context, eventType string) ([]model.WebhookSubscription, error)
+	// Enqueue queues event for every subscription. Enqueueing an event twice
+	// for the same subscription is a no-op.
+	Enqueue(ctx context.Context, event outbox.Event, payload []byte, subscriptionIDs ...int64) error
+	// ClaimDue returns up to limit pending deliveries that are due and hides
+	// them from other dispatchers for lease.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	// RecordAttempt logs attempt and moves the delivery to status. Pending
+	// deliveries are retried at next.
+	RecordAttempt(ctx context.Context, attempt model.WebhookAttempt, status string, next time.Time) error
+}
+
+// Fanout turns outbox events into deliveries. Subscribe Handle to the
+// outbox bus for "*": an event is marked published only once its deliveries
+// are queued, and queuing it again after a relay retry adds none.
+type Fanout struct {
+	Store Store
+}
+
+func (f Fanout) Handle(ctx context.Context, event outbox.Event) error {
+	subscriptions, err := f.Store.SubscriptionsFor(ctx, event.Type)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		ids = append(ids, subscription.ID)
+	}
+	return f.Store.Enqueue(ctx, event, payload, ids...)
+}
+
+var defaultClient = PublicClient(10 * time.Second)
+
+// Dispatcher posts due deliveries to their subscribers.
+type Dispatcher struct {
+	Store Store
+	Log   *logger.Logger
+	// Client posts the deliveries. It defaults to PublicClient, which refuses
+	// receivers on loopback, private and link-local addresses.
+	Client *http.Client
+
+	BatchSize   int
+	Concurrency int
+	Interval    time.Duration
+	// Lease hides a claimed delivery from other dispatchers. It must outlast
+	// the client timeout; a delivery whose dispatcher died is retried after it.
+	Lease       time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	now func() time.Time
+}
+
+// Run dispatches deliveries every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval())
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := d.DispatchOnce(ctx)
+			if err != nil && ctx.Err() == nil && d.Log != nil {
+				d.Log.Error(ctx, fmt.Errorf("webhook dispatcher: %w", err))
+			}
+			if err != nil || n < d.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries and returns how many it claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "webhook.dispatch")
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	deliveries, err := d.Store.ClaimDue(ctx, d.batchSize(), d.lease())
+	if err != nil {
+		return 0, fmt.Errorf("could not claim deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	slots := make(chan struct{}, d.concurrency())
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(delivery model.WebhookDelivery) {
+			defer func() { <-slots; wg.Done() }()
+			if err := d.dispatch(ctx, delivery); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), firstErr
+}
+
+// dispatch sends delivery once and records the outcome.
+func (d *Dispatcher) dispatch(ctx context.Context, delivery model.WebhookDelivery) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "webhook.deliver "+delivery.EventType)
+	defer span.End()
+	ctx = context.WithValue(ctx, myctx.Key("traceID"), span.SpanContext().TraceID().String())
+
+	attempt := model.WebhookAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts + 1}
+	span.SetAttributes(
+		attribute.Int64("webhook.delivery_id", delivery.ID),
+		attribute.Int64("webhook.subscription_id", delivery.SubscriptionID),
+		attribute.Int("webhook.attempt", attempt.Attempt),
+	)
+
+	start := time.Now()
+	statusCode, err := d.send(ctx, delivery)
+	attempt.Duration = time.Since(start)
+	attempt.StatusCode = statusCode
+
+	status, next := model.DeliverySucceeded, time.Time{}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		attempt.Error = strings.ToValidUTF8(err.Error(), "")
+
+		status = model.DeliveryPending
+		if attempt.Attempt >= d.maxAttempts() {
+			status = model.DeliveryDead
+		} else {
+			next = d.clock().Add(Backoff(attempt.Attempt, d.baseBackoff(), d.maxBackoff()))
+		}
+		if d.Log != nil {
+			d.Log.Warn(ctx, fmt.Sprintf("webhook delivery %d failed: %v", delivery.ID, err), "delivery_id", delivery.ID, "url", delivery.URL, "attempt", attempt.Attempt, "status", status)
+		}
+	}
+
+	if err := d.Store.RecordAttempt(ctx, attempt, status, next); err != nil {
+		return fmt.Errorf("could not record attempt of delivery %d: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// send posts the payload with the signature headers. Any status outside 2xx
+// is a failure.
+func (d *Dispatcher) send(ctx context.Context, delivery model.WebhookDelivery) (int, error) {
+	timestamp := d.clock().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, strconv.FormatInt(delivery.EventID, 10))
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns the wait before retrying after the given failed attempt:
+// base doubled per attempt and capped at limit, of which a random half is
+// jitter so receivers recovering from an outage are not hit all at once.
+func Backoff(attempt int, base, limit time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	delay = min(delay, limit)
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+func (d *Dispatcher) clock() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+func (d *Dispatcher) batchSize() int {
+	if d.BatchSize <= 0 {
+		return 50
+	}
+	return d.BatchSize
+}
+
+func (d *Dispatcher) concurrency() int {
+	if d.Concurrency <= 0 {
+		return 8
+	}
+	return d.Concurrency
+}
+
+func (d *Dispatcher) interval() time.Duration {
+	if d.Interval <= 0 {
+		return time.Second
+	}
+	return d.Interval
+}
+
+func (d *Dispatcher) lease() time.Duration {
+	if d.Lease <= 0 {
+		return time.Minute
+	}
+	return d.Lease
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return 10
+	}
+	return d.MaxAttempts
+}
+
+func (d *Dispatcher) baseBackoff() time.Duration {
+	if d.BaseBackoff <= 0 {
+		return 10 * time.Second
+	}
+	return d.BaseBackoff
+}
+
+func (d *Dispatcher) maxBackoff() time.Duration {
+	if d.MaxBackoff <= 0 {
+		return 6 * time.Hour
+	}
+	return d.MaxBackoff
+}
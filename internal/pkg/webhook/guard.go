@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when a receiver resolves to an address
+// that is not on the public internet.
+var ErrNonPublicAddress = errors.New("refusing to post to a non-public address")
+
+// nonPublic lists the shared, benchmarking and protocol ranges that
+// netip.Addr does not classify as private.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// PublicClient posts only to public addresses. The check runs on the address
+// being dialed, after DNS, so a receiver host name resolving to a loopback,
+// private or link-local address such as 169.254.169.254 is refused too, and
+// signed payloads cannot be aimed at internal services. It does not use a
+// proxy, which would dial on its behalf.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: publicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addr) {
+		return fmt.Errorf("%w %s", ErrNonPublicAddress, addr)
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+// Package webhook delivers outbox events to the URLs partners subscribed.
+//
+// Every event is fanned out into one delivery per matching subscription.
+// The Dispatcher posts due deliveries, signs them with the subscription
+// secret, logs every attempt and retries failures with exponential backoff
+// and jitter until they succeed or are moved to the dead-letter list.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign returns the value of the signature header: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with secret. Signing the timestamp with the body
+// lets receivers reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the headers a receiver got against body. Requests whose
+// timestamp is more than tolerance away from now are rejected.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if math.Abs(float64(now.Unix()-ts)) > tolerance.Seconds() {
+		return ErrExpiredTimestamp
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps deliveries in memory and claims every pending one that is due.
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions []model.WebhookSubscription
+	deliveries    []*model.WebhookDelivery
+	attempts      []model.WebhookAttempt
+	now           time.Time
+}
+
+func (s *memoryStore) SubscriptionsFor(ctx context.Context, eventType string) ([]model.WebhookSubscription, error) {
+	var list []model.WebhookSubscription
+	for _, subscription := range s.subscriptions {
+		if subscription.Active && (slices.Contains(subscription.EventTypes, eventType) || slices.Contains(subscription.EventTypes, "*")) {
+			list = append(list, subscription)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryStore) Enqueue(ctx context.Context, event outbox.Event, payload []byte, subscriptionIDs ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range subscriptionIDs {
+		i := slices.IndexFunc(s.subscriptions, func(sub model.WebhookSubscription) bool { return sub.ID == id })
+		s.deliveries = append(s.deliveries, &model.WebhookDelivery{
+			ID:             int64(len(s.deliveries) + 1),
+			SubscriptionID: id,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         model.DeliveryPending,
+			NextAttemptAt:  s.now,
+			URL:            s.subscriptions[i].URL,
+			Secret:         s.subscriptions[i].Secret,
+		})
+	}
+	return nil
+}
+
+func (s *memoryStore) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []model.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == model.DeliveryPending && !delivery.NextAttemptAt.After(s.now) && len(list) < limit {
+			list = append(list, *delivery)
+			delivery.NextAttemptAt = s.now.Add(lease)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryStore) RecordAttempt(ctx context.Context, attempt model.WebhookAttempt, status string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, attempt)
+	delivery := s.deliveries[attempt.DeliveryID-1]
+	delivery.Status = status
+	delivery.Attempts = attempt.Attempt
+	delivery.LastStatusCode = attempt.StatusCode
+	if !next.IsZero() {
+		delivery.NextAttemptAt = next
+	}
+	return nil
+}
+
+// receiver records verified requests and answers with the next queued status.
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	statuses []int
+	events   []outbox.Event
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if err := Verify(rc.secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, 5*time.Minute, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event outbox.Event
+	_ = json.Unmarshal(body, &event)
+	rc.events = append(rc.events, event)
+	rc.headers = append(rc.headers, r.Header.Clone())
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func testContext() context.Context {
+	return context.WithValue(context.Background(), myctx.Key("traceID"), "test")
+}
+
+func setup(t *testing.T, rc *receiver) (*memoryStore, *Dispatcher) {
+	t.Helper()
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	store := &memoryStore{now: time.Now()}
+	store.subscriptions = []model.WebhookSubscription{
+		{ID: 1, URL: server.URL, EventTypes: []string{model.EventUserCreated}, Secret: rc.secret, Active: true},
+		{ID: 2, URL: server.URL, EventTypes: []string{model.EventUserDeleted}, Secret: rc.secret, Active: true},
+	}
+	dispatcher := &Dispatcher{Store: store, Client: server.Client(), MaxAttempts: 3, BaseBackoff: time.Second, MaxBackoff: time.Minute}
+	dispatcher.now = func() time.Time { return store.now }
+
+	event, err := outbox.NewEvent(model.AggregateUser, 7, model.EventUserCreated, model.UserEvent{ID: 7, Name: "John"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.ID = 42
+	if err := (Fanout{Store: store}).Handle(testContext(), event); err != nil {
+		t.Fatal(err)
+	}
+	return store, dispatcher
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Unix(1700000000, 0)
+	signature := Sign("secret", now.Unix(), body)
+
+	if err := Verify("secret", "1700000000", signature, body, time.Minute, now); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := Verify("other", "1700000000", signature, body, time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: got %v", err)
+	}
+	if err := Verify("secret", "1700000000", signature, []byte(`{"id":2}`), time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: got %v", err)
+	}
+	if err := Verify("secret", "1700000000", signature, body, time.Minute, now.Add(2*time.Minute)); !errors.Is(err, ErrExpiredTimestamp) {
+		t.Errorf("replayed request: got %v", err)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	for attempt := 1; attempt <= 12; attempt++ {
+		want := min(time.Second<<(attempt-1), time.Minute)
+		for i := 0; i < 20; i++ {
+			got := Backoff(attempt, time.Second, time.Minute)
+			if got < want/2 || got > want {
+				t.Fatalf("Backoff(%d) = %s want between %s and %s", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestFanoutQueuesMatchingSubscriptions(t *testing.T) {
+	store, _ := setup(t, &receiver{secret: "s3cret"})
+
+	if len(store.deliveries) != 1 || store.deliveries[0].SubscriptionID != 1 {
+		t.Fatalf("expected one delivery for subscription 1, got %+v", store.deliveries)
+	}
+}
+
+func TestDispatcherDeliversSignedEvent(t *testing.T) {
+	rc := &receiver{secret: "s3cret"}
+	store, dispatcher := setup(t, rc)
+
+	if n, err := dispatcher.DispatchOnce(testContext()); err != nil || n != 1 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	if len(rc.events) != 1 || rc.events[0].ID != 42 || rc.events[0].Type != model.EventUserCreated {
+		t.Fatalf("unexpected deliveries %+v", rc.events)
+	}
+	if got := rc.headers[0].Get(HeaderID); got != "42" {
+		t.Errorf("got %s %q want 42", HeaderID, got)
+	}
+	if got := rc.headers[0].Get(HeaderEvent); got != model.EventUserCreated {
+		t.Errorf("got %s %q", HeaderEvent, got)
+	}
+	if store.deliveries[0].Status != model.DeliverySucceeded || len(store.attempts) != 1 || store.attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("expected one successful attempt, got %+v %+v", store.deliveries[0], store.attempts)
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	rc := &receiver{secret: "s3cret", statuses: []int{http.StatusInternalServerError}}
+	store, dispatcher := setup(t, rc)
+	ctx := testContext()
+
+	if _, err := dispatcher.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivery := store.deliveries[0]
+	if delivery.Status != model.DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a pending retry, got %+v", delivery)
+	}
+	wait := delivery.NextAttemptAt.Sub(store.now)
+	if wait < 500*time.Millisecond || wait > time.Second {
+		t.Errorf("expected the first retry within a second, got %s", wait)
+	}
+
+	if n, _ := dispatcher.DispatchOnce(ctx); n != 0 {
+		t.Errorf("expected nothing due before the backoff elapsed, got %d", n)
+	}
+
+	store.now = store.now.Add(time.Second)
+	if _, err := dispatcher.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliverySucceeded || len(store.attempts) != 2 {
+		t.Errorf("expected the retry to succeed, got %+v", delivery)
+	}
+}
+
+func TestDispatcherMovesExhaustedDeliveryToDeadLetter(t *testing.T) {
+	rc := &receiver{secret: "s3cret", statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}}
+	store, dispatcher := setup(t, rc)
+	ctx := testContext()
+
+	for i := 0; i < 3; i++ {
+		store.now = store.now.Add(time.Hour)
+		if _, err := dispatcher.DispatchOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	delivery := store.deliveries[0]
+	if delivery.Status != model.DeliveryDead || delivery.Attempts != 3 || len(store.attempts) != 3 {
+		t.Errorf("expected a dead delivery after 3 attempts, got %+v", delivery)
+	}
+}
+
+func TestDispatcherRefusesNonPublicReceivers(t *testing.T) {
+	rc := &receiver{secret: "s3cret"}
+	store, dispatcher := setup(t, rc)
+	dispatcher.Client = nil
+
+	if _, err := dispatcher.DispatchOnce(testContext()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.events) != 0 {
+		t.Fatalf("expected the loopback receiver not to be called, got %+v", rc.events)
+	}
+	if len(store.attempts) != 1 || !strings.Contains(store.attempts[0].Error, ErrNonPublicAddress.Error()) {
+		t.Errorf("expected the attempt to be refused, got %+v", store.attempts)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":      true,
+		"2606:4700::1111":    true,
+		"127.0.0.1":          false,
+		"::1":                false,
+		"10.1.2.3":           false,
+		"172.16.0.1":         false,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"0.0.0.0":            false,
+		"fd00::1":            false,
+		"fe80::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:192.168.0.1": false,
+	}
+	for ip, want := range cases {
+		if got := isPublic(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("isPublic(%s) = %v want %v", ip, got, want)
+		}
+	}
+}
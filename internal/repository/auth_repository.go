@@ -2,16 +2,31 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
 )
 
-type AuthRepository struct {
-	Db  *sql.DB
+// AuthRepository answers access control questions.
+type AuthRepository interface {
+	// HasAuth reports whether the user in ctx has a role granted path, in
+	// the form "METHOD /path/:id".
+	HasAuth(ctx context.Context, path string) (bool, error)
+	// Paths lists every path of the access table.
+	Paths(ctx context.Context) ([]string, error)
+}
+
+type authRepository struct {
+	Db  *database.Database
 	Log *logger.Logger
 }
 
-func (r *AuthRepository) HasAuth(ctx context.Context, path string) (bool, error) {
+// NewAuthRepository creates the Postgres implementation of AuthRepository.
+func NewAuthRepository(db *database.Database, log *logger.Logger) AuthRepository {
+	return &authRepository{Db: db, Log: log}
+}
+
+func (r *authRepository) HasAuth(ctx context.Context, path string) (bool, error) {
 	var hasAuth bool = false
 
 	switch ctx.Err() {
@@ -29,18 +44,47 @@ func (r *AuthRepository) HasAuth(ctx context.Context, path string) (bool, error)
 		JOIN roles ON roles_users.role_id = roles.id
 		JOIN access_roles ON roles.id = access_roles.role_id
 		JOIN access ON access_roles.access_id = access.id
-		WHERE access.path = $1`
+		WHERE access.path = $1 AND users.id = $2
+		LIMIT 1`
 
-	stmt, err := r.Db.PrepareContext(ctx, q)
+	userID, _ := ctx.Value(myctx.Key("user_id")).(int64)
+	err := r.Db.Reader(ctx).QueryRowContext(ctx, q, path, userID).Scan(&hasAuth)
 	if err != nil {
 		return hasAuth, r.Log.Error(ctx, err)
 	}
-	defer stmt.Close()
 
-	err = stmt.QueryRowContext(ctx, path).Scan(&hasAuth)
+	return hasAuth, nil
+}
+
+func (r *authRepository) Paths(ctx context.Context) ([]string, error) {
+	var paths []string
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return paths, r.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return paths, r.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `SELECT path FROM access ORDER BY path`
+
+	rows, err := r.Db.Reader(ctx).QueryContext(ctx, q)
 	if err != nil {
-		return hasAuth, r.Log.Error(ctx, err)
+		return paths, r.Log.Error(ctx, err)
 	}
+	defer rows.Close()
 
-	return hasAuth, nil
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return paths, r.Log.Error(ctx, err)
+		}
+		paths = append(paths, path)
+	}
+	if rows.Err() != nil {
+		return paths, r.Log.Error(ctx, rows.Err())
+	}
+
+	return paths, nil
 }
@@ -0,0 +1,261 @@
+// Package fake provides in-memory repositories for tests that should not need Postgres.
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/queue"
+	"rest-skeleton/internal/repository"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserRepository keeps users in a map. It mirrors the Postgres implementation:
+// missing users give sql.ErrNoRows and duplicate emails give repository.ErrDuplicate.
+type UserRepository struct {
+	mu       sync.Mutex
+	users    map[int64]model.User
+	roles    map[int64][]int64
+	disabled map[int64]bool
+	nextID   int64
+}
+
+func NewUserRepository(users ...model.User) *UserRepository {
+	r := &UserRepository{users: make(map[int64]model.User), roles: make(map[int64][]int64), disabled: make(map[int64]bool)}
+	for _, user := range users {
+		r.users[user.ID] = user
+		if user.ID > r.nextID {
+			r.nextID = user.ID
+		}
+	}
+	return r
+}
+
+func (r *UserRepository) Find(ctx context.Context, id int64) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Email == email && !r.disabled[user.ID] {
+			return user, nil
+		}
+	}
+	return model.User{}, sql.ErrNoRows
+}
+
+func (r *UserRepository) List(ctx context.Context, search string) ([]model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]model.User, 0, len(r.users))
+	for _, user := range r.users {
+		if strings.Contains(user.Name, search) {
+			list = append(list, model.User{ID: user.ID, Name: user.Name, Email: user.Email})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *UserRepository) Save(ctx context.Context, user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return repository.ErrDuplicate
+		}
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *model.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	existing.Name = user.Name
+	r.users[user.ID] = existing
+	user.Email = existing.Email
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.users, id)
+	return nil
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	user.Password = password
+	r.users[id] = user
+	return nil
+}
+
+func (r *UserRepository) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	r.disabled[id] = disabled
+	return nil
+}
+
+func (r *UserRepository) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, roleID := range roleIDs {
+		if !slices.Contains(r.roles[userID], roleID) {
+			r.roles[userID] = append(r.roles[userID], roleID)
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roles[userID] = slices.DeleteFunc(r.roles[userID], func(roleID int64) bool {
+		return slices.Contains(roleIDs, roleID)
+	})
+	return nil
+}
+
+// PurgeDeleted removes nothing: Delete already drops users from the map.
+func (r *UserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// Roles returns the role ids assigned to the user.
+func (r *UserRepository) Roles(userID int64) []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roles[userID]
+}
+
+// AuthRepository grants access to the listed "METHOD /path" entries.
+type AuthRepository struct {
+	Allowed map[string]bool
+}
+
+func (r *AuthRepository) HasAuth(ctx context.Context, path string) (bool, error) {
+	if !r.Allowed[path] {
+		return false, sql.ErrNoRows
+	}
+	return true, nil
+}
+
+func (r *AuthRepository) Paths(ctx context.Context) ([]string, error) {
+	paths := make([]string, 0, len(r.Allowed))
+	for path, allowed := range r.Allowed {
+		if allowed {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Transactor runs the unit of work without a database and counts how often it was used.
+type Transactor struct {
+	mu    sync.Mutex
+	Calls int
+}
+
+func (t *Transactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.mu.Lock()
+	t.Calls++
+	t.mu.Unlock()
+	return fn(ctx)
+}
+
+// OutboxRepository keeps the recorded events in memory.
+type OutboxRepository struct {
+	mu     sync.Mutex
+	events []outbox.Event
+}
+
+func (r *OutboxRepository) Add(ctx context.Context, events ...outbox.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, event := range events {
+		event.ID = int64(len(r.events) + 1)
+		r.events = append(r.events, event)
+	}
+	return nil
+}
+
+// Events returns the recorded events in insertion order.
+func (r *OutboxRepository) Events() []outbox.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]outbox.Event{}, r.events...)
+}
+
+// Queue records enqueued jobs instead of running them.
+type Queue struct {
+	mu   sync.Mutex
+	jobs []queue.Job
+}
+
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload any, opts ...queue.Option) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := queue.Job{ID: fmt.Sprint(len(q.jobs) + 1), Type: jobType, Payload: data}
+	q.jobs = append(q.jobs, job)
+	return job.ID, nil
+}
+
+// Jobs returns the enqueued jobs in order.
+func (q *Queue) Jobs() []queue.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]queue.Job{}, q.jobs...)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/outbox"
+
+	"go.opentelemetry.io/otel"
+)
+
+// OutboxRepository records domain events. Call Add with the ctx of the
+// transaction that makes the change so both commit or roll back together.
+type OutboxRepository interface {
+	Add(ctx context.Context, events ...outbox.Event) error
+}
+
+type outboxRepository struct {
+	Db  *database.Database
+	Log *logger.Logger
+}
+
+// NewOutboxRepository creates the Postgres implementation of OutboxRepository.
+func NewOutboxRepository(db *database.Database, log *logger.Logger) OutboxRepository {
+	return &outboxRepository{Db: db, Log: log}
+}
+
+func (r *outboxRepository) Add(ctx context.Context, events ...outbox.Event) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "AddOutboxRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return r.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return r.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4)`
+
+	db := r.Db.Executor(ctx)
+	for _, event := range events {
+		if _, err := db.ExecContext(ctx, q, event.AggregateType, event.AggregateID, event.Type, []byte(event.Payload)); err != nil {
+			return r.Log.Error(ctx, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"os"
+
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RoleRepository reads roles. Not found is reported as sql.ErrNoRows.
+type RoleRepository interface {
+	FindByName(ctx context.Context, name string) (model.Role, error)
+}
+
+type roleRepository struct {
+	Db  *database.Database
+	Log *logger.Logger
+}
+
+// NewRoleRepository creates the Postgres implementation of RoleRepository.
+func NewRoleRepository(db *database.Database, log *logger.Logger) RoleRepository {
+	return &roleRepository{Db: db, Log: log}
+}
+
+func (r *roleRepository) FindByName(ctx context.Context, name string) (model.Role, error) {
+	var role model.Role
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "FindByNameRoleRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return role, r.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return role, r.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `SELECT id, name FROM roles WHERE name = $1`
+	span.SetAttributes(attribute.String("db.name", name))
+
+	err := r.Db.Reader(ctx).QueryRowContext(ctx, q, name).Scan(&role.ID, &role.Name)
+	if err != nil {
+		return role, r.Log.Error(ctx, err)
+	}
+	return role, nil
+}
@@ -3,54 +3,79 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/logger"
 	"rest-skeleton/internal/pkg/myctx"
 
+	"github.com/lib/pq"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-type UserRepository struct {
-	Db         *sql.DB
-	Log        *logger.Logger
-	UserEntity model.User
+// ErrDuplicate is returned when a write violates a unique constraint.
+var ErrDuplicate = errors.New("duplicate record")
+
+// UserRepository stores users. Not found is reported as sql.ErrNoRows.
+type UserRepository interface {
+	Find(ctx context.Context, id int64) (model.User, error)
+	GetByEmail(ctx context.Context, email string) (model.User, error)
+	List(ctx context.Context, search string) ([]model.User, error)
+	Save(ctx context.Context, user *model.User) error
+	Update(ctx context.Context, user *model.User) error
+	Delete(ctx context.Context, id int64) error
+	// UpdatePassword stores an already hashed password.
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	// SetDisabled disables or enables a user. Disabled users are not found
+	// by GetByEmail, so they can neither log in nor use their tokens.
+	SetDisabled(ctx context.Context, id int64, disabled bool) error
+	AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error
+	RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error
+	// PurgeDeleted permanently removes users soft-deleted before the given
+	// time and returns how many were removed.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
-func (u *UserRepository) Find(ctx context.Context) error {
+type userRepository struct {
+	Db  *database.Database
+	Log *logger.Logger
+}
+
+// NewUserRepository creates the Postgres implementation of UserRepository.
+func NewUserRepository(db *database.Database, log *logger.Logger) UserRepository {
+	return &userRepository{Db: db, Log: log}
+}
+
+func (u *userRepository) Find(ctx context.Context, id int64) (model.User, error) {
+	var user model.User
 	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "FindUserRepository")
 	defer span.End()
 
 	switch ctx.Err() {
 	case context.Canceled:
-		return u.Log.Error(ctx, context.Canceled)
+		return user, u.Log.Error(ctx, context.Canceled)
 	case context.DeadlineExceeded:
-		return u.Log.Error(ctx, context.DeadlineExceeded)
+		return user, u.Log.Error(ctx, context.DeadlineExceeded)
 	default:
 	}
 
 	const q = `SELECT id, name, email, password FROM users WHERE id=$1 AND deleted_at IS NULL`
-	span.SetAttributes(attribute.String("db.query", q))
-	span.SetAttributes(attribute.Int64("db.id", u.UserEntity.ID))
-
-	stmt, err := u.Db.PrepareContext(ctx, q)
-	if err != nil {
-		return u.Log.Error(ctx, err)
-	}
-	defer stmt.Close()
+	span.SetAttributes(attribute.Int64("db.id", id))
 
-	err = stmt.QueryRowContext(ctx, u.UserEntity.ID).Scan(&u.UserEntity.ID, &u.UserEntity.Name, &u.UserEntity.Email, &u.UserEntity.Password)
+	err := u.Db.Reader(ctx).QueryRowContext(ctx, q, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password)
 	if err != nil {
-		return u.Log.Error(ctx, err)
+		return user, u.Log.Error(ctx, err)
 	}
-	return nil
+	return user, nil
 }
 
-func (u *UserRepository) Save(ctx context.Context) error {
+func (u *userRepository) Save(ctx context.Context, user *model.User) error {
 	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "SaveUserRepository")
 	defer span.End()
 
@@ -63,21 +88,17 @@ func (u *UserRepository) Save(ctx context.Context) error {
 	}
 
 	const q = `INSERT INTO users (name, password, email, created_by) VALUES ($1, $2, $3, $4) RETURNING id`
-	span.SetAttributes(attribute.String("db.query", q))
-
-	stmt, err := u.Db.PrepareContext(ctx, q)
-	if err != nil {
-		return u.Log.Error(ctx, err)
-	}
-	defer stmt.Close()
 
-	err = stmt.QueryRowContext(
-		ctx,
-		u.UserEntity.Name,
-		u.UserEntity.Password,
-		u.UserEntity.Email,
+	err := u.Db.Executor(ctx).QueryRowContext(ctx, q,
+		user.Name,
+		user.Password,
+		user.Email,
 		ctx.Value(myctx.Key("user_id")).(int64),
-	).Scan(&u.UserEntity.ID)
+	).Scan(&user.ID)
+	if err = uniqueViolation(err); errors.Is(err, ErrDuplicate) {
+		// A taken email is answered with a conflict, not an error.
+		return err
+	}
 	if err != nil {
 		return u.Log.Error(ctx, err)
 	}
@@ -85,7 +106,7 @@ func (u *UserRepository) Save(ctx context.Context) error {
 	return nil
 }
 
-func (u *UserRepository) Update(ctx context.Context) error {
+func (u *userRepository) Update(ctx context.Context, user *model.User) error {
 	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "UpdateUserRepository")
 	defer span.End()
 
@@ -97,15 +118,31 @@ func (u *UserRepository) Update(ctx context.Context) error {
 	default:
 	}
 
-	const q = `UPDATE users SET name = $1, updated_at = timezone('utc', now()), updated_by = $2 WHERE id = $3 RETURNING email`
-	span.SetAttributes(attribute.String("db.query", q))
-	stmt, err := u.Db.PrepareContext(ctx, q)
+	const q = `UPDATE users SET name = $1, updated_at = timezone('utc', now()), updated_by = $2 WHERE id = $3 AND deleted_at IS NULL RETURNING email`
+	err := u.Db.Executor(ctx).QueryRowContext(ctx, q, user.Name, ctx.Value(myctx.Key("user_id")).(int64), user.ID).Scan(&user.Email)
 	if err != nil {
 		return u.Log.Error(ctx, err)
 	}
-	defer stmt.Close()
 
-	err = stmt.QueryRowContext(ctx, u.UserEntity.Name, ctx.Value(myctx.Key("user_id")).(int64), u.UserEntity.ID).Scan(&u.UserEntity.Email)
+	return nil
+}
+
+func (u *userRepository) Delete(ctx context.Context, id int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "DeleteUserRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return u.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return u.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `UPDATE users SET deleted_at = timezone('utc', now()), deleted_by = $1 WHERE id = $2 AND deleted_at IS NULL RETURNING id`
+	span.SetAttributes(attribute.Int64("db.id", id))
+
+	err := u.Db.Executor(ctx).QueryRowContext(ctx, q, ctx.Value(myctx.Key("user_id")).(int64), id).Scan(&id)
 	if err != nil {
 		return u.Log.Error(ctx, err)
 	}
@@ -113,8 +150,8 @@ func (u *UserRepository) Update(ctx context.Context) error {
 	return nil
 }
 
-func (u *UserRepository) Delete(ctx context.Context) error {
-	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "DeleteUserRepository")
+func (u *userRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "UpdatePasswordUserRepository")
 	defer span.End()
 
 	switch ctx.Err() {
@@ -125,17 +162,36 @@ func (u *UserRepository) Delete(ctx context.Context) error {
 	default:
 	}
 
-	const q = `UPDATE users SET deleted_at = timezone('utc', now()), deleted_by = $1 WHERE id = $2`
-	span.SetAttributes(attribute.String("db.query", q))
-	span.SetAttributes(attribute.Int64("db.id", u.UserEntity.ID))
+	const q = `UPDATE users SET password = $1, updated_at = timezone('utc', now()), updated_by = $2 WHERE id = $3 AND deleted_at IS NULL RETURNING id`
+	span.SetAttributes(attribute.Int64("db.id", id))
 
-	stmt, err := u.Db.PrepareContext(ctx, q)
+	err := u.Db.Executor(ctx).QueryRowContext(ctx, q, password, ctx.Value(myctx.Key("user_id")).(int64), id).Scan(&id)
 	if err != nil {
 		return u.Log.Error(ctx, err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, ctx.Value(myctx.Key("user_id")).(int64), u.UserEntity.ID)
+	return nil
+}
+
+func (u *userRepository) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "SetDisabledUserRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return u.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return u.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	q := `UPDATE users SET disabled_at = timezone('utc', now()), disabled_by = $1 WHERE id = $2 AND deleted_at IS NULL RETURNING id`
+	if !disabled {
+		q = `UPDATE users SET disabled_at = NULL, disabled_by = NULL, updated_at = timezone('utc', now()), updated_by = $1 WHERE id = $2 AND deleted_at IS NULL RETURNING id`
+	}
+	span.SetAttributes(attribute.Int64("db.id", id))
+
+	err := u.Db.Executor(ctx).QueryRowContext(ctx, q, ctx.Value(myctx.Key("user_id")).(int64), id).Scan(&id)
 	if err != nil {
 		return u.Log.Error(ctx, err)
 	}
@@ -143,7 +199,7 @@ func (u *UserRepository) Delete(ctx context.Context) error {
 	return nil
 }
 
-func (u *UserRepository) List(ctx context.Context, search string) ([]model.User, error) {
+func (u *userRepository) List(ctx context.Context, search string) ([]model.User, error) {
 	var list []model.User = make([]model.User, 0)
 	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "listUserRepository")
 	defer span.End()
@@ -161,17 +217,10 @@ func (u *UserRepository) List(ctx context.Context, search string) ([]model.User,
 	var args []interface{}
 
 	if len(search) > 0 {
-		sb.WriteString(fmt.Sprintf(` AND name like %d`, len(args)+1))
+		sb.WriteString(fmt.Sprintf(` AND name like $%d`, len(args)+1))
 		args = append(args, `%`+search+`%`)
 	}
-	span.SetAttributes(attribute.String("db.query", sb.String()))
-	stmt, err := u.Db.PrepareContext(ctx, sb.String())
-	if err != nil {
-		return list, u.Log.Error(ctx, err)
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.QueryContext(ctx, args...)
+	rows, err := u.Db.Reader(ctx).QueryContext(ctx, sb.String(), args...)
 	if err != nil {
 		return list, u.Log.Error(ctx, err)
 	}
@@ -194,10 +243,38 @@ func (u *UserRepository) List(ctx context.Context, search string) ([]model.User,
 	return list, nil
 }
 
-func (u *UserRepository) GetByEmail(ctx context.Context) error {
+func (u *userRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	var user model.User
 	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "GetByEmailtUserRepository")
 	defer span.End()
 
+	switch ctx.Err() {
+	case context.Canceled:
+		return user, u.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return user, u.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `SELECT id, email, password FROM users WHERE email=$1 AND deleted_at IS NULL AND disabled_at IS NULL`
+	span.SetAttributes(attribute.String("db.email", email))
+
+	err := u.Db.Reader(ctx).QueryRowContext(ctx, q, email).Scan(&user.ID, &user.Email, &user.Password)
+	if errors.Is(err, sql.ErrNoRows) {
+		// An unknown email is a failed login, not an error.
+		return user, err
+	}
+	if err != nil {
+		return user, u.Log.Error(ctx, err)
+	}
+	return user, nil
+}
+
+// AssignRoles links the user to every role. Run it in the same transaction as Save to keep both atomic.
+func (u *userRepository) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "AssignRolesUserRepository")
+	defer span.End()
+
 	switch ctx.Err() {
 	case context.Canceled:
 		return u.Log.Error(ctx, context.Canceled)
@@ -206,19 +283,91 @@ func (u *UserRepository) GetByEmail(ctx context.Context) error {
 	default:
 	}
 
-	const q = `SELECT id, password FROM users WHERE email=$1 AND deleted_at IS NULL`
-	span.SetAttributes(attribute.String("db.query", q))
-	span.SetAttributes(attribute.String("db.email", u.UserEntity.Email))
+	if len(roleIDs) == 0 {
+		return nil
+	}
 
-	stmt, err := u.Db.PrepareContext(ctx, q)
-	if err != nil {
-		return u.Log.Error(ctx, err)
+	const q = `INSERT INTO roles_users (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	span.SetAttributes(attribute.Int64("db.id", userID))
+
+	db := u.Db.Executor(ctx)
+	for _, roleID := range roleIDs {
+		if _, err := db.ExecContext(ctx, q, userID, roleID); err != nil {
+			return u.Log.Error(ctx, err)
+		}
 	}
-	defer stmt.Close()
 
-	err = stmt.QueryRowContext(ctx, u.UserEntity.Email).Scan(&u.UserEntity.ID, &u.UserEntity.Password)
-	if err != nil {
+	return nil
+}
+
+// RevokeRoles unlinks the user from every role.
+func (u *userRepository) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "RevokeRolesUserRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return u.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return u.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	if len(roleIDs) == 0 {
+		return nil
+	}
+
+	const q = `DELETE FROM roles_users WHERE user_id = $1 AND role_id = ANY($2)`
+	span.SetAttributes(attribute.Int64("db.id", userID))
+
+	if _, err := u.Db.Executor(ctx).ExecContext(ctx, q, userID, pq.Array(roleIDs)); err != nil {
 		return u.Log.Error(ctx, err)
 	}
+
 	return nil
 }
+
+func (u *userRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "PurgeDeletedUserRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return 0, u.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return 0, u.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const roles = `DELETE FROM roles_users WHERE user_id IN (SELECT id FROM users WHERE deleted_at < $1)`
+	const users = `DELETE FROM users WHERE deleted_at < $1`
+
+	var purged int64
+	err := u.Db.WithTx(ctx, func(ctx context.Context) error {
+		db := u.Db.Executor(ctx)
+		if _, err := db.ExecContext(ctx, roles, before); err != nil {
+			return err
+		}
+		result, err := db.ExecContext(ctx, users, before)
+		if err != nil {
+			return err
+		}
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, u.Log.Error(ctx, err)
+	}
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", purged))
+	return purged, nil
+}
+
+// uniqueViolation maps a Postgres unique_violation to ErrDuplicate.
+func uniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrDuplicate, pqErr.Constraint)
+	}
+	return err
+}
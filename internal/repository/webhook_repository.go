@@ -0,0 +1,476 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/webhook"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// WebhookRepository stores webhook subscriptions and their deliveries. Not
+// found is reported as sql.ErrNoRows.
+type WebhookRepository interface {
+	webhook.Store
+
+	FindSubscription(ctx context.Context, id int64) (model.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	SaveSubscription(ctx context.Context, subscription *model.WebhookSubscription) error
+	UpdateSubscription(ctx context.Context, subscription *model.WebhookSubscription) error
+	// DeleteSubscription removes the subscription and cancels its pending deliveries.
+	DeleteSubscription(ctx context.Context, id int64) error
+
+	// ListDeliveries filters by subscription and status when they are set.
+	ListDeliveries(ctx context.Context, subscriptionID int64, status string) ([]model.WebhookDelivery, error)
+	FindDelivery(ctx context.Context, id int64) (model.WebhookDelivery, []model.WebhookAttempt, error)
+	// Redeliver makes the delivery pending and due now with a fresh retry
+	// budget, keeping its attempt log. Deliveries of deleted subscriptions
+	// are reported as sql.ErrNoRows.
+	Redeliver(ctx context.Context, id int64) error
+}
+
+type webhookRepository struct {
+	Db  *database.Database
+	Log *logger.Logger
+}
+
+// NewWebhookRepository creates the Postgres implementation of WebhookRepository.
+func NewWebhookRepository(db *database.Database, log *logger.Logger) WebhookRepository {
+	return &webhookRepository{Db: db, Log: log}
+}
+
+const subscriptionColumns = `id, url, event_types, secret, active, created_at`
+
+func scanSubscription(row interface{ Scan(...any) error }) (model.WebhookSubscription, error) {
+	var subscription model.WebhookSubscription
+	err := row.Scan(&subscription.ID, &subscription.URL, pq.Array(&subscription.EventTypes), &subscription.Secret, &subscription.Active, &subscription.CreatedAt)
+	return subscription, err
+}
+
+func (w *webhookRepository) FindSubscription(ctx context.Context, id int64) (model.WebhookSubscription, error) {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "FindSubscriptionWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return model.WebhookSubscription{}, w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return model.WebhookSubscription{}, w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1 AND deleted_at IS NULL`
+	span.SetAttributes(attribute.Int64("db.id", id))
+
+	subscription, err := scanSubscription(w.Db.Reader(ctx).QueryRowContext(ctx, q, id))
+	if err != nil {
+		return subscription, w.Log.Error(ctx, err)
+	}
+	return subscription, nil
+}
+
+func (w *webhookRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	const q = `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE deleted_at IS NULL ORDER BY created_at, id`
+	return w.subscriptions(ctx, "ListSubscriptionsWebhookRepository", q)
+}
+
+func (w *webhookRepository) SubscriptionsFor(ctx context.Context, eventType string) ([]model.WebhookSubscription, error) {
+	const q = `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions
+		WHERE deleted_at IS NULL AND active AND ($1 = ANY(event_types) OR '*' = ANY(event_types))
+		ORDER BY id`
+	return w.subscriptions(ctx, "SubscriptionsForWebhookRepository", q, eventType)
+}
+
+func (w *webhookRepository) subscriptions(ctx context.Context, spanName, q string, args ...any) ([]model.WebhookSubscription, error) {
+	var list = make([]model.WebhookSubscription, 0)
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, spanName)
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return list, w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return list, w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	rows, err := w.Db.Reader(ctx).QueryContext(ctx, q, args...)
+	if err != nil {
+		return list, w.Log.Error(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return list, w.Log.Error(ctx, err)
+		}
+		list = append(list, subscription)
+	}
+	if rows.Err() != nil {
+		return list, w.Log.Error(ctx, rows.Err())
+	}
+	return list, nil
+}
+
+func (w *webhookRepository) SaveSubscription(ctx context.Context, subscription *model.WebhookSubscription) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "SaveSubscriptionWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `INSERT INTO webhook_subscriptions (url, event_types, secret, active, created_by) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err := w.Db.Executor(ctx).QueryRowContext(ctx, q,
+		subscription.URL,
+		pq.Array(subscription.EventTypes),
+		subscription.Secret,
+		subscription.Active,
+		ctx.Value(myctx.Key("user_id")).(int64),
+	).Scan(&subscription.ID, &subscription.CreatedAt)
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	return nil
+}
+
+func (w *webhookRepository) UpdateSubscription(ctx context.Context, subscription *model.WebhookSubscription) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "UpdateSubscriptionWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `UPDATE webhook_subscriptions
+		SET url = $1, event_types = $2, secret = $3, active = $4, updated_at = timezone('utc', now()), updated_by = $5
+		WHERE id = $6 AND deleted_at IS NULL
+		RETURNING created_at`
+	span.SetAttributes(attribute.Int64("db.id", subscription.ID))
+
+	err := w.Db.Executor(ctx).QueryRowContext(ctx, q,
+		subscription.URL,
+		pq.Array(subscription.EventTypes),
+		subscription.Secret,
+		subscription.Active,
+		ctx.Value(myctx.Key("user_id")).(int64),
+		subscription.ID,
+	).Scan(&subscription.CreatedAt)
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	return nil
+}
+
+func (w *webhookRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "DeleteSubscriptionWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	span.SetAttributes(attribute.Int64("db.id", id))
+	err := w.Db.WithTx(ctx, func(ctx context.Context) error {
+		const q = `UPDATE webhook_subscriptions SET deleted_at = timezone('utc', now()), deleted_by = $1 WHERE id = $2 AND deleted_at IS NULL`
+		result, err := w.Db.Executor(ctx).ExecContext(ctx, q, ctx.Value(myctx.Key("user_id")).(int64), id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		const cancel = `UPDATE webhook_deliveries SET status = $1 WHERE subscription_id = $2 AND status = $3`
+		_, err = w.Db.Executor(ctx).ExecContext(ctx, cancel, model.DeliveryCancelled, id, model.DeliveryPending)
+		return err
+	})
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	return nil
+}
+
+func (w *webhookRepository) Enqueue(ctx context.Context, event outbox.Event, payload []byte, subscriptionIDs ...int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "EnqueueWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT unnest($1::int8[]), $2, $3, $4
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	span.SetAttributes(attribute.Int64("outbox.event_id", event.ID))
+
+	// A savepoint keeps a failed insert from aborting the caller's transaction.
+	err := w.Db.WithTx(ctx, func(ctx context.Context) error {
+		_, err := w.Db.Executor(ctx).ExecContext(ctx, q, pq.Array(subscriptionIDs), event.ID, event.Type, payload)
+		return err
+	})
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	return nil
+}
+
+// claimDeliveriesQuery pushes next_attempt_at past the lease so the claimed
+// rows stay invisible to other dispatchers while they are being posted,
+// without holding a transaction open across the HTTP calls.
+const claimDeliveriesQuery = `
+	UPDATE webhook_deliveries d
+	SET next_attempt_at = timezone('utc', now()) + $2 * interval '1 millisecond'
+	FROM webhook_subscriptions s
+	WHERE s.id = d.subscription_id
+		AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= timezone('utc', now())
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+	RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret`
+
+func (w *webhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	var list []model.WebhookDelivery
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "ClaimDueWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return list, w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return list, w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	rows, err := w.Db.Executor(ctx).QueryContext(ctx, claimDeliveriesQuery, limit, lease.Milliseconds())
+	if err != nil {
+		return list, w.Log.Error(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload, &delivery.Attempts, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return list, w.Log.Error(ctx, err)
+		}
+		delivery.Status = model.DeliveryPending
+		list = append(list, delivery)
+	}
+	if rows.Err() != nil {
+		return list, w.Log.Error(ctx, rows.Err())
+	}
+	return list, nil
+}
+
+func (w *webhookRepository) RecordAttempt(ctx context.Context, attempt model.WebhookAttempt, status string, next time.Time) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "RecordAttemptWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	span.SetAttributes(attribute.Int64("db.id", attempt.DeliveryID))
+	err := w.Db.WithTx(ctx, func(ctx context.Context) error {
+		const log = `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms) VALUES ($1, $2, $3, $4, $5)`
+		_, err := w.Db.Executor(ctx).ExecContext(ctx, log, attempt.DeliveryID, attempt.Attempt, nullInt(attempt.StatusCode), nullString(attempt.Error), attempt.Duration.Milliseconds())
+		if err != nil {
+			return err
+		}
+
+		const update = `UPDATE webhook_deliveries SET
+			status = $1,
+			attempts = $2,
+			last_status_code = $3,
+			last_error = $4,
+			next_attempt_at = COALESCE($5, next_attempt_at),
+			delivered_at = CASE WHEN $1 = 'succeeded' THEN timezone('utc', now()) END
+			WHERE id = $6`
+		var nextAttempt *time.Time
+		if !next.IsZero() {
+			nextAttempt = &next
+		}
+		_, err = w.Db.Executor(ctx).ExecContext(ctx, update, status, attempt.Attempt, nullInt(attempt.StatusCode), nullString(attempt.Error), nextAttempt, attempt.DeliveryID)
+		return err
+	})
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	return nil
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := row.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError,
+		&delivery.CreatedAt, &delivery.DeliveredAt)
+	return delivery, err
+}
+
+func (w *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID int64, status string) ([]model.WebhookDelivery, error) {
+	var list = make([]model.WebhookDelivery, 0)
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "ListDeliveriesWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return list, w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return list, w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(`SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE true`)
+	var args []interface{}
+	if subscriptionID != 0 {
+		args = append(args, subscriptionID)
+		sb.WriteString(fmt.Sprintf(` AND subscription_id = $%d`, len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		sb.WriteString(fmt.Sprintf(` AND status = $%d`, len(args)))
+	}
+	sb.WriteString(` ORDER BY id DESC LIMIT 500`)
+
+	rows, err := w.Db.Reader(ctx).QueryContext(ctx, sb.String(), args...)
+	if err != nil {
+		return list, w.Log.Error(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return list, w.Log.Error(ctx, err)
+		}
+		list = append(list, delivery)
+	}
+	if rows.Err() != nil {
+		return list, w.Log.Error(ctx, rows.Err())
+	}
+	return list, nil
+}
+
+func (w *webhookRepository) FindDelivery(ctx context.Context, id int64) (model.WebhookDelivery, []model.WebhookAttempt, error) {
+	var attempts = make([]model.WebhookAttempt, 0)
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "FindDeliveryWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return model.WebhookDelivery{}, attempts, w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return model.WebhookDelivery{}, attempts, w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	span.SetAttributes(attribute.Int64("db.id", id))
+	db := w.Db.Reader(ctx)
+
+	const q = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+	delivery, err := scanDelivery(db.QueryRowContext(ctx, q, id))
+	if err != nil {
+		return delivery, attempts, w.Log.Error(ctx, err)
+	}
+
+	const log = `SELECT delivery_id, attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, created_at
+		FROM webhook_delivery_attempts WHERE delivery_id = $1 ORDER BY id`
+	rows, err := db.QueryContext(ctx, log, id)
+	if err != nil {
+		return delivery, attempts, w.Log.Error(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt model.WebhookAttempt
+		var durationMs int64
+		if err := rows.Scan(&attempt.DeliveryID, &attempt.Attempt, &attempt.StatusCode, &attempt.Error, &durationMs, &attempt.CreatedAt); err != nil {
+			return delivery, attempts, w.Log.Error(ctx, err)
+		}
+		attempt.Duration = time.Duration(durationMs) * time.Millisecond
+		attempts = append(attempts, attempt)
+	}
+	if rows.Err() != nil {
+		return delivery, attempts, w.Log.Error(ctx, rows.Err())
+	}
+	return delivery, attempts, nil
+}
+
+func (w *webhookRepository) Redeliver(ctx context.Context, id int64) error {
+	ctx, span := otel.Tracer(os.Getenv("APP_NAME")).Start(ctx, "RedeliverWebhookRepository")
+	defer span.End()
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return w.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return w.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	const q = `UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = timezone('utc', now()), delivered_at = NULL
+		WHERE id = $1 AND subscription_id IN (SELECT id FROM webhook_subscriptions WHERE deleted_at IS NULL)`
+	span.SetAttributes(attribute.Int64("db.id", id))
+
+	result, err := w.Db.Executor(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return w.Log.Error(ctx, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return w.Log.Error(ctx, err)
+	} else if n == 0 {
+		return w.Log.Error(ctx, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func nullInt(v int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(v), Valid: v != 0}
+}
+
+func nullString(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
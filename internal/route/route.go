@@ -1,15 +1,21 @@
 package route
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	_ "rest-skeleton/docs"
 	"rest-skeleton/internal/handler"
 	"rest-skeleton/internal/middleware"
+	"rest-skeleton/internal/pkg/cache"
 	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/lock"
 	"rest-skeleton/internal/pkg/logger"
-	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/queue"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -17,7 +23,7 @@ import (
 	"go.opentelemetry.io/otel/metric"
 )
 
-func ApiRoute(log *logger.Logger, db *database.Database, cache *redis.Cache, latencyMetric metric.Int64Histogram) *httprouter.Router {
+func ApiRoute(log *logger.Logger, db *database.Database, cache cache.Cache, elector *lock.Elector, jobs queue.Enqueuer, latencyMetric metric.Int64Histogram, accessLog *middleware.AccessLog) *httprouter.Router {
 	router := httprouter.New()
 	router.ServeFiles("/docs/*filepath", http.Dir("./docs"))
 
@@ -27,9 +33,13 @@ func ApiRoute(log *logger.Logger, db *database.Database, cache *redis.Cache, lat
 	router.Handler("GET", "/swagger/*filepath", swaggerHandler)
 	router.Handler("GET", "/metrics", promhttp.Handler())
 
-	var mid middleware.Middleware = middleware.Middleware{Log: log, DB: db.Conn, Cache: cache, LatencyMetric: latencyMetric}
+	healthHandler := handler.Health{Log: log, DB: db.Conn, Elector: elector}
+	router.GET("/health", healthHandler.Check)
+
+	var mid middleware.Middleware = middleware.Middleware{Log: log, DB: db, Cache: cache, LatencyMetric: latencyMetric, Access: accessLog}
 	publicMiddlewares := []func(httprouter.Handle) httprouter.Handle{
 		mid.TraceAndMetricLatency,
+		mid.AccessLog,
 		mid.CORS,
 		mid.PanicRecovery,
 		mid.Semaphore,
@@ -38,15 +48,74 @@ func ApiRoute(log *logger.Logger, db *database.Database, cache *redis.Cache, lat
 	}
 	privateMiddlewares := append(publicMiddlewares, mid.Authentication, mid.Authorization)
 
-	userHandler := handler.Users{Log: log, DB: db.Conn, Cache: cache}
-	authHandler := handler.Auths{Log: log, DB: db.Conn}
+	userUC := usecase.UserUC{
+		Log:    log,
+		Repo:   repository.NewUserRepository(db, log),
+		Outbox: repository.NewOutboxRepository(db, log),
+		Tx:     db,
+		Cache:  cache,
+		Jobs:   jobs,
+	}
+	userHandler := handler.Users{Log: log, Usecase: userUC}
+	authHandler := handler.Auths{Log: log, DB: db}
+	webhookUC := usecase.WebhookUC{Log: log, Repo: repository.NewWebhookRepository(db, log)}
+	webhookHandler := handler.Webhooks{Log: log, Usecase: webhookUC}
 
-	router.POST("/login", mid.WrapMiddleware(publicMiddlewares, authHandler.Login))
-	router.GET("/users", mid.WrapMiddleware(privateMiddlewares, userHandler.List))
-	router.GET("/users/:id", mid.WrapMiddleware(privateMiddlewares, userHandler.GetById))
-	router.POST("/users", mid.WrapMiddleware(privateMiddlewares, userHandler.Create))
-	router.PUT("/users/:id", mid.WrapMiddleware(privateMiddlewares, userHandler.Update))
-	router.DELETE("/users/:id", mid.WrapMiddleware(privateMiddlewares, userHandler.Delete))
+	for _, route := range routes(&userHandler, &authHandler, &webhookHandler) {
+		middlewares := publicMiddlewares
+		if route.Private {
+			middlewares = privateMiddlewares
+		}
+		router.Handle(route.Method, route.Path, withRoute(route.AccessPath(), mid.WrapMiddleware(middlewares, route.Handle)))
+	}
 
 	return router
 }
+
+// withRoute puts the route pattern in the request context, where the logger
+// finds it.
+func withRoute(pattern string, next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		next(w, r.WithContext(context.WithValue(r.Context(), myctx.Key("route"), pattern)), ps)
+	}
+}
+
+// Route is an API endpoint.
+type Route struct {
+	Method string
+	Path   string
+	// Private routes need a token and an access row for AccessPath.
+	Private bool
+	Handle  httprouter.Handle
+}
+
+// AccessPath is the path of the access row that guards the route.
+func (r Route) AccessPath() string {
+	return r.Method + " " + r.Path
+}
+
+// Routes lists the API endpoints served by ApiRoute. The documentation,
+// metrics and health endpoints are left out.
+func Routes() []Route {
+	return routes(&handler.Users{}, &handler.Auths{}, &handler.Webhooks{})
+}
+
+func routes(users *handler.Users, auths *handler.Auths, webhooks *handler.Webhooks) []Route {
+	return []Route{
+		{Method: http.MethodPost, Path: "/login", Handle: auths.Login},
+		{Method: http.MethodGet, Path: "/users", Private: true, Handle: users.List},
+		{Method: http.MethodGet, Path: "/users/:id", Private: true, Handle: users.GetById},
+		{Method: http.MethodPost, Path: "/users", Private: true, Handle: users.Create},
+		{Method: http.MethodPut, Path: "/users/:id", Private: true, Handle: users.Update},
+		{Method: http.MethodDelete, Path: "/users/:id", Private: true, Handle: users.Delete},
+
+		{Method: http.MethodGet, Path: "/webhooks", Private: true, Handle: webhooks.List},
+		{Method: http.MethodGet, Path: "/webhooks/:id", Private: true, Handle: webhooks.GetById},
+		{Method: http.MethodPost, Path: "/webhooks", Private: true, Handle: webhooks.Create},
+		{Method: http.MethodPut, Path: "/webhooks/:id", Private: true, Handle: webhooks.Update},
+		{Method: http.MethodDelete, Path: "/webhooks/:id", Private: true, Handle: webhooks.Delete},
+		{Method: http.MethodGet, Path: "/webhook-deliveries", Private: true, Handle: webhooks.Deliveries},
+		{Method: http.MethodGet, Path: "/webhook-deliveries/:id", Private: true, Handle: webhooks.Delivery},
+		{Method: http.MethodPost, Path: "/webhook-deliveries/:id/redeliver", Private: true, Handle: webhooks.Redeliver},
+	}
+}
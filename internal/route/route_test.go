@@ -0,0 +1,26 @@
+package route
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPrivateRoutesHaveAccessRows(t *testing.T) {
+	access, err := os.ReadFile("../../seed/access.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, route := range Routes() {
+		if seen[route.AccessPath()] {
+			t.Errorf("%s is registered twice", route.AccessPath())
+		}
+		seen[route.AccessPath()] = true
+
+		if route.Private && !strings.Contains(string(access), "'"+route.AccessPath()+"'") {
+			t.Errorf("%s has no row in seed/access.sql", route.AccessPath())
+		}
+	}
+}
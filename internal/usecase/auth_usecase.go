@@ -2,10 +2,8 @@ package usecase
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"rest-skeleton/internal/dto"
-	"rest-skeleton/internal/model"
 	"rest-skeleton/internal/pkg/jwttoken"
 	"rest-skeleton/internal/pkg/logger"
 	"rest-skeleton/internal/repository"
@@ -15,8 +13,8 @@ import (
 )
 
 type AuthUC struct {
-	Log *logger.Logger
-	DB  *sql.DB
+	Log  *logger.Logger
+	Repo repository.UserRepository
 }
 
 func (uc AuthUC) Login(ctx context.Context, loginRequest dto.LoginRequest) (string, int, error) {
@@ -28,16 +26,16 @@ func (uc AuthUC) Login(ctx context.Context, loginRequest dto.LoginRequest) (stri
 	default:
 	}
 
-	userRepo := repository.UserRepository{Log: uc.Log, Db: uc.DB, UserEntity: model.User{Email: loginRequest.Email}}
-	if err := userRepo.GetByEmail(ctx); err != nil {
+	user, err := uc.Repo.GetByEmail(ctx, loginRequest.Email)
+	if err != nil {
 		return "", http.StatusInternalServerError, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(strings.TrimSpace(userRepo.UserEntity.Password)), []byte(loginRequest.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(strings.TrimSpace(user.Password)), []byte(loginRequest.Password)); err != nil {
 		return "", http.StatusUnauthorized, uc.Log.Error(ctx, err)
 	}
 
-	token, err := jwttoken.ClaimToken(userRepo.UserEntity.Email)
+	token, err := jwttoken.ClaimToken(user.Email)
 	if err != nil {
 		return "", http.StatusInternalServerError, uc.Log.Error(ctx, err)
 	}
@@ -0,0 +1,363 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/job"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/queue"
+	"rest-skeleton/internal/repository"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserUsecase holds the business rules for managing users. Every method
+// returns the HTTP status code the handler should answer with.
+type UserUsecase interface {
+	List(ctx context.Context, search string) ([]dto.UserResponse, int, error)
+	Get(ctx context.Context, id int64) (dto.UserResponse, int, error)
+	Create(ctx context.Context, request dto.UserCreateRequest) (dto.UserResponse, int, error)
+	Update(ctx context.Context, request dto.UserUpdateRequest) (dto.UserResponse, int, error)
+	Delete(ctx context.Context, id int64) (int, error)
+	ResetPassword(ctx context.Context, request dto.PasswordResetRequest) (int, error)
+	SetDisabled(ctx context.Context, id int64, disabled bool) (int, error)
+	AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) (int, error)
+	RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) (int, error)
+}
+
+// ErrEmailTaken is returned by Create when another user has the email.
+var ErrEmailTaken = errors.New("email is already registered")
+
+type UserUC struct {
+	Log    *logger.Logger
+	Repo   repository.UserRepository
+	Outbox repository.OutboxRepository
+	Tx     database.Transactor
+	Cache  cache.Cache
+	// Jobs queues follow-up work. Nil when no queue is configured.
+	Jobs queue.Enqueuer
+}
+
+func (uc UserUC) List(ctx context.Context, search string) ([]dto.UserResponse, int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	key := "users.list." + search
+	opts := cache.FetchOptions{Stale: time.Minute, Tags: []string{cache.UsersListTag}, Log: uc.Log}
+	response, err := cache.Fetch(ctx, uc.Cache, key, opts, func(ctx context.Context) ([]dto.UserResponse, error) {
+		users, err := uc.Repo.List(ctx, search)
+		if err != nil {
+			return nil, err
+		}
+
+		tags := make([]string, 0, len(users))
+		for _, user := range users {
+			tags = append(tags, cache.UserTag(user.ID))
+		}
+		uc.Cache.Tag(ctx, key, tags...)
+
+		var usersResponse dto.UserResponse
+		return usersResponse.ListFromEntity(users), nil
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func (uc UserUC) Get(ctx context.Context, id int64) (dto.UserResponse, int, error) {
+	var response dto.UserResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	key := fmt.Sprintf("users.%d", id)
+	opts := cache.FetchOptions{Stale: time.Minute, Tags: []string{cache.UserTag(id)}, Log: uc.Log}
+	response, err := cache.Fetch(ctx, uc.Cache, key, opts, func(ctx context.Context) (dto.UserResponse, error) {
+		var response dto.UserResponse
+		user, err := uc.Repo.Find(ctx, id)
+		if err != nil {
+			return response, err
+		}
+
+		response.FromEntity(user)
+		return response, nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return response, http.StatusNotFound, err
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+
+	return response, http.StatusOK, nil
+}
+
+func (uc UserUC) Create(ctx context.Context, request dto.UserCreateRequest) (dto.UserResponse, int, error) {
+	var response dto.UserResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	user := request.ToEntity()
+	password, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, err)
+	}
+	user.Password = string(password)
+
+	err = uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.Save(ctx, &user); err != nil {
+			return err
+		}
+		if err := uc.Repo.AssignRoles(ctx, user.ID, request.RoleIDs...); err != nil {
+			return err
+		}
+
+		if err := uc.record(ctx, model.EventUserCreated, user.ID, model.UserEvent{ID: user.ID, Name: user.Name, Email: user.Email}); err != nil {
+			return err
+		}
+		if len(request.RoleIDs) == 0 {
+			return nil
+		}
+		return uc.record(ctx, model.EventRoleAssigned, user.ID, model.RoleAssignedEvent{UserID: user.ID, RoleIDs: request.RoleIDs})
+	})
+	if errors.Is(err, repository.ErrDuplicate) {
+		return response, http.StatusConflict, ErrEmailTaken
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UsersListTag)
+	uc.audit(ctx, "created", user.ID)
+	uc.enqueue(ctx, job.WelcomeUser, model.UserEvent{ID: user.ID, Name: user.Name, Email: user.Email}, queue.Unique(fmt.Sprintf("welcome.%d", user.ID), 0))
+
+	response.FromEntity(user)
+	return response, http.StatusCreated, nil
+}
+
+func (uc UserUC) Update(ctx context.Context, request dto.UserUpdateRequest) (dto.UserResponse, int, error) {
+	var response dto.UserResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	user := request.ToEntity()
+	err := uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.Update(ctx, &user); err != nil {
+			return err
+		}
+		return uc.record(ctx, model.EventUserUpdated, user.ID, model.UserEvent{ID: user.ID, Name: user.Name, Email: user.Email})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return response, http.StatusNotFound, err
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(user.ID), cache.UsersListTag)
+	uc.audit(ctx, "updated", user.ID)
+
+	response.FromEntity(user)
+	return response, http.StatusOK, nil
+}
+
+func (uc UserUC) Delete(ctx context.Context, id int64) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	err := uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		return uc.record(ctx, model.EventUserDeleted, id, model.UserEvent{ID: id})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(id))
+	uc.audit(ctx, "deleted", id)
+
+	return http.StatusNoContent, nil
+}
+
+// ResetPassword replaces the password of a user.
+func (uc UserUC) ResetPassword(ctx context.Context, request dto.PasswordResetRequest) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	password, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return http.StatusInternalServerError, uc.Log.Error(ctx, err)
+	}
+
+	err = uc.Repo.UpdatePassword(ctx, request.ID, string(password))
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(request.ID))
+	uc.audit(ctx, "password reset", request.ID)
+
+	return http.StatusNoContent, nil
+}
+
+// SetDisabled disables a user, who can then no longer log in or use a token
+// issued before, or enables the user again.
+func (uc UserUC) SetDisabled(ctx context.Context, id int64, disabled bool) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	eventType, action := model.EventUserDisabled, "disabled"
+	if !disabled {
+		eventType, action = model.EventUserEnabled, "enabled"
+	}
+	err := uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.SetDisabled(ctx, id, disabled); err != nil {
+			return err
+		}
+		return uc.record(ctx, eventType, id, model.UserEvent{ID: id})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(id), cache.UsersListTag)
+	uc.audit(ctx, action, id)
+
+	return http.StatusNoContent, nil
+}
+
+// AssignRoles grants roles to a user. Cached permissions of the user are
+// evicted so the change applies to the next request.
+func (uc UserUC) AssignRoles(ctx context.Context, userID int64, roleIDs ...int64) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	err := uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.AssignRoles(ctx, userID, roleIDs...); err != nil {
+			return err
+		}
+		return uc.record(ctx, model.EventRoleAssigned, userID, model.RoleAssignedEvent{UserID: userID, RoleIDs: roleIDs})
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(userID))
+	uc.audit(ctx, "roles granted", userID, "role_ids", roleIDs)
+
+	return http.StatusNoContent, nil
+}
+
+// RevokeRoles takes roles away from a user.
+func (uc UserUC) RevokeRoles(ctx context.Context, userID int64, roleIDs ...int64) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	err := uc.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := uc.Repo.RevokeRoles(ctx, userID, roleIDs...); err != nil {
+			return err
+		}
+		return uc.record(ctx, model.EventRoleRevoked, userID, model.RoleRevokedEvent{UserID: userID, RoleIDs: roleIDs})
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uc.Cache.InvalidateTags(ctx, cache.UserTag(userID))
+	uc.audit(ctx, "roles revoked", userID, "role_ids", roleIDs)
+
+	return http.StatusNoContent, nil
+}
+
+// record adds a user event to the outbox in the transaction carried by ctx.
+func (uc UserUC) record(ctx context.Context, eventType string, userID int64, payload any) error {
+	event, err := outbox.NewEvent(model.AggregateUser, userID, eventType, payload)
+	if err != nil {
+		return err
+	}
+	return uc.Outbox.Add(ctx, event)
+}
+
+// enqueue queues follow-up work after the change is committed. A failure is
+// logged but does not fail the request.
+func (uc UserUC) enqueue(ctx context.Context, task queue.Task[model.UserEvent], payload model.UserEvent, opts ...queue.Option) {
+	if uc.Jobs == nil {
+		return
+	}
+	if _, err := task.Enqueue(ctx, uc.Jobs, payload, opts...); err != nil && !errors.Is(err, queue.ErrDuplicate) {
+		uc.Log.Error(ctx, err)
+	}
+}
+
+// audit records who changed which user.
+func (uc UserUC) audit(ctx context.Context, action string, userID int64, args ...any) {
+	actor, _ := ctx.Value(myctx.Key("user_id")).(int64)
+	uc.Log.Info(ctx, "audit", append([]any{"actor_id", actor, "action", action, "target_user_id", userID}, args...)...)
+}
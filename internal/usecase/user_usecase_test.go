@@ -0,0 +1,293 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/job"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/cache"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/repository/fake"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newUserUC(t *testing.T, users ...model.User) (UserUC, *fake.UserRepository, *fake.Transactor) {
+	uc, repo, tx, _ := newUserUCWithOutbox(t, users...)
+	return uc, repo, tx
+}
+
+func newUserUCWithOutbox(t *testing.T, users ...model.User) (UserUC, *fake.UserRepository, *fake.Transactor, *fake.OutboxRepository) {
+	t.Helper()
+	log := logger.New()
+	log.ErrorCountMetric, _ = noop.NewMeterProvider().Meter("test").Int64Counter("errors")
+
+	repo := fake.NewUserRepository(users...)
+	tx := &fake.Transactor{}
+	events := &fake.OutboxRepository{}
+	return UserUC{Log: log, Repo: repo, Outbox: events, Tx: tx, Cache: cache.NewMemory(100, time.Minute)}, repo, tx, events
+}
+
+func testContext() context.Context {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "test")
+	return context.WithValue(ctx, myctx.Key("user_id"), int64(1))
+}
+
+func TestCreateUserHashesPasswordInTransaction(t *testing.T) {
+	uc, repo, tx := newUserUC(t)
+	ctx := testContext()
+
+	response, statusCode, err := uc.Create(ctx, dto.UserCreateRequest{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Password: "Password123!",
+		RoleIDs:  []int64{7},
+	})
+	if err != nil || statusCode != http.StatusCreated {
+		t.Fatalf("got %d, %v", statusCode, err)
+	}
+
+	user, err := repo.Find(ctx, response.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Password123!")) != nil {
+		t.Error("expected stored password to be a bcrypt hash of the input")
+	}
+	if roles := repo.Roles(response.ID); len(roles) != 1 || roles[0] != 7 {
+		t.Errorf("expected role 7 to be assigned, got %v", roles)
+	}
+	if tx.Calls != 1 {
+		t.Errorf("expected one transaction, got %d", tx.Calls)
+	}
+}
+
+func TestCreateUserDuplicateEmailConflicts(t *testing.T) {
+	uc, _, _ := newUserUC(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+
+	_, statusCode, err := uc.Create(testContext(), dto.UserCreateRequest{
+		Name:     "Other John",
+		Email:    "john.doe@example.com",
+		Password: "Password123!",
+	})
+	if statusCode != http.StatusConflict || !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("got %d, %v want 409, ErrEmailTaken", statusCode, err)
+	}
+}
+
+func TestUpdateUserInvalidatesCache(t *testing.T) {
+	uc, _, _ := newUserUC(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	if user, _, _ := uc.Get(ctx, 1); user.Name != "John" {
+		t.Fatalf("got %q want John", user.Name)
+	}
+	if list, _, _ := uc.List(ctx, ""); len(list) != 1 || list[0].Name != "John" {
+		t.Fatalf("unexpected list %v", list)
+	}
+
+	if _, statusCode, err := uc.Update(ctx, dto.UserUpdateRequest{ID: 1, Name: "Johnny"}); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("got %d, %v", statusCode, err)
+	}
+
+	if user, _, _ := uc.Get(ctx, 1); user.Name != "Johnny" {
+		t.Errorf("expected cached user to be evicted, got %q", user.Name)
+	}
+	if list, _, _ := uc.List(ctx, ""); list[0].Name != "Johnny" {
+		t.Errorf("expected cached list to be evicted, got %q", list[0].Name)
+	}
+}
+
+func TestRenameEvictsSearchPages(t *testing.T) {
+	uc, _, _ := newUserUC(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	// The page is empty, so it is not tagged with the user.
+	if list, _, _ := uc.List(ctx, "Johnny"); len(list) != 0 {
+		t.Fatalf("unexpected list %v", list)
+	}
+	if _, _, err := uc.Update(ctx, dto.UserUpdateRequest{ID: 1, Name: "Johnny"}); err != nil {
+		t.Fatal(err)
+	}
+	if list, _, _ := uc.List(ctx, "Johnny"); len(list) != 1 {
+		t.Errorf("expected the renamed user in the search page, got %v", list)
+	}
+}
+
+func TestGetMissingUserIsNotFound(t *testing.T) {
+	uc, _, _ := newUserUC(t)
+
+	if _, statusCode, _ := uc.Get(testContext(), 42); statusCode != http.StatusNotFound {
+		t.Errorf("got %d want 404", statusCode)
+	}
+}
+
+func TestUserChangesRecordEvents(t *testing.T) {
+	uc, _, _, events := newUserUCWithOutbox(t)
+	ctx := testContext()
+
+	created, _, err := uc.Create(ctx, dto.UserCreateRequest{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Password: "Password123!",
+		RoleIDs:  []int64{7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := uc.Update(ctx, dto.UserUpdateRequest{ID: created.ID, Name: "Johnny"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.Delete(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{model.EventUserCreated, model.EventRoleAssigned, model.EventUserUpdated, model.EventUserDeleted}
+	got := events.Events()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events want %d", len(got), len(want))
+	}
+	for i, event := range got {
+		if event.Type != want[i] || event.AggregateType != model.AggregateUser || event.AggregateID != created.ID {
+			t.Errorf("event %d = %s %s/%d want %s user/%d", i, event.Type, event.AggregateType, event.AggregateID, want[i], created.ID)
+		}
+	}
+
+	var payload model.RoleAssignedEvent
+	if err := json.Unmarshal(got[1].Payload, &payload); err != nil || len(payload.RoleIDs) != 1 || payload.RoleIDs[0] != 7 {
+		t.Errorf("unexpected RoleAssigned payload %s", got[1].Payload)
+	}
+}
+
+func TestDeleteMissingUserRecordsNoEvent(t *testing.T) {
+	uc, _, _, events := newUserUCWithOutbox(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	if statusCode, err := uc.Delete(ctx, 1); err != nil || statusCode != http.StatusNoContent {
+		t.Fatalf("got %d, %v", statusCode, err)
+	}
+	if statusCode, err := uc.Delete(ctx, 1); statusCode != http.StatusNotFound || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting twice: got %d, %v want 404", statusCode, err)
+	}
+	if statusCode, _ := uc.Delete(ctx, 42); statusCode != http.StatusNotFound {
+		t.Errorf("deleting a missing user: got %d want 404", statusCode)
+	}
+	if got := events.Events(); len(got) != 1 || got[0].Type != model.EventUserDeleted {
+		t.Errorf("expected a single UserDeleted event, got %v", got)
+	}
+}
+
+func TestUpdateDeletedUserIsNotFound(t *testing.T) {
+	uc, _, _, events := newUserUCWithOutbox(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	if _, err := uc.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, statusCode, err := uc.Update(ctx, dto.UserUpdateRequest{ID: 1, Name: "Johnny"}); statusCode != http.StatusNotFound || !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %d, %v want 404", statusCode, err)
+	}
+	if got := events.Events(); len(got) != 1 {
+		t.Errorf("expected no UserUpdated event, got %v", got)
+	}
+}
+
+func TestCreateUserQueuesWelcomeJob(t *testing.T) {
+	uc, _, _ := newUserUC(t)
+	jobs := &fake.Queue{}
+	uc.Jobs = jobs
+
+	created, _, err := uc.Create(testContext(), dto.UserCreateRequest{
+		Name:     "John Doe",
+		Email:    "john.doe@example.com",
+		Password: "Password123!",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := jobs.Jobs()
+	if len(got) != 1 || got[0].Type != job.WelcomeUser.Type {
+		t.Fatalf("expected one %s job, got %+v", job.WelcomeUser.Type, got)
+	}
+	var payload model.UserEvent
+	if err := json.Unmarshal(got[0].Payload, &payload); err != nil || payload.ID != created.ID {
+		t.Errorf("unexpected payload %s", got[0].Payload)
+	}
+}
+
+func TestResetPasswordStoresHash(t *testing.T) {
+	uc, repo, _ := newUserUC(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	if statusCode, err := uc.ResetPassword(ctx, dto.PasswordResetRequest{ID: 1, Password: "Password123!"}); err != nil || statusCode != http.StatusNoContent {
+		t.Fatalf("got %d, %v", statusCode, err)
+	}
+	user, _ := repo.Find(ctx, 1)
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Password123!")) != nil {
+		t.Error("expected the new password to be stored as a bcrypt hash")
+	}
+
+	if statusCode, _ := uc.ResetPassword(ctx, dto.PasswordResetRequest{ID: 42, Password: "Password123!"}); statusCode != http.StatusNotFound {
+		t.Errorf("got %d want 404 for a missing user", statusCode)
+	}
+}
+
+func TestDisabledUserCannotBeFoundByEmail(t *testing.T) {
+	uc, repo, _, events := newUserUCWithOutbox(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	if statusCode, err := uc.SetDisabled(ctx, 1, true); err != nil || statusCode != http.StatusNoContent {
+		t.Fatalf("got %d, %v", statusCode, err)
+	}
+	if _, err := repo.GetByEmail(ctx, "john.doe@example.com"); err == nil {
+		t.Error("expected a disabled user to be hidden from login")
+	}
+
+	if _, err := uc.SetDisabled(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetByEmail(ctx, "john.doe@example.com"); err != nil {
+		t.Errorf("expected an enabled user to be found, got %v", err)
+	}
+
+	got := events.Events()
+	if len(got) != 2 || got[0].Type != model.EventUserDisabled || got[1].Type != model.EventUserEnabled {
+		t.Errorf("unexpected events %+v", got)
+	}
+}
+
+func TestRoleChangesEvictCachedPermissions(t *testing.T) {
+	uc, repo, _, events := newUserUCWithOutbox(t, model.User{ID: 1, Name: "John", Email: "john.doe@example.com"})
+	ctx := testContext()
+
+	key := "permissions.1.GET /users"
+	uc.Cache.Set(ctx, key, []byte("true"), 0)
+	uc.Cache.Tag(ctx, key, cache.UserTag(1))
+
+	if _, err := uc.AssignRoles(ctx, 1, 7, 8); err != nil {
+		t.Fatal(err)
+	}
+	if uc.Cache.Exists(ctx, key) {
+		t.Error("expected cached permissions to be evicted")
+	}
+	if _, err := uc.RevokeRoles(ctx, 1, 7); err != nil {
+		t.Fatal(err)
+	}
+	if roles := repo.Roles(1); len(roles) != 1 || roles[0] != 8 {
+		t.Errorf("expected only role 8 to be left, got %v", roles)
+	}
+
+	got := events.Events()
+	if len(got) != 2 || got[0].Type != model.EventRoleAssigned || got[1].Type != model.EventRoleRevoked {
+		t.Errorf("unexpected events %+v", got)
+	}
+}
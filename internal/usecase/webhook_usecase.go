@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/repository"
+)
+
+// WebhookUsecase manages webhook subscriptions and their deliveries. Every
+// method returns the HTTP status code the handler should answer with.
+type WebhookUsecase interface {
+	List(ctx context.Context) ([]dto.WebhookResponse, int, error)
+	Get(ctx context.Context, id int64) (dto.WebhookResponse, int, error)
+	Create(ctx context.Context, request dto.WebhookRequest) (dto.WebhookResponse, int, error)
+	Update(ctx context.Context, request dto.WebhookRequest) (dto.WebhookResponse, int, error)
+	Delete(ctx context.Context, id int64) (int, error)
+
+	Deliveries(ctx context.Context, subscriptionID int64, status string) ([]dto.WebhookDeliveryResponse, int, error)
+	Delivery(ctx context.Context, id int64) (dto.WebhookDeliveryResponse, int, error)
+	Redeliver(ctx context.Context, id int64) (int, error)
+}
+
+type WebhookUC struct {
+	Log  *logger.Logger
+	Repo repository.WebhookRepository
+}
+
+func (uc WebhookUC) List(ctx context.Context) ([]dto.WebhookResponse, int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	subscriptions, err := uc.Repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var response dto.WebhookResponse
+	return response.ListFromEntity(subscriptions), http.StatusOK, nil
+}
+
+func (uc WebhookUC) Get(ctx context.Context, id int64) (dto.WebhookResponse, int, error) {
+	var response dto.WebhookResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	subscription, err := uc.Repo.FindSubscription(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response, http.StatusNotFound, err
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+
+	response.FromEntity(subscription)
+	return response, http.StatusOK, nil
+}
+
+// Create stores the subscription. Without a secret in the request one is
+// generated; it is returned once, in the response.
+func (uc WebhookUC) Create(ctx context.Context, request dto.WebhookRequest) (dto.WebhookResponse, int, error) {
+	var response dto.WebhookResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	subscription := request.ToEntity()
+	if subscription.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return response, http.StatusInternalServerError, uc.Log.Error(ctx, err)
+		}
+		subscription.Secret = secret
+	}
+
+	if err := uc.Repo.SaveSubscription(ctx, &subscription); err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+	uc.audit(ctx, "created", subscription.ID)
+
+	response.FromEntity(subscription)
+	response.Secret = subscription.Secret
+	return response, http.StatusCreated, nil
+}
+
+// Update replaces the subscription. An empty secret keeps the current one,
+// and so does a missing active.
+func (uc WebhookUC) Update(ctx context.Context, request dto.WebhookRequest) (dto.WebhookResponse, int, error) {
+	var response dto.WebhookResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	subscription := request.ToEntity()
+	if subscription.Secret == "" || request.Active == nil {
+		existing, err := uc.Repo.FindSubscription(ctx, request.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return response, http.StatusNotFound, err
+		}
+		if err != nil {
+			return response, http.StatusInternalServerError, err
+		}
+		if subscription.Secret == "" {
+			subscription.Secret = existing.Secret
+		}
+		if request.Active == nil {
+			subscription.Active = existing.Active
+		}
+	}
+
+	err := uc.Repo.UpdateSubscription(ctx, &subscription)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response, http.StatusNotFound, err
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+	uc.audit(ctx, "updated", subscription.ID)
+
+	response.FromEntity(subscription)
+	return response, http.StatusOK, nil
+}
+
+func (uc WebhookUC) Delete(ctx context.Context, id int64) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	err := uc.Repo.DeleteSubscription(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	uc.audit(ctx, "deleted", id)
+
+	return http.StatusNoContent, nil
+}
+
+// Deliveries lists deliveries, newest first. Filter on status "dead" for the dead-letter list.
+func (uc WebhookUC) Deliveries(ctx context.Context, subscriptionID int64, status string) ([]dto.WebhookDeliveryResponse, int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return nil, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	switch status {
+	case "", model.DeliveryPending, model.DeliverySucceeded, model.DeliveryDead, model.DeliveryCancelled:
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("unknown delivery status %q", status)
+	}
+
+	deliveries, err := uc.Repo.ListDeliveries(ctx, subscriptionID, status)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var response dto.WebhookDeliveryResponse
+	return response.ListFromEntity(deliveries), http.StatusOK, nil
+}
+
+// Delivery returns the delivery with its attempt log.
+func (uc WebhookUC) Delivery(ctx context.Context, id int64) (dto.WebhookDeliveryResponse, int, error) {
+	var response dto.WebhookDeliveryResponse
+	switch ctx.Err() {
+	case context.Canceled:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return response, http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	delivery, attempts, err := uc.Repo.FindDelivery(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return response, http.StatusNotFound, err
+	}
+	if err != nil {
+		return response, http.StatusInternalServerError, err
+	}
+
+	response.FromEntity(delivery, attempts...)
+	return response, http.StatusOK, nil
+}
+
+// Redeliver queues the delivery for an immediate attempt, typically to
+// replay a dead one once the receiver is fixed.
+func (uc WebhookUC) Redeliver(ctx context.Context, id int64) (int, error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.Canceled)
+	case context.DeadlineExceeded:
+		return http.StatusInternalServerError, uc.Log.Error(ctx, context.DeadlineExceeded)
+	default:
+	}
+
+	err := uc.Repo.Redeliver(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	actor, _ := ctx.Value(myctx.Key("user_id")).(int64)
+	uc.Log.Info(ctx, "audit", "actor_id", actor, "action", "redelivered", "delivery_id", id)
+	return http.StatusAccepted, nil
+}
+
+// audit records who changed which subscription.
+func (uc WebhookUC) audit(ctx context.Context, action string, id int64) {
+	actor, _ := ctx.Value(myctx.Key("user_id")).(int64)
+	uc.Log.Info(ctx, "audit", "actor_id", actor, "action", action, "webhook_id", id)
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
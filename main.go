@@ -1,22 +1,38 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"rest-skeleton/internal/job"
+	"rest-skeleton/internal/maintenance"
+	"rest-skeleton/internal/middleware"
+	"rest-skeleton/internal/pkg/cache"
 	"rest-skeleton/internal/pkg/config"
 	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/lock"
 	"rest-skeleton/internal/pkg/logger"
+	"rest-skeleton/internal/pkg/mailer"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/queue"
 	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/pkg/scheduler"
 	"rest-skeleton/internal/pkg/telemetry"
+	"rest-skeleton/internal/pkg/webhook"
+	"rest-skeleton/internal/repository"
 	"rest-skeleton/internal/route"
 
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // @title Rest Skeleton API
@@ -44,9 +60,7 @@ func main() {
 
 	// go telemetry.CollectMachineResourceMetrics(meter) // dihapus karena redundant dengan matric go secara umum
 
-	today := time.Now().Format("2006-01-02")
-	logFileName := "log/api-" + today + ".log"
-	log := logger.New(logFileName)
+	log := logger.New()
 
 	fmt.Println("Starting Server at : "+os.Getenv("APP_PORT"), "")
 
@@ -63,26 +77,140 @@ func main() {
 		os.Exit(1)
 	}
 	log.ErrorCountMetric = errorCountMetric
+	if err := log.RegisterMetrics(meter); err != nil {
+		fmt.Printf("failed to initialize log metrics: %v", err)
+		os.Exit(1)
+	}
 
-	db, err := database.NewDatabase()
+	db, err := database.NewDatabase(log)
 	if err != nil {
 		fmt.Printf("Could not connect to database: %v", err)
 		os.Exit(1)
 	}
-	defer db.Conn.Close()
+	defer db.Close()
+
+	if err := db.RegisterMetrics(meter); err != nil {
+		fmt.Printf("failed to initialize database metrics: %v", err)
+		os.Exit(1)
+	}
+
+	cacheClient, err := cache.New(context.Background())
+	if err != nil {
+		fmt.Printf("Could not connect to cache: %v", err)
+		os.Exit(1)
+	}
+	defer cacheClient.Close()
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	runBackground := func(job func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			job(backgroundCtx)
+		}()
+	}
+
+	runBackground(func(ctx context.Context) { db.MonitorReplicas(ctx, 5*time.Second) })
+	// Servers drop their prepared statements when a migration runs elsewhere.
+	runBackground(func(ctx context.Context) { db.WatchSchema(ctx, 10*time.Second) })
+
+	// The outbox relay runs on every instance: claiming with SKIP LOCKED keeps
+	// relays from delivering the same event concurrently.
+	bus := outbox.NewBus()
+	sinks, err := outbox.SinksFromEnv(log, bus)
+	if err != nil {
+		fmt.Printf("Invalid outbox configuration: %v", err)
+		os.Exit(1)
+	}
+	relay := &outbox.Relay{DB: db, Log: log, Sinks: sinks}
+	runBackground(relay.Run)
+
+	// Webhook deliveries are queued by the relay and posted by the dispatcher,
+	// which also runs on every instance.
+	webhooks := repository.NewWebhookRepository(db, log)
+	bus.Subscribe("*", webhook.Fanout{Store: webhooks}.Handle)
+	maxAttempts, err := strconv.Atoi(cmp.Or(os.Getenv("WEBHOOK_MAX_ATTEMPTS"), "10"))
+	if err != nil {
+		fmt.Printf("Invalid WEBHOOK_MAX_ATTEMPTS: %v", err)
+		os.Exit(1)
+	}
+	dispatcher := &webhook.Dispatcher{Store: webhooks, Log: log, MaxAttempts: maxAttempts}
+	// Receivers on loopback or private addresses are refused unless allowed,
+	// for local development.
+	if allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE")); allow {
+		dispatcher.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	runBackground(dispatcher.Run)
+
+	mailCfg, err := mailer.ConfigFromEnv()
+	if err != nil {
+		fmt.Printf("Invalid mail configuration: %v", err)
+		os.Exit(1)
+	}
+	mail, err := mailer.New(mailCfg, log)
+	if err != nil {
+		fmt.Printf("Invalid mail configuration: %v", err)
+		os.Exit(1)
+	}
+
+	maintenanceCfg, err := maintenance.ConfigFromEnv()
+	if err != nil {
+		fmt.Printf("Invalid maintenance configuration: %v", err)
+		os.Exit(1)
+	}
+	maintenanceCfg.DB, maintenanceCfg.Log, maintenanceCfg.Cache = db, log, cacheClient
+
+	// Scheduled tasks run on the leader only. Without Redis there is no
+	// election and no job queue, and this instance schedules every task itself.
+	var elector *lock.Elector
+	var jobs queue.Enqueuer
+	if lockRedis, err := newLockRedis(backgroundCtx); err != nil {
+		fmt.Printf("Leader election and job queue disabled: %v\n", err)
+		shared, local := mustSchedulers(maintenanceCfg, nil, meter)
+		runBackground(shared.Run)
+		runBackground(local.Run)
+	} else {
+		defer lockRedis.Close()
+		locker := lock.NewLocker(lockRedis.Client())
+		shared, local := mustSchedulers(maintenanceCfg, locker, meter)
+		elector = lock.NewElector(locker, os.Getenv("APP_NAME")+".leader", 15*time.Second)
+		runBackground(func(ctx context.Context) { elector.Run(ctx, shared.Run) })
+		runBackground(local.Run)
+
+		// Workers run on every instance. Jobs still running at shutdown are
+		// finished before the process exits.
+		jobQueue := queue.New(lockRedis.Client(), cmp.Or(os.Getenv("JOBS_QUEUE"), "default"))
+		worker := queue.NewWorker(jobQueue, log)
+		if worker.Concurrency, err = strconv.Atoi(cmp.Or(os.Getenv("JOBS_CONCURRENCY"), "4")); err != nil {
+			fmt.Printf("Invalid JOBS_CONCURRENCY: %v", err)
+			os.Exit(1)
+		}
+		job.Register(worker, mail, job.MailTemplates(mailCfg.Locale))
+		mailer.Register(worker, mail)
+		runBackground(worker.Run)
+		jobs = jobQueue
+	}
 
-	redisClient, err := redis.NewCache(context.Background(), os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PASSWORD"), 24*time.Hour)
+	accessLogCfg, err := middleware.AccessLogConfigFromEnv()
 	if err != nil {
-		fmt.Printf("Could not connect to redis: %v", err)
+		fmt.Printf("Invalid access log configuration: %v", err)
+		os.Exit(1)
+	}
+	accessLog, err := middleware.NewAccessLog(accessLogCfg, log)
+	if err != nil {
+		fmt.Printf("Could not open access log: %v", err)
+		os.Exit(1)
 	}
-	defer redisClient.Close()
+	defer accessLog.Close()
+	runBackground(func(ctx context.Context) { logger.ReopenOnSignal(ctx, log.Reopen, accessLog.Reopen) })
 
 	srv := &http.Server{
 		Addr:         ":" + os.Getenv("APP_PORT"),
 		WriteTimeout: time.Second * 5,
 		ReadTimeout:  time.Second * 5,
 		IdleTimeout:  time.Second * 30,
-		Handler:      route.ApiRoute(log, db, redisClient, latencyMetric),
+		Handler:      route.ApiRoute(log, db, cacheClient, elector, jobs, latencyMetric, accessLog),
 	}
 
 	go func() {
@@ -102,5 +230,37 @@ func main() {
 		fmt.Println("Server shutdown", err)
 	}
 
+	stopBackground()
+	background.Wait()
+
+	// Entries logged while shutting down are pushed, and rotated files
+	// compressed, before exiting.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := log.Close(flushCtx); err != nil {
+		fmt.Println("Log flush", err)
+	}
+
 	fmt.Println("Server exiting")
 }
+
+func newLockRedis(ctx context.Context) (*redis.Cache, error) {
+	cfg, err := redis.ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewCache(ctx, cfg)
+}
+
+// mustSchedulers builds the maintenance schedulers or exits.
+func mustSchedulers(cfg maintenance.Config, locker *lock.Locker, meter metric.Meter) (shared, local *scheduler.Scheduler) {
+	shared, local, err := maintenance.Schedulers(cfg, locker)
+	if err == nil {
+		err = errors.Join(shared.RegisterMetrics(meter), local.RegisterMetrics(meter))
+	}
+	if err != nil {
+		fmt.Printf("Invalid scheduled tasks: %v", err)
+		os.Exit(1)
+	}
+	return shared, local
+}
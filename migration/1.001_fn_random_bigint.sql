@@ -10,3 +10,6 @@ BEGIN
 END;
 $function$
 ;
+
+-- +migrate Down
+DROP FUNCTION IF EXISTS public.random_bigint();
@@ -18,3 +18,6 @@ BEGIN
 END;
 $function$
 ;
+
+-- +migrate Down
+DROP FUNCTION IF EXISTS public.int64_id(text, text);
@@ -5,4 +5,6 @@ CREATE TABLE public."access" (
 	CONSTRAINT newtable_pk PRIMARY KEY (id),
 	CONSTRAINT newtable_unique UNIQUE (name),
 	CONSTRAINT newtable_unique_1 UNIQUE (path)
-);
\ No newline at end of file
+);
+-- +migrate Down
+DROP TABLE IF EXISTS public."access";
@@ -3,4 +3,6 @@ CREATE TABLE public.roles (
 	"name" varchar(45) NOT NULL,
 	CONSTRAINT roles_pk PRIMARY KEY (id),
 	CONSTRAINT roles_unique UNIQUE (name)
-);
\ No newline at end of file
+);
+-- +migrate Down
+DROP TABLE IF EXISTS public.roles;
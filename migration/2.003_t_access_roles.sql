@@ -2,4 +2,6 @@ CREATE TABLE public.access_roles (
 	access_id int8 NOT NULL,
 	role_id int8 NOT NULL,
 	CONSTRAINT access_roles_pk PRIMARY KEY (access_id, role_id)
-);
\ No newline at end of file
+);
+-- +migrate Down
+DROP TABLE IF EXISTS public.access_roles;
@@ -11,4 +11,6 @@ CREATE TABLE users (
 	deleted_by int8 NULL,
 	CONSTRAINT users_email_key UNIQUE (email),
 	CONSTRAINT users_pkey PRIMARY KEY (id)
-);
\ No newline at end of file
+);
+-- +migrate Down
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,18 @@
+CREATE TABLE public.outbox (
+	id bigserial NOT NULL,
+	aggregate_type varchar(64) NOT NULL,
+	aggregate_id int8 NOT NULL,
+	event_type varchar(64) NOT NULL,
+	payload jsonb NOT NULL,
+	created_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	attempts int4 DEFAULT 0 NOT NULL,
+	last_error text NULL,
+	next_attempt_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	published_at timestamptz NULL,
+	CONSTRAINT outbox_pk PRIMARY KEY (id)
+);
+
+CREATE INDEX outbox_pending_idx ON public.outbox (aggregate_type, aggregate_id, id) WHERE published_at IS NULL;
+
+-- +migrate Down
+DROP TABLE IF EXISTS public.outbox;
@@ -0,0 +1,53 @@
+CREATE TABLE public.webhook_subscriptions (
+	id int8 DEFAULT int64_id('webhook_subscriptions'::text, 'id'::text) NOT NULL,
+	url varchar(2048) NOT NULL,
+	event_types text[] NOT NULL,
+	secret varchar(128) NOT NULL,
+	active bool DEFAULT true NOT NULL,
+	created_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	created_by int8 NOT NULL,
+	updated_at timestamptz NULL,
+	updated_by int8 NULL,
+	deleted_at timestamptz NULL,
+	deleted_by int8 NULL,
+	CONSTRAINT webhook_subscriptions_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE public.webhook_deliveries (
+	id bigserial NOT NULL,
+	subscription_id int8 NOT NULL,
+	event_id int8 NOT NULL,
+	event_type varchar(64) NOT NULL,
+	payload jsonb NOT NULL,
+	status varchar(16) DEFAULT 'pending' NOT NULL,
+	attempts int4 DEFAULT 0 NOT NULL,
+	next_attempt_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	last_status_code int4 NULL,
+	last_error text NULL,
+	created_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	delivered_at timestamptz NULL,
+	CONSTRAINT webhook_deliveries_pk PRIMARY KEY (id),
+	CONSTRAINT webhook_deliveries_event_key UNIQUE (subscription_id, event_id),
+	CONSTRAINT webhook_deliveries_subscription_fk FOREIGN KEY (subscription_id) REFERENCES public.webhook_subscriptions(id)
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE public.webhook_delivery_attempts (
+	id bigserial NOT NULL,
+	delivery_id int8 NOT NULL,
+	attempt int4 NOT NULL,
+	status_code int4 NULL,
+	error text NULL,
+	duration_ms int4 NOT NULL,
+	created_at timestamptz DEFAULT timezone('utc'::text, now()) NOT NULL,
+	CONSTRAINT webhook_delivery_attempts_pk PRIMARY KEY (id),
+	CONSTRAINT webhook_delivery_attempts_delivery_fk FOREIGN KEY (delivery_id) REFERENCES public.webhook_deliveries(id)
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_idx ON public.webhook_delivery_attempts (delivery_id, id);
+
+-- +migrate Down
+DROP TABLE IF EXISTS public.webhook_delivery_attempts;
+DROP TABLE IF EXISTS public.webhook_deliveries;
+DROP TABLE IF EXISTS public.webhook_subscriptions;
@@ -0,0 +1,7 @@
+ALTER TABLE users
+	ADD COLUMN disabled_at timestamptz NULL,
+	ADD COLUMN disabled_by int8 NULL;
+-- +migrate Down
+ALTER TABLE users
+	DROP COLUMN IF EXISTS disabled_by,
+	DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,10 @@
+// Package migration embeds the SQL migrations of the application, so every
+// binary can migrate without the source tree.
+package migration
+
+import "embed"
+
+// FS holds the migration files.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,25 @@
+-- +seed dev test prod-bootstrap
+-- Roles and the access rows checked by the authorization middleware. Every
+-- endpoint behind it needs a row here, in the form 'METHOD /path/:id'.
+INSERT INTO public.roles ("name") VALUES ('Superman') ON CONFLICT ("name") DO NOTHING;
+
+INSERT INTO public."access" ("name","path") VALUES
+	 ('list user','GET /users'),
+	 ('create user','POST /users'),
+	 ('view user','GET /users/:id'),
+	 ('update user','PUT /users/:id'),
+	 ('delete user','DELETE /users/:id'),
+	 ('list webhook','GET /webhooks'),
+	 ('create webhook','POST /webhooks'),
+	 ('view webhook','GET /webhooks/:id'),
+	 ('update webhook','PUT /webhooks/:id'),
+	 ('delete webhook','DELETE /webhooks/:id'),
+	 ('list webhook delivery','GET /webhook-deliveries'),
+	 ('view webhook delivery','GET /webhook-deliveries/:id'),
+	 ('redeliver webhook delivery','POST /webhook-deliveries/:id/redeliver')
+ON CONFLICT ("path") DO NOTHING;
+
+-- Superman holds every access.
+INSERT INTO public.access_roles (access_id,role_id)
+SELECT a.id, r.id FROM public."access" a CROSS JOIN public.roles r WHERE r."name" = 'Superman'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,72 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"rest-skeleton/internal/pkg/seed"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Admin creates the first administrator of a production database from
+// ADMIN_NAME, ADMIN_EMAIL and ADMIN_PASSWORD and gives it the Superman role.
+// An existing account with that email keeps its password.
+var Admin = seed.Seeder{
+	Name: "admin",
+	Envs: []string{seed.EnvProdBootstrap},
+	Run:  bootstrapAdmin,
+}
+
+func bootstrapAdmin(ctx context.Context, tx *sql.Tx) error {
+	name := strings.TrimSpace(os.Getenv("ADMIN_NAME"))
+	email := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
+	password := os.Getenv("ADMIN_PASSWORD")
+	if name == "" {
+		name = "Administrator"
+	}
+	if email == "" || password == "" {
+		return fmt.Errorf("ADMIN_EMAIL and ADMIN_PASSWORD are required")
+	}
+	if len(password) < 8 {
+		return fmt.Errorf("ADMIN_PASSWORD must be at least 8 characters")
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1 AND deleted_at IS NULL", email).Scan(&id)
+	if err == sql.ErrNoRows {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		// The first account has nobody to be created by but itself.
+		if err := tx.QueryRowContext(ctx, "SELECT int64_id('users', 'id')").Scan(&id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO users (id, "name", email, "password", created_by) VALUES ($1, $2, $3, $4, $1)`, id, name, email, string(hash)); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO roles_users (user_id, role_id)
+		SELECT $1, id FROM roles WHERE "name" = 'Superman'
+		ON CONFLICT DO NOTHING`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE "name" = 'Superman')`).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("the Superman role is missing; run the access seeder first")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+-- +seed dev test
+-- A Superman account for development and the API tests, which log in as it
+-- with the password qwertyuiop!1Q. Its id is fixed so tests can refer to it.
+INSERT INTO public.users (id,"name",email,"password",created_by) VALUES
+	 (425071490427828,'Rijal Asepnugroho','rijal.asep.nugroho@gmail.com','$2a$10$eCZXQBWquZJrlKglS8trh.5l2UnM8.m0Sah4T0iHE5QBgeJov2kBO',425071490427828)
+ON CONFLICT (email) DO NOTHING;
+
+INSERT INTO public.roles_users (user_id,role_id)
+SELECT u.id, r.id FROM public.users u CROSS JOIN public.roles r
+WHERE u.email = 'rijal.asep.nugroho@gmail.com' AND r."name" = 'Superman'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,20 @@
+// Package seed holds the seeders of the application: the SQL files in this
+// directory, embedded into the binary, followed by the seeders written in Go.
+package seed
+
+import (
+	"embed"
+	"rest-skeleton/internal/pkg/seed"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Seeders lists every seeder in the order they run.
+func Seeders() ([]seed.Seeder, error) {
+	seeders, err := seed.LoadSQL(files)
+	if err != nil {
+		return nil, err
+	}
+	return append(seeders, Admin), nil
+}
@@ -8,6 +8,8 @@ import (
 	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/migration"
 	"rest-skeleton/internal/pkg/redis"
+	"rest-skeleton/internal/pkg/seed"
+	appseed "rest-skeleton/seed"
 	"sync"
 	"time"
 
@@ -23,7 +25,7 @@ var (
 	redisInstance *redis.Cache
 )
 
-func NewUnit() (*sql.DB, *redis.Cache, func()) {
+func NewUnit() (*database.Database, *redis.Cache, func()) {
 	// Start container and initialize the database only once
 	once.Do(func() {
 		var wg sync.WaitGroup
@@ -46,6 +48,17 @@ func NewUnit() (*sql.DB, *redis.Cache, func()) {
 			} else {
 				fmt.Println("Migrated database successfully")
 			}
+
+			seeders, err := appseed.Seeders()
+			if err == nil {
+				err = seed.Run(context.Background(), dbInstance, seeders, seed.EnvTest, nil, nil)
+			}
+			if err != nil {
+				dbInstance.Close()
+				dbTeardown()
+				fmt.Println("seeding", err)
+				os.Exit(1)
+			}
 		}()
 
 		wg.Wait()
@@ -58,7 +71,7 @@ func NewUnit() (*sql.DB, *redis.Cache, func()) {
 		}
 	})
 
-	return dbInstance, redisInstance, unitTeardown
+	return &database.Database{Conn: dbInstance}, redisInstance, unitTeardown
 }
 
 func NewPosgrest() (*sql.DB, func()) {
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/handler"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// loginAs logs in through /login and returns the token.
+func loginAs(t *testing.T, email, password string) string {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"email": email, "password": password})
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", uuid.NewString())
+
+	authHandler := handler.Auths{DB: db, Log: log}
+	router := httprouter.New()
+	router.POST("/login", mid.WrapMiddleware(publicMiddlewares, authHandler.Login))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("could not log in as %s: %d %s", email, rr.Code, rr.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not read the login response: %v", err)
+	}
+	token, _ := response["token"].(string)
+	return token
+}
+
+// A path must be granted to a role of the requesting user. HasAuth used to
+// accept any user as soon as some role had the path.
+func TestAuthorizationRequiresAccessOfTheUser(t *testing.T) {
+	userUC := usecase.UserUC{
+		Log:    log,
+		Repo:   repository.NewUserRepository(db, log),
+		Outbox: repository.NewOutboxRepository(db, log),
+		Tx:     db,
+		Cache:  cache,
+	}
+	email := "no-access-" + uuid.NewString()[:8] + "@example.com"
+	ctx := context.WithValue(context.Background(), myctx.Key("user_id"), int64(425071490427828))
+	if _, _, err := userUC.Create(ctx, dto.UserCreateRequest{Name: "No Access", Email: email, Password: "Password123!", RePassword: "Password123!"}); err != nil {
+		t.Fatalf("could not create the user: %v", err)
+	}
+
+	userHandler := handler.Users{Log: log, Usecase: userUC}
+	router := httprouter.New()
+	router.GET("/users", mid.WrapMiddleware(privateMiddlewares, userHandler.List))
+	list := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", uuid.NewString())
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if status := list(loginAs(t, email, "Password123!")); status != http.StatusForbidden {
+		t.Errorf("user without access: got %d want %d", status, http.StatusForbidden)
+	}
+	if status := list(token); status != http.StatusOK {
+		t.Errorf("administrator: got %d want %d", status, http.StatusOK)
+	}
+}
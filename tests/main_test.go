@@ -3,29 +3,27 @@ package tests
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"path/filepath"
 	"rest-skeleton/internal/handler"
 	"rest-skeleton/internal/middleware"
+	appcache "rest-skeleton/internal/pkg/cache"
 	"rest-skeleton/internal/pkg/config"
+	"rest-skeleton/internal/pkg/database"
 	"rest-skeleton/internal/pkg/logger"
-	"rest-skeleton/internal/pkg/redis"
 	"rest-skeleton/internal/pkg/telemetry"
 	"testing"
-	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"go.opentelemetry.io/otel/metric"
 )
 
 var (
-	db                 *sql.DB
-	cache              *redis.Cache
+	db                 *database.Database
+	cache              appcache.Cache
 	done               func()
 	log                *logger.Logger
 	token              string
@@ -37,10 +35,7 @@ var (
 
 func TestMain(m *testing.M) {
 	var err error
-	today := time.Now().Format("2006-01-02")
-	logFileName := "../log/test-" + today + ".log"
-
-	log = logger.New(logFileName)
+	log = logger.New()
 	if _, ok := os.LookupEnv("APP_NAME"); !ok {
 		if err := config.Setup("../.env"); err != nil {
 			fmt.Println("failed to setup config", err)
@@ -48,19 +43,6 @@ func TestMain(m *testing.M) {
 		}
 	}
 
-	rootPath, err := filepath.Abs("../") // Path relatif ke folder root proyek
-	if err != nil {
-		fmt.Println("failed to find root directory", err)
-		return
-	}
-
-	// Ubah working directory ke root proyek
-	err = os.Chdir(rootPath)
-	if err != nil {
-		fmt.Println("failed to change working directory", err)
-		return
-	}
-
 	meter, err = telemetry.NewMeter(context.Background())
 	if err != nil {
 		fmt.Println("failed to create meter", err)
@@ -94,6 +76,7 @@ func TestMain(m *testing.M) {
 	mid = middleware.Middleware{Log: log, DB: db, Cache: cache, LatencyMetric: latencyMetric}
 	publicMiddlewares = []func(httprouter.Handle) httprouter.Handle{
 		mid.TraceAndMetricLatency,
+		mid.AccessLog,
 		mid.CORS,
 		mid.PanicRecovery,
 		mid.Semaphore,
@@ -117,7 +100,7 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-func login(log *logger.Logger, db *sql.DB) error {
+func login(log *logger.Logger, db *database.Database) error {
 	loginData := map[string]string{
 		"email":    "rijal.asep.nugroho@gmail.com",
 		"password": "qwertyuiop!1Q",
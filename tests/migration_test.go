@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"rest-skeleton/internal/pkg/migration"
+	"strings"
+	"testing"
+)
+
+// An install migrated before the seed migrations were replaced by seeders
+// still records them as applied. Rolling back must pass over them.
+func TestMigrateDownSkipsRemovedSeedMigrations(t *testing.T) {
+	for _, filename := range []string{"3.001_seed.sql", "3.002_seed_webhook_access.sql"} {
+		if _, err := db.Conn.Exec(`INSERT INTO _migrations (filename, checksum) VALUES ($1, 'removed')`, filename); err != nil {
+			t.Fatalf("could not record %s: %v", filename, err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Conn.Exec(`DELETE FROM _migrations WHERE checksum = 'removed'`)
+	})
+
+	var rolledBack, warnings []string
+	m := migration.New(db.Conn)
+	m.DryRun = true
+	m.Report = func(step migration.Step) { rolledBack = append(rolledBack, step.Filename) }
+	m.Warn = func(msg string) { warnings = append(warnings, msg) }
+
+	if err := m.Down(1); err != nil {
+		t.Fatalf("expected the rollback to pass over the missing files, got %v", err)
+	}
+	if len(rolledBack) != 1 || strings.HasPrefix(rolledBack[0], "3.") {
+		t.Errorf("expected the last schema migration to be rolled back, got %v", rolledBack)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("expected a warning per missing file, got %v", warnings)
+	}
+
+	rolledBack = nil
+	if err := m.Redo(); err != nil {
+		t.Fatalf("expected redo to pass over the missing files, got %v", err)
+	}
+	if len(rolledBack) != 2 || rolledBack[0] != rolledBack[1] {
+		t.Errorf("expected the last schema migration to be redone, got %v", rolledBack)
+	}
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/repository"
+	"testing"
+	"time"
+)
+
+// recordingSink remembers the events it received and fails while failing is set.
+type recordingSink struct {
+	events  []outbox.Event
+	failing bool
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Publish(ctx context.Context, event outbox.Event) error {
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func addEvents(t *testing.T, ctx context.Context, aggregateID int64, types ...string) {
+	t.Helper()
+	repo := repository.NewOutboxRepository(db, log)
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		for _, eventType := range types {
+			event, err := outbox.NewEvent("test", aggregateID, eventType, map[string]int64{"id": aggregateID})
+			if err != nil {
+				return err
+			}
+			if err := repo.Add(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutboxRelayDeliversInOrderPerAggregate(t *testing.T) {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "outbox-test")
+	db.Conn.Exec(`DELETE FROM outbox WHERE aggregate_type = 'test'`)
+	addEvents(t, ctx, 1, "First", "Second", "Third")
+
+	sink := &recordingSink{}
+	relay := &outbox.Relay{DB: db, Log: log, Sinks: []outbox.Sink{sink}}
+	for i := 0; i < 3; i++ {
+		if _, err := relay.RelayOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(sink.events))
+	}
+	for i, want := range []string{"First", "Second", "Third"} {
+		if sink.events[i].Type != want {
+			t.Errorf("event %d = %s want %s", i, sink.events[i].Type, want)
+		}
+	}
+}
+
+func TestOutboxRelayRetriesFailedEvent(t *testing.T) {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "outbox-test")
+	db.Conn.Exec(`DELETE FROM outbox WHERE aggregate_type = 'test'`)
+	addEvents(t, ctx, 2, "First", "Second")
+
+	sink := &recordingSink{failing: true}
+	relay := &outbox.Relay{DB: db, Log: log, Sinks: []outbox.Sink{sink}, MaxBackoff: time.Millisecond}
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts int
+	var lastError string
+	err := db.Conn.QueryRow(`SELECT attempts, last_error FROM outbox WHERE aggregate_type = 'test' AND event_type = 'First'`).Scan(&attempts, &lastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 1 || lastError == "" {
+		t.Errorf("expected one recorded failure, got %d attempts and %q", attempts, lastError)
+	}
+
+	sink.failing = false
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := relay.RelayOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sink.events) != 2 || sink.events[0].Type != "First" || sink.events[1].Type != "Second" {
+		t.Errorf("expected the failed event to be retried before the next one, got %+v", sink.events)
+	}
+}
+
+// claimingSink runs another relay while it delivers an event.
+type claimingSink struct {
+	other *outbox.Relay
+}
+
+func (s *claimingSink) Name() string { return "claiming" }
+
+func (s *claimingSink) Publish(ctx context.Context, event outbox.Event) error {
+	_, err := s.other.RelayOnce(ctx)
+	return err
+}
+
+func TestOutboxRelayLeasesClaimedEvents(t *testing.T) {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "outbox-test")
+	db.Conn.Exec(`DELETE FROM outbox WHERE aggregate_type = 'test'`)
+	addEvents(t, ctx, 3, "Created")
+	addEvents(t, ctx, 4, "Created")
+
+	// Delivery runs outside the claiming transaction, so the other relay
+	// runs while the events are delivered, but they are leased and hidden
+	// from it.
+	seen := &recordingSink{}
+	relay := &outbox.Relay{DB: db, Log: log, Sinks: []outbox.Sink{&claimingSink{
+		other: &outbox.Relay{DB: db, Log: log, Sinks: []outbox.Sink{seen}},
+	}}}
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range seen.events {
+		if event.AggregateType == "test" {
+			t.Errorf("expected the leased event %d to be hidden from the other relay", event.ID)
+		}
+	}
+	var pending int
+	if err := db.Conn.QueryRow(`SELECT count(*) FROM outbox WHERE aggregate_type = 'test' AND published_at IS NULL`).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Errorf("expected both events to be published, got %d pending", pending)
+	}
+}
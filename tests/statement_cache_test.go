@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"context"
+	"rest-skeleton/internal/pkg/database"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/repository"
+	"testing"
+)
+
+// BenchmarkHasAuth compares the permission check that runs on every private
+// request with and without the prepared statement cache:
+//
+//	go test ./tests -run '^$' -bench HasAuth
+func BenchmarkHasAuth(b *testing.B) {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "benchmark")
+
+	uncached := &database.Database{Conn: db.Conn}
+	cached := &database.Database{Conn: db.Conn}
+	cached.EnableStatementCache()
+
+	for _, bench := range []struct {
+		name string
+		db   *database.Database
+	}{
+		{"uncached", uncached},
+		{"cached", cached},
+	} {
+		repo := repository.NewAuthRepository(bench.db, log)
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.HasAuth(ctx, "GET /users"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestStatementCacheSurvivesSchemaChange(t *testing.T) {
+	ctx := context.Background()
+	cached := &database.Database{Conn: db.Conn}
+	cached.EnableStatementCache()
+
+	if _, err := db.Conn.Exec(`CREATE TABLE stmt_cache_probe (id int)`); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Conn.Exec(`DROP TABLE stmt_cache_probe`)
+
+	const q = `SELECT * FROM stmt_cache_probe`
+	rows, err := cached.Reader(ctx).QueryContext(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	if _, err := db.Conn.Exec(`ALTER TABLE stmt_cache_probe ADD COLUMN name text`); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err = cached.Reader(ctx).QueryContext(ctx, q)
+	if err != nil {
+		t.Fatalf("expected the stale statement to be re-prepared, got %v", err)
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	if len(columns) != 2 {
+		t.Errorf("expected the new column, got %v", columns)
+	}
+}
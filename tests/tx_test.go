@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func roleExists(t *testing.T, name string) bool {
+	t.Helper()
+	var exists bool
+	err := db.Conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)`, name).Scan(&exists)
+	if err != nil {
+		t.Fatalf("could not check role %s: %v", name, err)
+	}
+	return exists
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := db.Executor(ctx).ExecContext(ctx, `INSERT INTO roles (name) VALUES ('tx-rollback')`); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected boom error, got %v", err)
+	}
+
+	if roleExists(t, "tx-rollback") {
+		t.Error("expected insert to be rolled back")
+	}
+}
+
+func TestWithTxNestedUsesSavepoint(t *testing.T) {
+	ctx := context.Background()
+
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := db.Executor(ctx).ExecContext(ctx, `INSERT INTO roles (name) VALUES ('tx-outer')`); err != nil {
+			return err
+		}
+
+		innerErr := db.WithTx(ctx, func(ctx context.Context) error {
+			if _, err := db.Executor(ctx).ExecContext(ctx, `INSERT INTO roles (name) VALUES ('tx-inner')`); err != nil {
+				return err
+			}
+			return errors.New("inner failed")
+		})
+		if innerErr == nil {
+			t.Error("expected inner transaction to fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !roleExists(t, "tx-outer") {
+		t.Error("expected outer insert to be committed")
+	}
+	if roleExists(t, "tx-inner") {
+		t.Error("expected inner insert to be rolled back to its savepoint")
+	}
+}
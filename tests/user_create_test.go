@@ -9,6 +9,8 @@ import (
 	"rest-skeleton/internal/dto"
 	"rest-skeleton/internal/handler"
 	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
 	"strings"
 	"sync"
 	"testing"
@@ -115,7 +117,14 @@ func getScenarios() []UserCreateScenario {
 }
 
 func TestCreateUser(t *testing.T) {
-	userHandler := handler.Users{DB: db, Log: log, Cache: cache}
+	userUC := usecase.UserUC{
+		Log:    log,
+		Repo:   repository.NewUserRepository(db, log),
+		Outbox: repository.NewOutboxRepository(db, log),
+		Tx:     db,
+		Cache:  cache,
+	}
+	userHandler := handler.Users{Log: log, Usecase: userUC}
 
 	router := httprouter.New()
 	router.POST("/users", mid.WrapMiddleware(publicMiddlewares, userHandler.Create))
@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"rest-skeleton/internal/dto"
+	"rest-skeleton/internal/handler"
+	"rest-skeleton/internal/model"
+	"rest-skeleton/internal/pkg/myctx"
+	"rest-skeleton/internal/pkg/outbox"
+	"rest-skeleton/internal/pkg/webhook"
+	"rest-skeleton/internal/repository"
+	"rest-skeleton/internal/usecase"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// webhookReceiver verifies signatures and answers with status.
+type webhookReceiver struct {
+	mu      sync.Mutex
+	secret  string
+	status  int
+	eventID []string
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if err := webhook.Verify(rc.secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rc.eventID = append(rc.eventID, r.Header.Get(webhook.HeaderID))
+	w.WriteHeader(rc.status)
+}
+
+func webhookRequest(t *testing.T, router *httprouter.Router, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req = req.WithContext(context.WithValue(req.Context(), myctx.Key("user_id"), int64(425071490427828)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", uuid.NewString())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestWebhookDeliveryEndToEnd(t *testing.T) {
+	ctx := context.WithValue(context.Background(), myctx.Key("traceID"), "webhook-test")
+	ctx = context.WithValue(ctx, myctx.Key("user_id"), int64(425071490427828))
+
+	receiver := &webhookReceiver{secret: "0123456789abcdef", status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	repo := repository.NewWebhookRepository(db, log)
+	webhookHandler := handler.Webhooks{Log: log, Usecase: usecase.WebhookUC{Log: log, Repo: repo}}
+	router := httprouter.New()
+	router.POST("/webhooks", mid.WrapMiddleware(publicMiddlewares, webhookHandler.Create))
+	router.GET("/webhook-deliveries", mid.WrapMiddleware(publicMiddlewares, webhookHandler.Deliveries))
+	router.POST("/webhook-deliveries/:id/redeliver", mid.WrapMiddleware(publicMiddlewares, webhookHandler.Redeliver))
+
+	rr := webhookRequest(t, router, http.MethodPost, "/webhooks", dto.WebhookRequest{
+		URL:        server.URL,
+		EventTypes: []string{model.EventUserCreated},
+		Secret:     receiver.secret,
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create webhook: got %d %s", rr.Code, rr.Body.String())
+	}
+	var subscription dto.WebhookResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	userUC := usecase.UserUC{
+		Log:    log,
+		Repo:   repository.NewUserRepository(db, log),
+		Outbox: repository.NewOutboxRepository(db, log),
+		Tx:     db,
+		Cache:  cache,
+	}
+	if _, _, err := userUC.Create(ctx, dto.UserCreateRequest{
+		Name:     "Webhook User",
+		Email:    uuid.NewString() + "@example.com",
+		Password: "Password123!",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := outbox.NewBus()
+	bus.Subscribe("*", webhook.Fanout{Store: repo}.Handle)
+	relay := &outbox.Relay{DB: db, Log: log, Sinks: []outbox.Sink{bus}}
+	for {
+		if n, err := relay.RelayOnce(ctx); err != nil {
+			t.Fatal(err)
+		} else if n == 0 {
+			break
+		}
+	}
+
+	dispatcher := &webhook.Dispatcher{Store: repo, Log: log, Client: server.Client(), MaxAttempts: 1}
+	if _, err := dispatcher.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/webhook-deliveries?subscription_id=%d&status=dead", subscription.ID)
+	var dead []dto.WebhookDeliveryResponse
+	if rr := webhookRequest(t, router, http.MethodGet, path, nil); rr.Code != http.StatusOK {
+		t.Fatalf("list deliveries: got %d", rr.Code)
+	} else if err := json.Unmarshal(rr.Body.Bytes(), &dead); err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected one dead-lettered delivery, got %+v", dead)
+	}
+
+	receiver.status = http.StatusNoContent
+	if rr := webhookRequest(t, router, http.MethodPost, fmt.Sprintf("/webhook-deliveries/%d/redeliver", dead[0].ID), nil); rr.Code != http.StatusAccepted {
+		t.Fatalf("redeliver: got %d", rr.Code)
+	}
+	if _, err := dispatcher.DispatchOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery, attempts, err := repo.FindDelivery(ctx, dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != model.DeliverySucceeded || len(attempts) != 2 {
+		t.Errorf("expected the redelivery to succeed after one failure, got %s with %d attempts", delivery.Status, len(attempts))
+	}
+	if delivery.Attempts != 1 {
+		t.Errorf("expected redelivery to restart the retry budget, got %d attempts", delivery.Attempts)
+	}
+	if len(receiver.eventID) != 2 || receiver.eventID[0] != receiver.eventID[1] {
+		t.Errorf("expected the same event to be posted twice, got %v", receiver.eventID)
+	}
+}
+
+func TestWebhookUpdateKeepsActiveWhenMissing(t *testing.T) {
+	repo := repository.NewWebhookRepository(db, log)
+	webhookHandler := handler.Webhooks{Log: log, Usecase: usecase.WebhookUC{Log: log, Repo: repo}}
+	router := httprouter.New()
+	router.POST("/webhooks", mid.WrapMiddleware(publicMiddlewares, webhookHandler.Create))
+	router.PUT("/webhooks/:id", mid.WrapMiddleware(publicMiddlewares, webhookHandler.Update))
+
+	inactive := false
+	rr := webhookRequest(t, router, http.MethodPost, "/webhooks", dto.WebhookRequest{
+		URL:        "https://example.com/hooks",
+		EventTypes: []string{model.EventUserCreated},
+		Active:     &inactive,
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create webhook: got %d %s", rr.Code, rr.Body.String())
+	}
+	var created dto.WebhookResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	rr = webhookRequest(t, router, http.MethodPut, fmt.Sprintf("/webhooks/%d", created.ID), dto.WebhookRequest{
+		ID:         created.ID,
+		URL:        "https://example.com/hooks/v2",
+		EventTypes: []string{model.EventUserCreated},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update webhook: got %d %s", rr.Code, rr.Body.String())
+	}
+
+	subscription, err := repo.FindSubscription(context.Background(), created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscription.Active || subscription.URL != "https://example.com/hooks/v2" {
+		t.Errorf("expected the subscription to be updated and stay inactive, got %+v", subscription)
+	}
+}